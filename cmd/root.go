@@ -19,13 +19,22 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"os"
 	"strings"
+	"time"
 
+	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/cmd/history"
 	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/cmd/poll"
+	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/cmd/poll/servicedirectory"
+	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/cmd/run"
 	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/cmd/watch"
 	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/configuration"
+	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/election"
+	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/logging"
+	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/tracing"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/cobra"
@@ -34,10 +43,9 @@ import (
 var (
 	logger         zerolog.Logger
 	debugMode      bool
-	interval       int
-	metadataKey    string
 	endpoint       string
 	configFilePath string
+	stopTracing    func(context.Context) error
 )
 
 // rootCmd represents the base command when called without any subcommands
@@ -53,6 +61,26 @@ a separate handler for processing.`,
 		if len(configFilePath) > 0 {
 			configuration.ParseConfigurationFile(cmd)
 		}
+
+		// Events written on the standard output must not be mixed with logs
+		var out io.Writer = os.Stdout
+		if writesToStdout() {
+			out = os.Stderr
+		}
+		if err := logging.Setup(getLoggingOptions(cmd), out); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		logger = log.Logger
+
+		// The root command may execute itself again with other arguments
+		if stopTracing == nil {
+			stop, err := tracing.Start(context.Background(), getTracingOptions(cmd))
+			if err != nil {
+				logger.Fatal().Err(err).Msg("error while starting tracing")
+			}
+			stopTracing = stop
+		}
 	},
 	Run: func(cmd *cobra.Command, args []string) {
 		conf := configuration.GetConfigFile()
@@ -62,6 +90,21 @@ a separate handler for processing.`,
 			return
 		}
 
+		if srConf := conf.ServiceRegistry; srConf != nil {
+			registries := 0
+			for _, present := range []bool{srConf.GCPServiceDirectory != nil, srConf.AWSCloudMap != nil, srConf.Etcd != nil} {
+				if present {
+					registries++
+				}
+			}
+
+			if registries > 1 {
+				cmd.SetArgs([]string{"run"})
+				cmd.Execute()
+				return
+			}
+		}
+
 		if conf.ServiceRegistry != nil && conf.ServiceRegistry.GCPServiceDirectory != nil {
 			cmd.SetArgs([]string{"servicedirectory"})
 			cmd.Execute()
@@ -74,6 +117,12 @@ a separate handler for processing.`,
 			return
 		}
 
+		if conf.ServiceRegistry != nil && conf.ServiceRegistry.Etcd != nil {
+			cmd.SetArgs([]string{"watch", "etcd"})
+			cmd.Execute()
+			return
+		}
+
 		logger.Fatal().Msg("no service registry provided")
 		cmd.Usage()
 	},
@@ -82,52 +131,139 @@ a separate handler for processing.`,
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
 func Execute() {
-	if err := rootCmd.Execute(); err != nil {
+	err := rootCmd.Execute()
+	if stopTracing != nil {
+		// Export the spans that are still pending
+		ctx, canc := context.WithTimeout(context.Background(), 5*time.Second)
+		stopTracing(ctx)
+		canc()
+	}
+
+	if err != nil {
 		fmt.Println(err)
 		os.Exit(1)
 	}
 }
 
 func init() {
-	cobra.OnInitialize(initConfig)
-
-	rootCmd.PersistentFlags().BoolVarP(&debugMode, "debug", "d", false, "whether to log debug lines")
-	rootCmd.PersistentFlags().IntVarP(&interval, "interval", "i", 5, "number of seconds between two consecutive polls")
-	rootCmd.PersistentFlags().StringVar(&endpoint, "adaptor-api", "localhost:80/cnwan", "the api, in forrm of host:port/path, where the events will be sent to. Look at the documentation to learn more about this.")
+	rootCmd.PersistentFlags().BoolVarP(&debugMode, "debug", "d", false, "whether to log debug lines. Same as --log-level debug")
+	rootCmd.PersistentFlags().String("log-format", logging.FormatConsole, "the format of the logs: console or json")
+	rootCmd.PersistentFlags().String("log-level", "info", "the minimum level of the logs to write: trace, debug, info, warn, error, fatal or panic")
+	rootCmd.PersistentFlags().String("log-file", "", "path to a file where to append logs to, instead of writing them on the terminal")
+	rootCmd.PersistentFlags().IntP("interval", "i", 5, "number of seconds between two consecutive polls")
+	rootCmd.PersistentFlags().StringVar(&endpoint, "adaptor-api", "localhost:80/cnwan", "the api, in forrm of host:port/path or https://host:port/path, where the events will be sent to. stdout://, file://, unix://, grpc://, nats:// and kafka:// are supported as well. Look at the documentation to learn more about this.")
 	rootCmd.PersistentFlags().StringVar(&configFilePath, "conf", "", "path to the configuration file, if any")
+	rootCmd.PersistentFlags().String("api-version", "v1", "the version of the API implemented by the adaptor: v1 sends metadata as a list, v2 as a map")
+	rootCmd.PersistentFlags().String("event-format", "openapi", "the format of the events sent to the adaptor: openapi, cloudevents-structured, cloudevents-batch or cloudevents-binary")
+	rootCmd.PersistentFlags().String("adaptor-token-file", "", "path to a file containing a bearer token to authenticate to the adaptor with. The file is read again when it changes")
+	rootCmd.PersistentFlags().String("adaptor-username", "", "username to authenticate to the adaptor with, via basic auth")
+	rootCmd.PersistentFlags().String("adaptor-password", "", "password to authenticate to the adaptor with, via basic auth")
+	rootCmd.PersistentFlags().String("adaptor-api-key", "", "API key to authenticate to the adaptor with")
+	rootCmd.PersistentFlags().String("adaptor-api-key-header", "X-API-Key", "the header where to send the API key")
+	rootCmd.PersistentFlags().StringToString("adaptor-header", map[string]string{}, "header to include in every request to the adaptor, in form of key=value. Can be repeated")
+	rootCmd.PersistentFlags().String("adaptor-ca-cert", "", "path to the certificates of the CAs that signed the adaptor's certificate, for https:// adaptors")
+	rootCmd.PersistentFlags().String("adaptor-client-cert", "", "path to the certificate to present to the adaptor, in case it requires mutual TLS")
+	rootCmd.PersistentFlags().String("adaptor-client-key", "", "path to the private key of the adaptor client certificate")
+	rootCmd.PersistentFlags().String("adaptor-server-name", "", "name to expect in the adaptor's certificate, in case it is different from its host")
+	rootCmd.PersistentFlags().StringSlice("adaptor-signing-secret-file", []string{}, "path to a file containing a secret to sign requests to the adaptor with. Can be repeated to sign with more than one secret")
+	rootCmd.PersistentFlags().Int("resync-interval", 0, "number of seconds between two consecutive deliveries of the full current state to the adaptor. 0 disables it")
+	rootCmd.PersistentFlags().String("server-address", "", "address where to serve the current state, the latest events and the metrics, e.g. :8080. If empty, the server is not started")
+	rootCmd.PersistentFlags().Int("server-history-size", 1000, "number of events kept in the history served by the server")
+	rootCmd.PersistentFlags().String("otlp-endpoint", "", "endpoint of the OpenTelemetry collector where to export spans with OTLP, e.g. localhost:4317. If empty, spans are not exported")
+	rootCmd.PersistentFlags().String("otlp-protocol", "grpc", "protocol to export spans with: grpc or http")
+	rootCmd.PersistentFlags().Bool("otlp-insecure", false, "whether to connect to the OpenTelemetry collector without TLS")
+	rootCmd.PersistentFlags().String("audit-log", "", "path to a file where to record the batches of events sent to the adaptors, which can be read with the history command. If empty, they are not recorded")
+	rootCmd.PersistentFlags().Int("audit-log-max-size", 100, "size in megabytes after which the audit log is rotated")
+	rootCmd.PersistentFlags().Int("audit-log-max-backups", 5, "number of rotated audit logs to keep")
+	rootCmd.PersistentFlags().String("leader-election", "", "backend to elect the only instance that sends events to the adaptors, when more than one is running: etcd, kubernetes or file. If empty, leader election is disabled")
+	rootCmd.PersistentFlags().String("leader-election-name", election.DefaultName, "name of the etcd key or of the Kubernetes Lease used to elect the leader")
+	rootCmd.PersistentFlags().String("leader-election-namespace", "", "namespace of the Kubernetes Lease used to elect the leader. If empty, the namespace of the pod is used")
+	rootCmd.PersistentFlags().String("leader-election-file", "", "path to the file to lock to elect the leader, with the file backend. If empty, cnwan-reader.lock in the temporary directory is used")
+	rootCmd.PersistentFlags().Int("leader-election-lease-duration", 15, "number of seconds after which another instance becomes the leader if the current one stops renewing its lease")
+	rootCmd.PersistentFlags().Int("liveness-threshold", 0, "number of seconds after which /healthz fails if the service registry has not been polled successfully. 0 disables it")
 
 	// Add the poll command
 	rootCmd.AddCommand(poll.GetPollCommand())
+	// servicedirectory is also available without poll, as in previous
+	// versions
+	rootCmd.AddCommand(servicedirectory.GetServiceDirectoryCommand())
 	rootCmd.AddCommand(watch.GetWatchCommand())
+	rootCmd.AddCommand(history.GetHistoryCommand())
+	rootCmd.AddCommand(run.GetRunCommand())
 }
 
-func initConfig() {
-	// -- Configure logger
-	log.Logger = log.Output(zerolog.ConsoleWriter{
-		Out: os.Stdout,
-		FormatMessage: func(i interface{}) string {
-			return fmt.Sprintf("%s\t|", i)
-		},
-	}).Level(func() zerolog.Level {
-		if debugMode {
-			return zerolog.DebugLevel
+// writesToStdout returns true if events are written on the standard output,
+// in which case logs must be written somewhere else.
+func writesToStdout() bool {
+	endpoints := []string{endpoint}
+	if conf := configuration.GetConfigFile(); conf != nil {
+		endpoints = append(endpoints, conf.Adaptor)
+		for _, adaptor := range conf.Adaptors {
+			endpoints = append(endpoints, adaptor.API)
+		}
+	}
+
+	for _, endp := range endpoints {
+		if strings.HasPrefix(endp, "stdout://") {
+			return true
 		}
+	}
 
-		return zerolog.InfoLevel
-	}())
-	logger = log.Logger
+	return false
 }
 
-// TODO: remove this and use utils.SanitizeLocalhost.
-func sanitizeAdaptorEndpoint(endp string) string {
-	endp = strings.Trim(endp, "/")
+// getLoggingOptions returns how and where to write logs from the flags and
+// the configuration file.
+func getLoggingOptions(cmd *cobra.Command) *logging.Options {
+	opts := &logging.Options{}
+	conf := configuration.GetConfigFile()
+	if conf != nil && conf.Log != nil {
+		opts.Format = conf.Log.Format
+		opts.Level = conf.Log.Level
+		opts.File = conf.Log.File
+	}
+	if conf != nil && conf.DebugMode && len(opts.Level) == 0 {
+		opts.Level = zerolog.DebugLevel.String()
+	}
 
-	if strings.HasPrefix(endp, "localhost") {
-		// Replace localhost in case we are running insde docker
-		if mode := os.Getenv("MODE"); len(mode) > 0 && mode == "docker" {
-			return strings.Replace(endp, "localhost", "host.docker.internal", 1)
-		}
+	if cmd.Flags().Changed("log-format") {
+		opts.Format, _ = cmd.Flags().GetString("log-format")
+	}
+	if cmd.Flags().Changed("log-level") {
+		opts.Level, _ = cmd.Flags().GetString("log-level")
+	} else if cmd.Flags().Changed("debug") && debugMode {
+		opts.Level = zerolog.DebugLevel.String()
+	}
+	if cmd.Flags().Changed("log-file") {
+		opts.File, _ = cmd.Flags().GetString("log-file")
+	}
+
+	return opts
+}
+
+// getTracingOptions returns where to export spans from the flags and the
+// configuration file, or nil if they must not be exported.
+func getTracingOptions(cmd *cobra.Command) *tracing.Options {
+	opts := &tracing.Options{}
+	if conf := configuration.GetConfigFile(); conf != nil && conf.Tracing != nil {
+		opts.Endpoint = conf.Tracing.Endpoint
+		opts.Protocol = conf.Tracing.Protocol
+		opts.Insecure = conf.Tracing.Insecure
+	}
+
+	if cmd.Flags().Changed("otlp-endpoint") {
+		opts.Endpoint, _ = cmd.Flags().GetString("otlp-endpoint")
+	}
+	if cmd.Flags().Changed("otlp-protocol") || len(opts.Protocol) == 0 {
+		opts.Protocol, _ = cmd.Flags().GetString("otlp-protocol")
+	}
+	if cmd.Flags().Changed("otlp-insecure") {
+		opts.Insecure, _ = cmd.Flags().GetBool("otlp-insecure")
+	}
+
+	if len(opts.Endpoint) == 0 {
+		return nil
 	}
 
-	return endp
+	return opts
 }
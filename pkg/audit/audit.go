@@ -0,0 +1,123 @@
+// Copyright © 2021 Cisco
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// All rights reserved.
+
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/openapi"
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+const (
+	// DefaultMaxSize is the size in megabytes after which the log is
+	// rotated.
+	DefaultMaxSize int = 100
+	// DefaultMaxBackups is the number of rotated logs that are kept.
+	DefaultMaxBackups int = 5
+)
+
+// Record is a batch of events sent to an adaptor.
+type Record struct {
+	// Time when the batch was sent
+	Time time.Time `json:"time"`
+	// Adaptor is the name of the adaptor that the batch was sent to
+	Adaptor string `json:"adaptor"`
+	// BatchID is the ID of the batch
+	BatchID string `json:"batchId"`
+	// StatusCode of the response of the adaptor, if it is reached over HTTP
+	StatusCode int `json:"statusCode,omitempty"`
+	// Error occurred while sending the batch, if any
+	Error string `json:"error,omitempty"`
+	// ResourceErrors are the errors that the adaptor reported on single
+	// resources
+	ResourceErrors []openapi.ResourceResponse `json:"resourceErrors,omitempty"`
+	// Events contained in the batch
+	Events []openapi.Event `json:"events"`
+}
+
+// Options contains settings about where to write the log and how to rotate
+// it.
+type Options struct {
+	// Path of the file where to write records. Rotated logs are in the
+	// same directory, with the time of the rotation in their name, e.g.
+	// audit-2021-06-01T10-00-00.000.log
+	Path string
+	// MaxSize is the size in megabytes after which the log is rotated.
+	// If 0, DefaultMaxSize is used
+	MaxSize int
+	// MaxBackups is the number of rotated logs to keep.
+	// If 0, DefaultMaxBackups is used
+	MaxBackups int
+}
+
+// Log writes records as JSON lines to a file, which is rotated when it gets
+// too big. It is safe to use from more than one goroutine.
+type Log struct {
+	w *lumberjack.Logger
+}
+
+// Open returns a Log that appends records to the file defined by opts,
+// creating it if it doesn't exist.
+func Open(opts *Options) (*Log, error) {
+	if opts == nil || len(opts.Path) == 0 {
+		return nil, fmt.Errorf("no audit log path provided")
+	}
+
+	w := &lumberjack.Logger{
+		Filename:   opts.Path,
+		MaxSize:    opts.MaxSize,
+		MaxBackups: opts.MaxBackups,
+	}
+	if w.MaxSize <= 0 {
+		w.MaxSize = DefaultMaxSize
+	}
+	if w.MaxBackups <= 0 {
+		w.MaxBackups = DefaultMaxBackups
+	}
+
+	// The file is opened on the first write: do it now, so that errors
+	// are found before any batch is sent
+	if _, err := w.Write(nil); err != nil {
+		return nil, fmt.Errorf("could not open audit log: %w", err)
+	}
+
+	return &Log{w: w}, nil
+}
+
+// Write appends the record to the log, rotating it first if the record
+// would make it exceed its maximum size.
+func (a *Log) Write(rec *Record) error {
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+
+	// The line is written at once, so records written by different
+	// goroutines are not mixed up
+	_, err = a.w.Write(append(line, '\n'))
+	return err
+}
+
+// Close closes the file of the log.
+func (a *Log) Close() error {
+	return a.w.Close()
+}
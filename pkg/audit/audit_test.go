@@ -0,0 +1,215 @@
+// Copyright © 2021 Cisco
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// All rights reserved.
+
+package audit
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/openapi"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWrite(t *testing.T) {
+	a := assert.New(t)
+	dir := t.TempDir()
+	logPath := path.Join(dir, "audit.log")
+
+	_, err := Open(&Options{})
+	a.Equal(fmt.Errorf("no audit log path provided"), err)
+
+	auditLog, err := Open(&Options{Path: logPath, MaxBackups: 1})
+	if !a.NoError(err) {
+		return
+	}
+	a.FileExists(logPath)
+
+	for i := 0; i < 5; i++ {
+		err := auditLog.Write(&Record{
+			Time:    time.Date(2021, 6, 1, 10, i, 0, 0, time.UTC),
+			Adaptor: "adaptor",
+			BatchID: fmt.Sprintf("batch-%d", i),
+			Events:  []openapi.Event{{Event: "create"}},
+		})
+		if !a.NoError(err) {
+			return
+		}
+
+		if i%2 == 1 {
+			// Rotated logs are named after the time in milliseconds
+			time.Sleep(5 * time.Millisecond)
+			a.NoError(auditLog.w.Rotate())
+		}
+	}
+	a.NoError(auditLog.Close())
+
+	// Only the newest rotated log is kept, in background
+	var backups []string
+	for i := 0; i < 100; i++ {
+		backups, _ = filepath.Glob(path.Join(dir, "audit-*.log"))
+		if len(backups) == 1 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if !a.Len(backups, 1) {
+		return
+	}
+
+	content, err := ioutil.ReadFile(backups[0])
+	if a.NoError(err) {
+		lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+		if a.Len(lines, 2) {
+			a.Contains(lines[0], "batch-2")
+			a.Contains(lines[1], "batch-3")
+		}
+	}
+
+	// Older records have been deleted, the others are read in order
+	records, err := Read(logPath, nil)
+	if a.NoError(err) && a.Len(records, 3) {
+		for i, rec := range records {
+			a.Equal(fmt.Sprintf("batch-%d", i+2), rec.BatchID)
+		}
+	}
+
+	// Records are appended to an existing log
+	auditLog, err = Open(&Options{Path: logPath})
+	if a.NoError(err) {
+		a.NoError(auditLog.Write(&Record{BatchID: "batch-5"}))
+		auditLog.Close()
+	}
+	records, _ = Read(logPath, nil)
+	a.Len(records, 4)
+}
+
+func TestRead(t *testing.T) {
+	a := assert.New(t)
+	logPath := path.Join(t.TempDir(), "audit.log")
+
+	_, err := Read(logPath, nil)
+	a.Error(err)
+
+	video := openapi.Service{
+		Id:       "ns/serv/video",
+		Name:     "video",
+		Address:  "10.10.10.10",
+		Port:     8080,
+		Metadata: []openapi.Metadata{{Key: "traffic-profile", Value: "video"}},
+	}
+	voice := openapi.Service{
+		Id:       "ns/serv/voice",
+		Name:     "voice",
+		Address:  "10.10.10.11",
+		Port:     8080,
+		Metadata: []openapi.Metadata{{Key: "traffic-profile", Value: "voice"}},
+	}
+	auditLog, err := Open(&Options{Path: logPath})
+	if !a.NoError(err) {
+		return
+	}
+	auditLog.Write(&Record{
+		Time:    time.Date(2021, 6, 1, 10, 0, 0, 0, time.UTC),
+		BatchID: "first",
+		Events:  []openapi.Event{{Event: "create", Service: video}, {Event: "create", Service: voice}},
+	})
+	auditLog.Write(&Record{
+		Time:       time.Date(2021, 6, 1, 11, 0, 0, 0, time.UTC),
+		BatchID:    "second",
+		StatusCode: 207,
+		ResourceErrors: []openapi.ResourceResponse{
+			{Resource: "ns/serv/voice", Status: 422, Title: "UNPROCESSABLE ENTITY"},
+		},
+		Events: []openapi.Event{{Event: "delete", Service: voice}},
+	})
+	auditLog.Close()
+
+	cases := []struct {
+		filter     *Filter
+		expBatches []string
+		expEvents  int
+	}{
+		{
+			expBatches: []string{"first", "second"},
+			expEvents:  3,
+		},
+		{
+			filter:     &Filter{Endpoint: "ns/serv/video"},
+			expBatches: []string{"first"},
+			expEvents:  1,
+		},
+		{
+			filter:     &Filter{Endpoint: "video"},
+			expBatches: []string{},
+		},
+		{
+			filter:     &Filter{Endpoint: "10.10.10.11:8080"},
+			expBatches: []string{"first", "second"},
+			expEvents:  2,
+		},
+		{
+			filter:     &Filter{Metadata: "voice"},
+			expBatches: []string{"first", "second"},
+			expEvents:  2,
+		},
+		{
+			filter:     &Filter{Metadata: "traffic-profile=video"},
+			expBatches: []string{"first"},
+			expEvents:  1,
+		},
+		{
+			filter:     &Filter{Metadata: "other-key=video"},
+			expBatches: []string{},
+		},
+		{
+			filter:     &Filter{Since: time.Date(2021, 6, 1, 10, 30, 0, 0, time.UTC)},
+			expBatches: []string{"second"},
+			expEvents:  1,
+		},
+		{
+			filter:     &Filter{Until: time.Date(2021, 6, 1, 10, 30, 0, 0, time.UTC), Metadata: "voice"},
+			expBatches: []string{"first"},
+			expEvents:  1,
+		},
+	}
+
+	failed := func(i int) {
+		a.FailNow("case failed", fmt.Sprintf("case %d", i))
+	}
+	for i, currCase := range cases {
+		records, err := Read(logPath, currCase.filter)
+		if !a.NoError(err) {
+			failed(i)
+		}
+
+		batches, events := []string{}, 0
+		for _, rec := range records {
+			batches = append(batches, rec.BatchID)
+			events += len(rec.Events)
+		}
+		if !a.Equal(currCase.expBatches, batches) || !a.Equal(currCase.expEvents, events) {
+			failed(i)
+		}
+	}
+}
@@ -0,0 +1,185 @@
+// Copyright © 2021 Cisco
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// All rights reserved.
+
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/openapi"
+)
+
+// backupTimeFormat is the format of the time in the name of rotated logs.
+const backupTimeFormat string = "2006-01-02T15-04-05.000"
+
+// Filter defines which records and events to read from the log.
+// Empty fields match everything.
+type Filter struct {
+	// Endpoint is the ID of the endpoint, e.g. ns/service/endpoint, or
+	// its address and port, e.g. 10.10.10.10:8080
+	Endpoint string
+	// Metadata is the value of a metadata of the endpoint, or key=value
+	// to match a specific key as well
+	Metadata string
+	// Since excludes records sent before this time
+	Since time.Time
+	// Until excludes records sent after this time
+	Until time.Time
+}
+
+// Read returns the records in the log at path, including the rotated ones,
+// that match filter, from the oldest to the newest. Records only contain
+// the events that match filter.
+func Read(path string, filter *Filter) ([]*Record, error) {
+	if filter == nil {
+		filter = &Filter{}
+	}
+
+	paths, err := logPaths(path)
+	if err != nil {
+		return nil, err
+	}
+
+	records := []*Record{}
+	for _, p := range paths {
+		recs, err := readFile(p, filter)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, recs...)
+	}
+
+	return records, nil
+}
+
+// logPaths returns the paths of the rotated logs, from the oldest, and the
+// one of the current log.
+func logPaths(path string) ([]string, error) {
+	// Rotated logs are named as prefix-<time>.ext
+	ext := filepath.Ext(path)
+	prefix := strings.TrimSuffix(path, ext) + "-"
+	matches, err := filepath.Glob(prefix + "*" + ext)
+	if err != nil {
+		return nil, err
+	}
+
+	backups := []string{}
+	for _, match := range matches {
+		timestamp := strings.TrimSuffix(strings.TrimPrefix(match, prefix), ext)
+		if _, err := time.Parse(backupTimeFormat, timestamp); err == nil {
+			backups = append(backups, match)
+		}
+	}
+	// The format of the time sorts backups from the oldest
+	sort.Strings(backups)
+
+	if _, err := os.Stat(path); err == nil || len(backups) == 0 {
+		backups = append(backups, path)
+	}
+
+	return backups, nil
+}
+
+func readFile(path string, filter *Filter) ([]*Record, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not open audit log: %w", err)
+	}
+	defer file.Close()
+
+	records := []*Record{}
+	reader := bufio.NewReader(file)
+	for lineNum := 1; ; lineNum++ {
+		line, readErr := reader.ReadBytes('\n')
+		if len(strings.TrimSpace(string(line))) > 0 {
+			var rec Record
+			if err := json.Unmarshal(line, &rec); err != nil {
+				return nil, fmt.Errorf("%s:%d: invalid record: %w", path, lineNum, err)
+			}
+
+			if filter.matches(&rec) {
+				records = append(records, &rec)
+			}
+		}
+
+		if readErr != nil {
+			break
+		}
+	}
+
+	return records, nil
+}
+
+// matches returns true if the record matches the filter, in which case its
+// events are replaced with the ones that match it.
+func (f *Filter) matches(rec *Record) bool {
+	if !f.Since.IsZero() && rec.Time.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && rec.Time.After(f.Until) {
+		return false
+	}
+
+	if len(f.Endpoint) == 0 && len(f.Metadata) == 0 {
+		return true
+	}
+
+	events := []openapi.Event{}
+	for _, ev := range rec.Events {
+		if f.matchesEndpoint(ev.Service) && f.matchesMetadata(ev.Service) {
+			events = append(events, ev)
+		}
+	}
+	rec.Events = events
+
+	return len(events) > 0
+}
+
+func (f *Filter) matchesEndpoint(serv openapi.Service) bool {
+	if len(f.Endpoint) == 0 {
+		return true
+	}
+
+	return serv.Id == f.Endpoint || fmt.Sprintf("%s:%d", serv.Address, serv.Port) == f.Endpoint
+}
+
+func (f *Filter) matchesMetadata(serv openapi.Service) bool {
+	if len(f.Metadata) == 0 {
+		return true
+	}
+
+	key, value := "", f.Metadata
+	if i := strings.Index(f.Metadata, "="); i >= 0 {
+		key, value = f.Metadata[:i], f.Metadata[i+1:]
+	}
+
+	for _, m := range serv.Metadata {
+		if m.Value == value && (len(key) == 0 || m.Key == key) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,114 @@
+// Copyright © 2021 Cisco
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// All rights reserved.
+
+package history
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/audit"
+	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/internal/utils"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+// GetHistoryCommand returns the history command
+func GetHistoryCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     historyUse,
+		Short:   historyShort,
+		Long:    historyLong,
+		Example: historyExample,
+		Run: func(cmd *cobra.Command, _ []string) {
+			opts := utils.GetAuditOptionsFromFlags(cmd)
+			if opts == nil {
+				log.Fatal().Msg("no audit log provided, please set it with --audit-log")
+				return
+			}
+
+			filter, err := parseFlags(cmd, time.Now())
+			if err != nil {
+				log.Fatal().Err(err).Msg("error while parsing commands, check usage with --help")
+				return
+			}
+
+			records, err := audit.Read(opts.Path, filter)
+			if err != nil {
+				log.Fatal().Err(err).Msg("error while reading the audit log")
+				return
+			}
+
+			enc := json.NewEncoder(os.Stdout)
+			for _, rec := range records {
+				if err := enc.Encode(rec); err != nil {
+					log.Fatal().Err(err).Msg("error while writing records")
+					return
+				}
+			}
+		},
+	}
+
+	// Flags
+	cmd.Flags().String("endpoint", "", "only show events about this endpoint, i.e. its ID or address:port")
+	cmd.Flags().String("metadata", "", "only show events about endpoints with this metadata value, or key=value")
+	cmd.Flags().String("since", "", "only show batches sent after this time, as RFC3339 or as a duration to look back from now, e.g. 1h")
+	cmd.Flags().String("until", "", "only show batches sent before this time, as RFC3339 or as a duration to look back from now, e.g. 30m")
+
+	return cmd
+}
+
+func parseFlags(cmd *cobra.Command, now time.Time) (*audit.Filter, error) {
+	filter := &audit.Filter{}
+	filter.Endpoint, _ = cmd.Flags().GetString("endpoint")
+	filter.Metadata, _ = cmd.Flags().GetString("metadata")
+
+	since, _ := cmd.Flags().GetString("since")
+	until, _ := cmd.Flags().GetString("until")
+
+	var err error
+	if filter.Since, err = parseTime(since, now); err != nil {
+		return nil, fmt.Errorf("invalid --since: %w", err)
+	}
+	if filter.Until, err = parseTime(until, now); err != nil {
+		return nil, fmt.Errorf("invalid --until: %w", err)
+	}
+
+	return filter, nil
+}
+
+// parseTime parses value as an RFC3339 time or as a duration before now.
+// An empty value returns the zero time.
+func parseTime(value string, now time.Time) (time.Time, error) {
+	if len(value) == 0 {
+		return time.Time{}, nil
+	}
+
+	if ago, err := time.ParseDuration(value); err == nil {
+		return now.Add(-ago), nil
+	}
+
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%s is neither an RFC3339 time nor a duration", value)
+	}
+
+	return t, nil
+}
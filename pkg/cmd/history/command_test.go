@@ -0,0 +1,75 @@
+// Copyright © 2021 Cisco
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// All rights reserved.
+
+package history
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/audit"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseFlags(t *testing.T) {
+	a := assert.New(t)
+	now := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	cases := []struct {
+		args   []string
+		expRes *audit.Filter
+		expErr error
+	}{
+		{
+			expRes: &audit.Filter{},
+		},
+		{
+			args:   []string{"--endpoint=ns/serv/endp", "--metadata=traffic-profile=video"},
+			expRes: &audit.Filter{Endpoint: "ns/serv/endp", Metadata: "traffic-profile=video"},
+		},
+		{
+			args: []string{"--since=2h", "--until=2021-06-01T11:30:00Z"},
+			expRes: &audit.Filter{
+				Since: time.Date(2021, 6, 1, 10, 0, 0, 0, time.UTC),
+				Until: time.Date(2021, 6, 1, 11, 30, 0, 0, time.UTC),
+			},
+		},
+		{
+			args:   []string{"--since=yesterday"},
+			expErr: fmt.Errorf("invalid --since: %w", fmt.Errorf("yesterday is neither an RFC3339 time nor a duration")),
+		},
+		{
+			args:   []string{"--until=2021-06-01"},
+			expErr: fmt.Errorf("invalid --until: %w", fmt.Errorf("2021-06-01 is neither an RFC3339 time nor a duration")),
+		},
+	}
+
+	failed := func(i int) {
+		a.FailNow("case failed", fmt.Sprintf("case %d", i))
+	}
+	for i, currCase := range cases {
+		cmd := GetHistoryCommand()
+		cmd.Flags().Parse(currCase.args)
+
+		res, err := parseFlags(cmd, now)
+		if !a.Equal(currCase.expErr, err) || !a.Equal(currCase.expRes, res) {
+			failed(i)
+		}
+	}
+}
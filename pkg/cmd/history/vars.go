@@ -0,0 +1,34 @@
+// Copyright © 2021 Cisco
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// All rights reserved.
+
+package history
+
+const (
+	historyUse   string = "history [--endpoint <endpoint>] [--metadata <value>] [--since <time>] [--until <time>]"
+	historyShort string = "show the events that were sent to the adaptors"
+	historyLong  string = `history reads the audit log written while running
+with --audit-log and prints the batches of events sent to the adaptors, as one
+JSON object per line, along with the status code and the errors returned by
+the adaptors, from the oldest to the newest.
+
+Batches can be filtered by endpoint, i.e. its name or its address and port,
+by the value of a metadata, with value or key=value, and by time, with
+either an RFC3339 time or a duration to look back from now, e.g. 1h.
+Only the events that match are included in each batch.`
+	historyExample string = "history --audit-log /var/log/cnwan-reader/audit.log --metadata traffic-profile=video --since 1h"
+)
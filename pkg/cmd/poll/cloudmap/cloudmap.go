@@ -26,10 +26,12 @@ import (
 	"sync"
 	"time"
 
+	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/internal/utils"
 	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/openapi"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/servicediscovery"
 	"github.com/aws/aws-sdk-go/service/servicediscovery/servicediscoveryiface"
+	"github.com/rs/zerolog/log"
 )
 
 const (
@@ -43,10 +45,36 @@ const (
 type awsCloudMap struct {
 	opts *options
 	sd   servicediscoveryiface.ServiceDiscoveryAPI
+	// withTags looks for the metadata in the tags of the services rather
+	// than in the attributes of the instances
+	withTags bool
+}
+
+// cloudMapService contains the data of a Cloud Map service that is needed
+// to get and identify its instances.
+type cloudMapService struct {
+	id     string
+	arn    string
+	name   string
+	nsName string
+}
+
+// Name returns the name of the service registry.
+func (a *awsCloudMap) Name() string {
+	return sourceName
+}
+
+// State returns the instances that are currently registered.
+func (a *awsCloudMap) State(ctx context.Context) (map[string]*openapi.Service, error) {
+	if a.withTags {
+		return a.getServiceTags(ctx)
+	}
+
+	return a.getCurrentState(ctx)
 }
 
 func (a *awsCloudMap) getServiceTags(ctx context.Context) (map[string]*openapi.Service, error) {
-	out, err := a.sd.ListServicesWithContext(ctx, &servicediscovery.ListServicesInput{})
+	srvs, err := a.getServices(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -57,15 +85,15 @@ func (a *awsCloudMap) getServiceTags(ctx context.Context) (map[string]*openapi.S
 	}
 
 	servTags := map[string]*openapi.Service{}
-	for _, srv := range out.Services {
-		l := log.With().Str("service-name", aws.StringValue(srv.Name)).Logger()
+	for _, srv := range srvs {
+		l := log.With().Str("service-name", srv.name).Logger()
 
 		metadata := func() map[string]string {
 			tagsCtx, tagsCanc := context.WithTimeout(ctx, 30*time.Second)
 			defer tagsCanc()
 
 			out, err := a.sd.ListTagsForResourceWithContext(tagsCtx, &servicediscovery.ListTagsForResourceInput{
-				ResourceARN: srv.Arn,
+				ResourceARN: aws.String(srv.arn),
 			})
 			if err != nil {
 				l.Warn().Err(err).Msg("could not get tags for service: skipping...")
@@ -90,7 +118,7 @@ func (a *awsCloudMap) getServiceTags(ctx context.Context) (map[string]*openapi.S
 			defer instCanc()
 
 			insts, err := a.sd.ListInstancesWithContext(instCtx, &servicediscovery.ListInstancesInput{
-				ServiceId: srv.Id,
+				ServiceId: aws.String(srv.id),
 			})
 			if err != nil {
 				return nil, err
@@ -115,11 +143,15 @@ func (a *awsCloudMap) getServiceTags(ctx context.Context) (map[string]*openapi.S
 		}
 
 		for _, endp := range endps {
-			name := path.Join(aws.StringValue(srv.Name), endp.Name)
-			servTags[name] = &openapi.Service{
-				Name:    name,
-				Address: endp.Address,
-				Port:    endp.Port,
+			id := utils.EndpointID(srv.nsName, srv.name, endp.Name)
+			servTags[id] = &openapi.Service{
+				Id:        id,
+				Name:      path.Join(srv.name, endp.Name),
+				Address:   endp.Address,
+				Port:      endp.Port,
+				Namespace: srv.nsName,
+				Service:   srv.name,
+				Source:    sourceName,
 				Metadata: func() (met []openapi.Metadata) {
 					for k, v := range metadata {
 						met = append(met, openapi.Metadata{Key: k, Value: v})
@@ -135,76 +167,100 @@ func (a *awsCloudMap) getServiceTags(ctx context.Context) (map[string]*openapi.S
 
 func (a *awsCloudMap) getCurrentState(ctx context.Context) (map[string]*openapi.Service, error) {
 	srvCtx, srvCanc := context.WithTimeout(ctx, defaultTimeout)
-	srvIDs, err := a.getServicesIDs(srvCtx)
+	srvs, err := a.getServices(srvCtx)
 	if err != nil {
 		srvCanc()
 		return nil, err
 	}
 	srvCanc()
 
-	if len(srvIDs) == 0 {
+	if len(srvs) == 0 {
 		return map[string]*openapi.Service{}, nil
 	}
 
 	var wg sync.WaitGroup
-	wg.Add(len(srvIDs))
+	wg.Add(len(srvs))
 	var locker sync.Mutex
 	oaSrvs := map[string]*openapi.Service{}
 
-	for _, srvID := range srvIDs {
-		go func(id string) {
+	for _, srv := range srvs {
+		go func(srv *cloudMapService) {
 			defer wg.Done()
 			instCtx, instCanc := context.WithTimeout(ctx, defaultTimeout)
 			defer instCanc()
 
-			insts, err := a.getInstances(instCtx, id)
+			insts, err := a.getInstances(instCtx, srv)
 			if err != nil {
-				log.Err(err).Str("serv-id", id).Msg("could not get instances for this service, skipping...")
+				log.Err(err).Str("serv-id", srv.id).Msg("could not get instances for this service, skipping...")
 				return
 			}
 
 			locker.Lock()
 			defer locker.Unlock()
 			for i := 0; i < len(insts); i++ {
-				oaID := fmt.Sprintf("services/%s/endpoints/%s", id, insts[i].Name)
-				oaSrvs[oaID] = insts[i]
+				oaSrvs[insts[i].Id] = insts[i]
 			}
-		}(srvID)
+		}(srv)
 	}
 	wg.Wait()
 
 	return oaSrvs, nil
 }
 
-func (a *awsCloudMap) getServicesIDs(ctx context.Context) ([]string, error) {
-	out, err := a.sd.ListServicesWithContext(ctx, &servicediscovery.ListServicesInput{})
+func (a *awsCloudMap) getServices(ctx context.Context) ([]*cloudMapService, error) {
+	nsOut, err := a.sd.ListNamespacesWithContext(ctx, &servicediscovery.ListNamespacesInput{})
 	if err != nil {
 		return nil, err
 	}
 
-	servIDs := []string{}
-	for _, service := range out.Services {
-		if service.Id != nil && len(*service.Id) > 0 {
-			servIDs = append(servIDs, *service.Id)
-		} else {
-			log.Debug().Msg("found service with no/empty ID has been found: skipping...")
+	servs := []*cloudMapService{}
+	for _, ns := range nsOut.Namespaces {
+		if ns.Id == nil || len(*ns.Id) == 0 {
+			log.Debug().Msg("found namespace with no/empty ID: skipping...")
+			continue
+		}
+
+		out, err := a.sd.ListServicesWithContext(ctx, &servicediscovery.ListServicesInput{
+			Filters: []*servicediscovery.ServiceFilter{
+				{
+					Name:      aws.String(servicediscovery.ServiceFilterNameNamespaceId),
+					Condition: aws.String(servicediscovery.FilterConditionEq),
+					Values:    []*string{ns.Id},
+				},
+			},
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		for _, service := range out.Services {
+			if service.Id != nil && len(*service.Id) > 0 {
+				servs = append(servs, &cloudMapService{
+					id:     *service.Id,
+					arn:    aws.StringValue(service.Arn),
+					name:   aws.StringValue(service.Name),
+					nsName: aws.StringValue(ns.Name),
+				})
+			} else {
+				log.Debug().Msg("found service with no/empty ID has been found: skipping...")
+			}
 		}
 	}
 
-	return servIDs, nil
+	return servs, nil
 }
 
-func (a *awsCloudMap) getInstances(ctx context.Context, servID string) ([]*openapi.Service, error) {
-	out, err := a.sd.ListInstancesWithContext(ctx, &servicediscovery.ListInstancesInput{ServiceId: &servID})
+func (a *awsCloudMap) getInstances(ctx context.Context, srv *cloudMapService) ([]*openapi.Service, error) {
+	out, err := a.sd.ListInstancesWithContext(ctx, &servicediscovery.ListInstancesInput{ServiceId: aws.String(srv.id)})
 	if err != nil {
 		return nil, err
 	}
 
 	oaSrvs := []*openapi.Service{}
 	for _, inst := range out.Instances {
-		oaSrv, err := a.parseInstance(servID, inst)
+		oaSrv, err := a.parseInstance(srv, inst)
 		if err != nil {
-			log.Debug().Err(err).Str("service-id", servID).Msg("invalid instance: skipping...")
+			log.Debug().Err(err).Str("service-id", srv.id).Msg("invalid instance: skipping...")
 			continue
 		}
 
@@ -214,7 +270,7 @@ func (a *awsCloudMap) getInstances(ctx context.Context, servID string) ([]*opena
 	return oaSrvs, nil
 }
 
-func (a *awsCloudMap) parseInstance(servID string, inst *servicediscovery.InstanceSummary) (*openapi.Service, error) {
+func (a *awsCloudMap) parseInstance(srv *cloudMapService, inst *servicediscovery.InstanceSummary) (*openapi.Service, error) {
 	if inst.Id == nil || (inst.Id != nil && len(*inst.Id) == 0) {
 		return nil, fmt.Errorf("found instance with no/empty ID")
 	}
@@ -256,10 +312,14 @@ func (a *awsCloudMap) parseInstance(servID string, inst *servicediscovery.Instan
 		}
 	}
 
-	srv := &openapi.Service{
-		Name:    *inst.Id,
-		Address: address,
-		Port:    port,
+	oaSrv := &openapi.Service{
+		Id:        utils.EndpointID(srv.nsName, srv.name, *inst.Id),
+		Name:      *inst.Id,
+		Address:   address,
+		Port:      port,
+		Namespace: srv.nsName,
+		Service:   srv.name,
+		Source:    sourceName,
 		Metadata: func() []openapi.Metadata {
 			met := []openapi.Metadata{}
 			for key, val := range metadata {
@@ -269,5 +329,5 @@ func (a *awsCloudMap) parseInstance(servID string, inst *servicediscovery.Instan
 		}(),
 	}
 
-	return srv, nil
+	return oaSrv, nil
 }
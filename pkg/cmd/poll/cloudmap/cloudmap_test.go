@@ -30,30 +30,61 @@ import (
 	"github.com/stretchr/testify/assert"
 )
 
-func TestGetServicesIDs(t *testing.T) {
+func TestGetServices(t *testing.T) {
 	a := assert.New(t)
+	nsID := "ns-id"
+	nsName := "ns"
+	listNs := func(ctx aws.Context, input *servicediscovery.ListNamespacesInput, opts ...request.Option) (*servicediscovery.ListNamespacesOutput, error) {
+		return &servicediscovery.ListNamespacesOutput{
+			Namespaces: []*servicediscovery.NamespaceSummary{
+				{Id: &nsID, Name: &nsName},
+			},
+		}, nil
+	}
 
 	cases := []struct {
+		listNs    func(ctx aws.Context, input *servicediscovery.ListNamespacesInput, opts ...request.Option) (*servicediscovery.ListNamespacesOutput, error)
 		listServs func(ctx aws.Context, input *servicediscovery.ListServicesInput, opts ...request.Option) (*servicediscovery.ListServicesOutput, error)
 
-		expRes []string
+		expRes []*cloudMapService
 		expErr error
 	}{
 		{
+			listNs: func(ctx aws.Context, input *servicediscovery.ListNamespacesInput, opts ...request.Option) (*servicediscovery.ListNamespacesOutput, error) {
+				return nil, fmt.Errorf("any error")
+			},
+			expErr: fmt.Errorf("any error"),
+		},
+		{
+			listNs: func(ctx aws.Context, input *servicediscovery.ListNamespacesInput, opts ...request.Option) (*servicediscovery.ListNamespacesOutput, error) {
+				empty := ""
+				return &servicediscovery.ListNamespacesOutput{
+					Namespaces: []*servicediscovery.NamespaceSummary{
+						{},
+						{Id: &empty},
+					},
+				}, nil
+			},
+			expRes: []*cloudMapService{},
+		},
+		{
+			listNs: listNs,
 			listServs: func(ctx aws.Context, input *servicediscovery.ListServicesInput, opts ...request.Option) (*servicediscovery.ListServicesOutput, error) {
 				return nil, fmt.Errorf("any error")
 			},
 			expErr: fmt.Errorf("any error"),
 		},
 		{
+			listNs: listNs,
 			listServs: func(ctx aws.Context, input *servicediscovery.ListServicesInput, opts ...request.Option) (*servicediscovery.ListServicesOutput, error) {
 				return &servicediscovery.ListServicesOutput{
 					Services: []*servicediscovery.ServiceSummary{},
 				}, nil
 			},
-			expRes: []string{},
+			expRes: []*cloudMapService{},
 		},
 		{
+			listNs: listNs,
 			listServs: func(ctx aws.Context, input *servicediscovery.ListServicesInput, opts ...request.Option) (*servicediscovery.ListServicesOutput, error) {
 				id := ""
 				return &servicediscovery.ListServicesOutput{
@@ -64,20 +95,28 @@ func TestGetServicesIDs(t *testing.T) {
 					},
 				}, nil
 			},
-			expRes: []string{},
+			expRes: []*cloudMapService{},
 		},
 		{
+			listNs: listNs,
 			listServs: func(ctx aws.Context, input *servicediscovery.ListServicesInput, opts ...request.Option) (*servicediscovery.ListServicesOutput, error) {
-				id := "whatever"
-				id1 := "whatever1"
+				if len(input.Filters) != 1 || aws.StringValue(input.Filters[0].Values[0]) != nsID {
+					return nil, fmt.Errorf("wrong filter")
+				}
+
+				id, name := "whatever", "srv"
+				id1, name1 := "whatever1", "srv1"
 				return &servicediscovery.ListServicesOutput{
 					Services: []*servicediscovery.ServiceSummary{
-						{Id: &id},
-						{Id: &id1},
+						{Id: &id, Name: &name},
+						{Id: &id1, Name: &name1},
 					},
 				}, nil
 			},
-			expRes: []string{"whatever", "whatever1"},
+			expRes: []*cloudMapService{
+				{id: "whatever", name: "srv", nsName: nsName},
+				{id: "whatever1", name: "srv1", nsName: nsName},
+			},
 		},
 	}
 
@@ -87,10 +126,11 @@ func TestGetServicesIDs(t *testing.T) {
 	for i, currCase := range cases {
 		cm := &awsCloudMap{
 			sd: &fakeSD{
-				_listServices: currCase.listServs,
+				_listNamespaces: currCase.listNs,
+				_listServices:   currCase.listServs,
 			},
 		}
-		res, err := cm.getServicesIDs(context.Background())
+		res, err := cm.getServices(context.Background())
 		if !a.Equal(currCase.expRes, res) || !a.Equal(currCase.expErr, err) {
 			failed(i)
 		}
@@ -105,6 +145,7 @@ func TestGetInstances(t *testing.T) {
 	ip4 := "10.10.10.10"
 	ip6 := "2001:db8:a0b:12f0::1"
 	port := int32(8989)
+	srv := &cloudMapService{id: "srv-id", name: "srv", nsName: "ns"}
 	cases := []struct {
 		listInst func(ctx aws.Context, input *servicediscovery.ListInstancesInput, opts ...request.Option) (*servicediscovery.ListInstancesOutput, error)
 
@@ -157,16 +198,24 @@ func TestGetInstances(t *testing.T) {
 			},
 			expRes: []*openapi.Service{
 				{
-					Name:     instID1,
-					Address:  ip6,
-					Port:     port,
-					Metadata: []openapi.Metadata{{Key: "yes", Value: instID1}},
+					Id:        "ns/srv/" + instID1,
+					Name:      instID1,
+					Address:   ip6,
+					Port:      port,
+					Namespace: "ns",
+					Service:   "srv",
+					Source:    sourceName,
+					Metadata:  []openapi.Metadata{{Key: "yes", Value: instID1}},
 				},
 				{
-					Name:     instID2,
-					Address:  ip4,
-					Port:     int32(80),
-					Metadata: []openapi.Metadata{{Key: "yes", Value: instID2}},
+					Id:        "ns/srv/" + instID2,
+					Name:      instID2,
+					Address:   ip4,
+					Port:      int32(80),
+					Namespace: "ns",
+					Service:   "srv",
+					Source:    sourceName,
+					Metadata:  []openapi.Metadata{{Key: "yes", Value: instID2}},
 				},
 			},
 		},
@@ -184,7 +233,7 @@ func TestGetInstances(t *testing.T) {
 				keys: []string{"yes"},
 			},
 		}
-		res, err := cm.getInstances(context.Background(), "whatever")
+		res, err := cm.getInstances(context.Background(), srv)
 		if !a.Equal(currCase.expRes, res) || !a.Equal(currCase.expErr, err) {
 			failed(i)
 		}
@@ -199,6 +248,7 @@ func TestParseInstance(t *testing.T) {
 	}
 	a := assert.New(t)
 	srvID := "srv-id"
+	srv := &cloudMapService{id: srvID, name: "srv", nsName: "ns"}
 	instID := "inst-id"
 	empty := ""
 	ip4 := "10.10.10.10"
@@ -276,10 +326,14 @@ func TestParseInstance(t *testing.T) {
 			}(),
 			expRes: func() *openapi.Service {
 				return &openapi.Service{
-					Name:     instID,
-					Address:  ip4,
-					Port:     awsDefaultInstancePort,
-					Metadata: []openapi.Metadata{{Key: "yes", Value: srvID}},
+					Id:        "ns/srv/" + instID,
+					Namespace: "ns",
+					Service:   "srv",
+					Source:    sourceName,
+					Name:      instID,
+					Address:   ip4,
+					Port:      awsDefaultInstancePort,
+					Metadata:  []openapi.Metadata{{Key: "yes", Value: srvID}},
 				}
 			}(),
 		},
@@ -296,10 +350,14 @@ func TestParseInstance(t *testing.T) {
 			}(),
 			expRes: func() *openapi.Service {
 				return &openapi.Service{
-					Name:     instID,
-					Address:  ip6,
-					Port:     awsDefaultInstancePort,
-					Metadata: []openapi.Metadata{{Key: "yes", Value: srvID}},
+					Id:        "ns/srv/" + instID,
+					Namespace: "ns",
+					Service:   "srv",
+					Source:    sourceName,
+					Name:      instID,
+					Address:   ip6,
+					Port:      awsDefaultInstancePort,
+					Metadata:  []openapi.Metadata{{Key: "yes", Value: srvID}},
 				}
 			}(),
 		},
@@ -320,10 +378,14 @@ func TestParseInstance(t *testing.T) {
 			}(),
 			expRes: func() *openapi.Service {
 				return &openapi.Service{
-					Name:     instID,
-					Address:  ip6,
-					Port:     port,
-					Metadata: []openapi.Metadata{{Key: "yes", Value: srvID}},
+					Id:        "ns/srv/" + instID,
+					Namespace: "ns",
+					Service:   "srv",
+					Source:    sourceName,
+					Name:      instID,
+					Address:   ip6,
+					Port:      port,
+					Metadata:  []openapi.Metadata{{Key: "yes", Value: srvID}},
 				}
 			}(),
 		},
@@ -333,7 +395,7 @@ func TestParseInstance(t *testing.T) {
 		a.FailNow("case failed", fmt.Sprintf("case %d", i))
 	}
 	for i, currCase := range cases {
-		res, err := cm.parseInstance(srvID, currCase.inst)
+		res, err := cm.parseInstance(srv, currCase.inst)
 		if !a.Equal(currCase.expRes, res) || !a.Equal(currCase.expErr, err) {
 			failed(i)
 		}
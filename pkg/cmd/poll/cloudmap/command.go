@@ -25,26 +25,19 @@ import (
 	"os/signal"
 
 	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/configuration"
-	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/openapi"
-	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/poller"
-	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/queue"
-	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/services"
+	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/election"
+	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/health"
+	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/internal/utils"
+	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/metrics"
+	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/reader"
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/servicediscovery"
-	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
 	"github.com/spf13/cobra"
 )
 
-var (
-	log zerolog.Logger
-)
-
-func init() {
-	output := zerolog.ConsoleWriter{Out: os.Stdout}
-	log = zerolog.New(output).With().Timestamp().Logger().Level(zerolog.InfoLevel)
-}
-
 // GetCloudMapCommand returns the cloudmap command
 //
 // TODO: on next version this will probably be changed and adopt some
@@ -65,28 +58,13 @@ func GetCloudMapCommand() *cobra.Command {
 				return
 			}
 
-			if len(opts.credsPath) > 0 {
-				os.Setenv("AWS_SHARED_CREDENTIALS_FILE", opts.credsPath)
-			}
-
-			if opts.debug {
-				log = log.Level(zerolog.DebugLevel)
-			}
-
-			sess, err := session.NewSession()
-			if err != nil {
+			if cm, err = newAWSCloudMap(opts, withTags); err != nil {
 				log.Fatal().Err(err).Msg("could not start AWS session")
 				return
 			}
-			sd := servicediscovery.New(sess, aws.NewConfig().WithRegion(opts.region))
-
-			cm = &awsCloudMap{
-				opts: opts,
-				sd:   sd,
-			}
 		},
 		Run: func(cmd *cobra.Command, args []string) {
-			run(cm, withTags)
+			run(cm)
 		},
 	}
 
@@ -99,71 +77,85 @@ func GetCloudMapCommand() *cobra.Command {
 	return cmd
 }
 
-func run(cm *awsCloudMap, withTags bool) {
-	log.Info().Str("service-registry", "Cloud Map").Str("adaptor", cm.opts.adaptor).Msg("starting...")
-	if withTags {
-		log.Info().Msg("switching to tag parsing...")
+// NewSource returns a source that polls Cloud Map, with the settings
+// defined by the flags of cmd and by conf, along with the number of seconds
+// between two consecutive polls.
+func NewSource(cmd *cobra.Command, conf *configuration.Config) (reader.Source, int, error) {
+	opts, err := parseFlags(cmd, conf)
+	if err != nil {
+		return nil, 0, err
 	}
 
-	ctx, canc := context.WithCancel(context.Background())
-
-	datastore := services.NewDatastore()
-	servsHandler, err := services.NewHandler(ctx, cm.opts.adaptor)
+	cm, err := newAWSCloudMap(opts, false)
 	if err != nil {
-		log.Fatal().Err(err).Msg("error while trying to connect to aws cloud map")
+		return nil, 0, fmt.Errorf("could not start AWS session: %w", err)
 	}
-	sendQueue := queue.New(ctx, servsHandler)
 
-	go func() {
-		log.Info().Msg("getting initial state...")
-		var (
-			oaSrvs map[string]*openapi.Service
-			err    error
-		)
-
-		if !withTags {
-			oaSrvs, err = cm.getCurrentState(ctx)
-		} else {
-			oaSrvs, err = cm.getServiceTags(ctx)
-		}
+	return cm, opts.interval, nil
+}
 
-		if err != nil {
-			log.Fatal().Err(err).Msg("error while getting initial state of cloud map")
-			return
-		}
+func newAWSCloudMap(opts *options, withTags bool) (*awsCloudMap, error) {
+	if len(opts.credsPath) > 0 {
+		os.Setenv("AWS_SHARED_CREDENTIALS_FILE", opts.credsPath)
+	}
 
-		log.Info().Msg("done")
-		if filtered := datastore.GetEvents(oaSrvs); len(filtered) > 0 {
-			go sendQueue.Enqueue(filtered)
+	sess, err := session.NewSession()
+	if err != nil {
+		return nil, err
+	}
+	sd := servicediscovery.New(sess, aws.NewConfig().WithRegion(opts.region))
+	sd.Handlers.Complete.PushBack(func(r *request.Request) {
+		if r.Error != nil {
+			metrics.RegistryErrors.WithLabelValues(sourceName).Inc()
 		}
+	})
 
-		// Get the poller
-		log.Info().Msg("observing changes...")
-		poll := poller.New(ctx, cm.opts.interval)
-		poll.SetPollFunction(func() {
-			var (
-				oaSrvs map[string]*openapi.Service
-				err    error
-			)
-
-			if !withTags {
-				oaSrvs, err = cm.getCurrentState(ctx)
-			} else {
-				oaSrvs, err = cm.getServiceTags(ctx)
-			}
+	return &awsCloudMap{
+		opts:     opts,
+		sd:       sd,
+		withTags: withTags,
+	}, nil
+}
 
-			if err != nil {
-				log.Err(err).Msg("error while polling, skipping...")
-				return
-			}
+func run(cm *awsCloudMap) {
+	log.Info().Str("service-registry", "Cloud Map").Int("adaptors", len(cm.opts.adaptors)).Msg("starting...")
+	if cm.withTags {
+		log.Info().Msg("switching to tag parsing...")
+	}
 
-			if filtered := datastore.GetEvents(oaSrvs); len(filtered) > 0 {
-				log.Info().Msg("changes detected")
-				go sendQueue.Enqueue(filtered)
-			}
-		})
+	ctx, canc := context.WithCancel(context.Background())
+
+	checker := health.New()
+	serverTarget, err := utils.StartServer(ctx, cm.opts.server, checker)
+	if err != nil {
+		log.Fatal().Err(err).Msg("error while starting the server")
+	}
 
-		poll.Start()
+	auditLog, err := utils.OpenAuditLog(cm.opts.audit)
+	if err != nil {
+		log.Fatal().Err(err).Msg("error while opening the audit log")
+	}
+
+	pipelineOpts := &reader.Options{
+		PollInterval:   cm.opts.interval,
+		ResyncInterval: cm.opts.resync,
+		Checker:        checker,
+	}
+	if cm.opts.election != nil {
+		if pipelineOpts.Elector, err = election.New(cm.opts.election, nil); err != nil {
+			log.Fatal().Err(err).Msg("error while setting up leader election")
+		}
+	}
+
+	pipeline := reader.New(cm, pipelineOpts)
+	if err := utils.AddAdaptorSinks(pipeline, cm.opts.adaptors, auditLog, serverTarget); err != nil {
+		log.Fatal().Err(err).Msg("error while trying to connect to the adaptors")
+	}
+
+	go func() {
+		if err := pipeline.Run(ctx); err != nil {
+			log.Fatal().Err(err).Msg("error while observing cloud map")
+		}
 	}()
 
 	// Graceful shutdown
@@ -28,8 +28,13 @@ import (
 type fakeSD struct {
 	servicediscoveryiface.ServiceDiscoveryAPI
 
-	_listServices  func(ctx aws.Context, input *servicediscovery.ListServicesInput, opts ...request.Option) (*servicediscovery.ListServicesOutput, error)
-	_listInstances func(aws.Context, *servicediscovery.ListInstancesInput, ...request.Option) (*servicediscovery.ListInstancesOutput, error)
+	_listNamespaces func(ctx aws.Context, input *servicediscovery.ListNamespacesInput, opts ...request.Option) (*servicediscovery.ListNamespacesOutput, error)
+	_listServices   func(ctx aws.Context, input *servicediscovery.ListServicesInput, opts ...request.Option) (*servicediscovery.ListServicesOutput, error)
+	_listInstances  func(aws.Context, *servicediscovery.ListInstancesInput, ...request.Option) (*servicediscovery.ListInstancesOutput, error)
+}
+
+func (f *fakeSD) ListNamespacesWithContext(ctx aws.Context, input *servicediscovery.ListNamespacesInput, opts ...request.Option) (*servicediscovery.ListNamespacesOutput, error) {
+	return f._listNamespaces(ctx, input, opts...)
 }
 
 func (f *fakeSD) ListServicesWithContext(ctx aws.Context, input *servicediscovery.ListServicesInput, opts ...request.Option) (*servicediscovery.ListServicesOutput, error) {
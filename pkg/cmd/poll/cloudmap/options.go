@@ -18,11 +18,20 @@
 
 package cloudmap
 
+import (
+	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/audit"
+	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/election"
+	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/internal/utils"
+)
+
 type options struct {
 	region    string
 	credsPath string
 	interval  int
-	adaptor   string
-	debug     bool
+	adaptors  []*utils.AdaptorOptions
+	server    *utils.ServerOptions
+	audit     *audit.Options
+	election  *election.Options
+	resync    int
 	keys      []string
 }
@@ -75,12 +75,15 @@ func parseFlags(cmd *cobra.Command, conf *configuration.Config) (*options, error
 	}
 	opts.keys = keys
 
-	adaptor, err := utils.GetAdaptorEndpointFromFlags(cmd)
+	adaptors, err := utils.GetAdaptorsFromFlags(cmd)
 	if err != nil {
 		return nil, err
 	}
-	opts.adaptor = adaptor
-	opts.debug = utils.GetDebugModeFromFlags(cmd)
+	opts.adaptors = adaptors
+	opts.server = utils.GetServerOptionsFromFlags(cmd)
+	opts.audit = utils.GetAuditOptionsFromFlags(cmd)
+	opts.election = utils.GetLeaderElectionOptionsFromFlags(cmd)
+	opts.resync = utils.GetResyncIntervalFromFlags(cmd)
 
 	return opts, nil
 }
@@ -23,6 +23,8 @@ import (
 	"testing"
 
 	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/configuration"
+	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/internal/utils"
+	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/services"
 	"github.com/spf13/cobra"
 	"github.com/stretchr/testify/assert"
 )
@@ -74,8 +76,11 @@ func TestParseFlags(t *testing.T) {
 				region:   "whatever",
 				keys:     []string{"this"},
 				interval: 5,
-				adaptor:  "localhost:80/cnwan",
-				debug:    false,
+				adaptors: []*utils.AdaptorOptions{{
+					Name:     "localhost:80/cnwan",
+					Endpoint: "localhost:80/cnwan",
+					Handler:  &services.HandlerOptions{APIVersion: "v1", Format: "openapi", Headers: map[string]string{}},
+				}},
 			},
 		},
 		{
@@ -101,8 +106,11 @@ func TestParseFlags(t *testing.T) {
 				region:   "whatever",
 				keys:     []string{"this"},
 				interval: 5,
-				adaptor:  "localhost:80/cnwan",
-				debug:    false,
+				adaptors: []*utils.AdaptorOptions{{
+					Name:     "localhost:80/cnwan",
+					Endpoint: "localhost:80/cnwan",
+					Handler:  &services.HandlerOptions{APIVersion: "v1", Format: "openapi", Headers: map[string]string{}},
+				}},
 			},
 		},
 		{
@@ -130,8 +138,11 @@ func TestParseFlags(t *testing.T) {
 				keys:      []string{"that"},
 				credsPath: "path/to/file",
 				interval:  14,
-				adaptor:   "localhost:80/cnwan",
-				debug:     false,
+				adaptors: []*utils.AdaptorOptions{{
+					Name:     "localhost:80/cnwan",
+					Endpoint: "localhost:80/cnwan",
+					Handler:  &services.HandlerOptions{APIVersion: "v1", Format: "openapi", Headers: map[string]string{}},
+				}},
 			},
 		},
 		// {
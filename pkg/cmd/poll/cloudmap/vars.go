@@ -35,4 +35,5 @@ with environment variables. For a complete list of alternatives, please
 refer to AWS Session documentation, but, to keep things simple, we suggest you
 use the default one.`
 	cmdExample string = "cloudmap --region us-west-2 --credentials path/to/credentials/file"
+	sourceName string = "cloudmap"
 )
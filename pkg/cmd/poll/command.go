@@ -20,6 +20,7 @@ package poll
 
 import (
 	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/cmd/poll/cloudmap"
+	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/cmd/poll/servicedirectory"
 	"github.com/spf13/cobra"
 )
 
@@ -40,8 +41,8 @@ func GetPollCommand() *cobra.Command {
 	cmd.Flags().Int("poll-interval", 5, "interval between two consecutive polls")
 
 	// Subcommands
-	// TODO: service directory will be inserted here as well
 	cmd.AddCommand(cloudmap.GetCloudMapCommand())
+	cmd.AddCommand(servicedirectory.GetServiceDirectoryCommand())
 
 	return cmd
 }
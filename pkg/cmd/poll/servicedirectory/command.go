@@ -0,0 +1,151 @@
+// Copyright © 2021 Cisco
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// All rights reserved.
+
+package servicedirectory
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+
+	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/configuration"
+	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/election"
+	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/health"
+	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/internal/utils"
+	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/reader"
+	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/sdhandler"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+// GetServiceDirectoryCommand returns the servicedirectory command
+func GetServiceDirectoryCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     cmdUse,
+		Short:   cmdShort,
+		Long:    cmdLong,
+		Example: cmdExample,
+		Aliases: []string{"sd", "gcloud", "gcsd"},
+		Run: func(cmd *cobra.Command, _ []string) {
+			opts, err := parseFlags(cmd, configuration.GetConfigFile())
+			if err != nil {
+				cmd.Usage()
+				log.Fatal().Err(err).Msg("error while parsing commands, check usage with --help")
+				return
+			}
+
+			run(opts)
+		},
+	}
+
+	// Flags
+	cmd.Flags().String("project", "", "gcloud project name")
+	cmd.Flags().String("region", "", "gcloud region location. Example: us-west2")
+	cmd.Flags().String("service-account", "", "path to the gcloud service account. Example: ./service-account.json")
+	cmd.Flags().StringSlice("metadata-keys", []string{}, "the metadata keys to watch for")
+	cmd.Flags().String("metadata-key", "", "name of the metadata key to look for. Same as --metadata-keys with a single key")
+
+	return cmd
+}
+
+// NewSource returns a source that polls Service Directory, with the settings
+// defined by the flags of cmd and by conf, along with the number of seconds
+// between two consecutive polls.
+func NewSource(ctx context.Context, cmd *cobra.Command, conf *configuration.Config) (reader.Source, int, error) {
+	opts, err := parseFlags(cmd, conf)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	sd, err := sdhandler.New(ctx, opts.region, opts.keys[0], opts.project, opts.servAccount)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return sd, opts.interval, nil
+}
+
+func run(opts *options) {
+	log.Info().Str("service-registry", "Service Directory").Int("adaptors", len(opts.adaptors)).Msg("starting...")
+
+	ctx, canc := context.WithCancel(context.Background())
+	defer canc()
+
+	sd, err := sdhandler.New(ctx, opts.region, opts.keys[0], opts.project, opts.servAccount)
+	if err != nil {
+		log.Fatal().Err(err).Msg("error while trying to connect to service directory")
+		return
+	}
+
+	checker := health.New()
+	serverTarget, err := utils.StartServer(ctx, opts.server, checker)
+	if err != nil {
+		log.Fatal().Err(err).Msg("error while starting the server")
+		return
+	}
+
+	auditLog, err := utils.OpenAuditLog(opts.audit)
+	if err != nil {
+		log.Fatal().Err(err).Msg("error while opening the audit log")
+		return
+	}
+
+	pipelineOpts := &reader.Options{
+		PollInterval:   opts.interval,
+		ResyncInterval: opts.resync,
+		Checker:        checker,
+	}
+	if opts.election != nil {
+		if pipelineOpts.Elector, err = election.New(opts.election, nil); err != nil {
+			log.Fatal().Err(err).Msg("error while setting up leader election")
+			return
+		}
+	}
+
+	pipeline := reader.New(sd, pipelineOpts)
+	if err := utils.AddAdaptorSinks(pipeline, opts.adaptors, auditLog, serverTarget); err != nil {
+		log.Fatal().Err(err).Msg("error while trying to connect to the adaptors")
+		return
+	}
+
+	exitChan := make(chan error, 1)
+	go func() {
+		exitChan <- pipeline.Run(ctx)
+	}()
+
+	// Graceful shutdown
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt)
+
+	select {
+	case <-sig:
+		fmt.Println()
+		log.Info().Msg("exit requested")
+
+		// Cancel the context and wait for objects that use it to receive
+		// the stop command
+		canc()
+		<-exitChan
+	case err := <-exitChan:
+		log.Err(err).Msg("error while observing service directory")
+		return
+	}
+
+	log.Info().Msg("good bye!")
+}
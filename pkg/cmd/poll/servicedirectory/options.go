@@ -0,0 +1,38 @@
+// Copyright © 2021 Cisco
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// All rights reserved.
+
+package servicedirectory
+
+import (
+	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/audit"
+	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/election"
+	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/internal/utils"
+)
+
+type options struct {
+	project     string
+	region      string
+	servAccount string
+	interval    int
+	adaptors    []*utils.AdaptorOptions
+	server      *utils.ServerOptions
+	audit       *audit.Options
+	election    *election.Options
+	resync      int
+	keys        []string
+}
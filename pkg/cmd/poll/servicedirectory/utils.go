@@ -0,0 +1,92 @@
+// Copyright © 2021 Cisco
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// All rights reserved.
+
+package servicedirectory
+
+import (
+	"fmt"
+
+	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/configuration"
+	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/internal/utils"
+	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/reader"
+	"github.com/spf13/cobra"
+)
+
+func parseFlags(cmd *cobra.Command, conf *configuration.Config) (*options, error) {
+	opts := &options{}
+
+	sdConf := &configuration.ServiceDirectoryConfig{}
+	if conf != nil && conf.ServiceRegistry != nil && conf.ServiceRegistry.GCPServiceDirectory != nil {
+		sdConf = conf.ServiceRegistry.GCPServiceDirectory
+	}
+
+	for flag, field := range map[string]struct {
+		dst  *string
+		conf string
+	}{
+		"project":         {&opts.project, sdConf.ProjectID},
+		"region":          {&opts.region, sdConf.Region},
+		"service-account": {&opts.servAccount, sdConf.ServiceAccountPath},
+	} {
+		*field.dst, _ = cmd.Flags().GetString(flag)
+		if len(*field.dst) == 0 {
+			*field.dst = field.conf
+		}
+	}
+
+	switch {
+	case len(opts.project) == 0:
+		return nil, fmt.Errorf("no gcloud project name set")
+	case len(opts.region) == 0:
+		return nil, fmt.Errorf("no gcloud region set")
+	case len(opts.servAccount) == 0:
+		return nil, fmt.Errorf("no service account path set")
+	}
+
+	opts.interval = reader.DefaultPollInterval
+	switch {
+	case cmd.Flags().Changed("interval"):
+		opts.interval, _ = cmd.Flags().GetInt("interval")
+	case sdConf.PollingInterval > 0:
+		opts.interval = sdConf.PollingInterval
+	}
+
+	// --metadata-key is still supported, as in previous versions
+	if cmd.Flags().Changed("metadata-key") {
+		key, _ := cmd.Flags().GetString("metadata-key")
+		opts.keys = []string{key}
+	} else {
+		keys, err := utils.GetMetadataKeysFromCmdFlags(cmd)
+		if err != nil {
+			return nil, err
+		}
+		opts.keys = keys
+	}
+
+	adaptors, err := utils.GetAdaptorsFromFlags(cmd)
+	if err != nil {
+		return nil, err
+	}
+	opts.adaptors = adaptors
+	opts.server = utils.GetServerOptionsFromFlags(cmd)
+	opts.audit = utils.GetAuditOptionsFromFlags(cmd)
+	opts.election = utils.GetLeaderElectionOptionsFromFlags(cmd)
+	opts.resync = utils.GetResyncIntervalFromFlags(cmd)
+
+	return opts, nil
+}
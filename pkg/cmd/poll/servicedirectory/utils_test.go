@@ -0,0 +1,121 @@
+// Copyright © 2021 Cisco
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// All rights reserved.
+
+package servicedirectory
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/configuration"
+	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/internal/utils"
+	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/services"
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseFlags(t *testing.T) {
+	a := assert.New(t)
+	newCmd := func(args ...string) *cobra.Command {
+		c := GetServiceDirectoryCommand()
+		c.SetArgs(args)
+		c.Run = func(*cobra.Command, []string) {}
+		c.Execute()
+		return c
+	}
+	adaptors := []*utils.AdaptorOptions{{
+		Name:     "localhost:80/cnwan",
+		Endpoint: "localhost:80/cnwan",
+		Handler:  &services.HandlerOptions{APIVersion: "v1", Format: "openapi", Headers: map[string]string{}},
+	}}
+	sdConf := &configuration.Config{
+		ServiceRegistry: &configuration.ServiceRegistrySettings{
+			GCPServiceDirectory: &configuration.ServiceDirectoryConfig{
+				PollingInterval:    14,
+				ProjectID:          "project-from-conf",
+				Region:             "region-from-conf",
+				ServiceAccountPath: "path/from/conf",
+			},
+		},
+	}
+
+	cases := []struct {
+		cmd    *cobra.Command
+		conf   *configuration.Config
+		expRes *options
+		expErr error
+	}{
+		{
+			cmd:    newCmd(),
+			expErr: fmt.Errorf("no gcloud project name set"),
+		},
+		{
+			cmd:    newCmd("--project=project", "--region=region"),
+			expErr: fmt.Errorf("no service account path set"),
+		},
+		{
+			cmd:    newCmd("--project=project", "--region=region", "--service-account=path"),
+			expErr: fmt.Errorf("no metadata keys provided"),
+		},
+		{
+			cmd: newCmd("--project=project", "--region=region", "--service-account=path", "--metadata-key=this"),
+			expRes: &options{
+				project:     "project",
+				region:      "region",
+				servAccount: "path",
+				interval:    5,
+				keys:        []string{"this"},
+				adaptors:    adaptors,
+			},
+		},
+		{
+			cmd:  newCmd("--metadata-keys=that"),
+			conf: sdConf,
+			expRes: &options{
+				project:     "project-from-conf",
+				region:      "region-from-conf",
+				servAccount: "path/from/conf",
+				interval:    14,
+				keys:        []string{"that"},
+				adaptors:    adaptors,
+			},
+		},
+		{
+			cmd:  newCmd("--project=project", "--metadata-keys=that"),
+			conf: sdConf,
+			expRes: &options{
+				project:     "project",
+				region:      "region-from-conf",
+				servAccount: "path/from/conf",
+				interval:    14,
+				keys:        []string{"that"},
+				adaptors:    adaptors,
+			},
+		},
+	}
+
+	failed := func(i int) {
+		a.FailNow("case failed", fmt.Sprintf("case %d", i))
+	}
+	for i, currCase := range cases {
+		res, err := parseFlags(currCase.cmd, currCase.conf)
+		if !a.Equal(currCase.expRes, res) || !a.Equal(currCase.expErr, err) {
+			failed(i)
+		}
+	}
+}
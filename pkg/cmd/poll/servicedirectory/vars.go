@@ -0,0 +1,30 @@
+// Copyright © 2021 Cisco
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// All rights reserved.
+
+package servicedirectory
+
+const (
+	cmdUse   string = "servicedirectory --project <project> --region <region> --service-account <service-account>"
+	cmdShort string = "connect to Service Directory to get registered services"
+	cmdLong  string = `servicedirectory connects to Google Cloud Service Directory
+and observes changes in services published in it, i.e. metadata, addresses
+and ports.
+
+In order to work, a project, location and valid credentials must be provided.`
+	cmdExample string = "servicedirectory --project my-project --region us-west2 --service-account path/to/service-account.json"
+)
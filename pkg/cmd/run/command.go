@@ -0,0 +1,220 @@
+// Copyright © 2021 Cisco
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// All rights reserved.
+
+package run
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+
+	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/cmd/poll/cloudmap"
+	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/cmd/poll/servicedirectory"
+	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/cmd/watch/etcd"
+	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/configuration"
+	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/election"
+	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/health"
+	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/internal/utils"
+	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/reader"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+type options struct {
+	conflict string
+	// registries contains the service registries in the configuration
+	// file, in order of priority
+	registries []string
+}
+
+// GetRunCommand returns the run command
+func GetRunCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     runUse,
+		Short:   runShort,
+		Long:    runLong,
+		Example: runExample,
+		Run: func(cmd *cobra.Command, _ []string) {
+			conf := configuration.GetConfigFile()
+			opts, err := parseFlags(cmd, conf)
+			if err != nil {
+				log.Fatal().Err(err).Msg("error while parsing commands, check usage with --help")
+				return
+			}
+
+			run(cmd, conf, opts)
+		},
+	}
+
+	// Flags
+	cmd.Flags().String("conflict-policy", reader.ConflictPriority, "what to do when the same address and port are in more than one service registry: priority, all or drop")
+	cmd.Flags().StringSlice("priority", defaultPriority, "order of the service registries, from the one with the highest priority")
+
+	return cmd
+}
+
+func parseFlags(cmd *cobra.Command, conf *configuration.Config) (*options, error) {
+	if conf == nil || conf.ServiceRegistry == nil {
+		return nil, fmt.Errorf("no service registry provided")
+	}
+	srConf := conf.ServiceRegistry
+
+	opts := &options{}
+	opts.conflict, _ = cmd.Flags().GetString("conflict-policy")
+	if !cmd.Flags().Changed("conflict-policy") && len(srConf.ConflictPolicy) > 0 {
+		opts.conflict = srConf.ConflictPolicy
+	}
+	switch opts.conflict {
+	case reader.ConflictPriority, reader.ConflictAll, reader.ConflictDrop:
+	default:
+		return nil, fmt.Errorf("unsupported conflict policy: %s", opts.conflict)
+	}
+
+	priority, _ := cmd.Flags().GetStringSlice("priority")
+	if !cmd.Flags().Changed("priority") && len(srConf.Priority) > 0 {
+		priority = srConf.Priority
+	}
+
+	configured := map[string]bool{
+		servicedirectoryName: srConf.GCPServiceDirectory != nil,
+		cloudmapName:         srConf.AWSCloudMap != nil,
+		etcdName:             srConf.Etcd != nil,
+	}
+	listed := map[string]bool{}
+	for _, name := range priority {
+		if _, exists := configured[name]; !exists {
+			return nil, fmt.Errorf("unknown service registry: %s", name)
+		}
+		if listed[name] {
+			return nil, fmt.Errorf("service registry %s is listed more than once", name)
+		}
+		listed[name] = true
+	}
+
+	for _, name := range append(append([]string{}, priority...), defaultPriority...) {
+		if configured[name] {
+			opts.registries = append(opts.registries, name)
+			configured[name] = false
+		}
+	}
+	if len(opts.registries) == 0 {
+		return nil, fmt.Errorf("no service registry provided")
+	}
+
+	return opts, nil
+}
+
+func run(cmd *cobra.Command, conf *configuration.Config, opts *options) {
+	log.Info().Strs("service-registries", opts.registries).Str("conflict-policy", opts.conflict).Msg("starting...")
+
+	ctx, canc := context.WithCancel(context.Background())
+	defer canc()
+
+	checker := health.New()
+	sources := make([]reader.Source, len(opts.registries))
+	intervals := make([]int, len(opts.registries))
+	var etcdCli *clientv3.Client
+	for i, name := range opts.registries {
+		var err error
+		switch name {
+		case servicedirectoryName:
+			sources[i], intervals[i], err = servicedirectory.NewSource(ctx, cmd, conf)
+		case cloudmapName:
+			sources[i], intervals[i], err = cloudmap.NewSource(cmd, conf)
+		case etcdName:
+			sources[i], etcdCli, err = etcd.NewSource(cmd, conf, checker)
+		}
+		if err != nil {
+			log.Fatal().Err(err).Str("service-registry", name).Msg("error while connecting to the service registry")
+			return
+		}
+	}
+	if etcdCli != nil {
+		defer etcdCli.Close()
+	}
+
+	adaptors, err := utils.GetAdaptorsFromFlags(cmd)
+	if err != nil {
+		log.Fatal().Err(err).Msg("adaptor options are not valid")
+		return
+	}
+
+	serverTarget, err := utils.StartServer(ctx, utils.GetServerOptionsFromFlags(cmd), checker)
+	if err != nil {
+		log.Fatal().Err(err).Msg("error while starting the server")
+		return
+	}
+
+	auditLog, err := utils.OpenAuditLog(utils.GetAuditOptionsFromFlags(cmd))
+	if err != nil {
+		log.Fatal().Err(err).Msg("error while opening the audit log")
+		return
+	}
+
+	pipelineOpts := &reader.Options{
+		ResyncInterval: utils.GetResyncIntervalFromFlags(cmd),
+		Conflict:       opts.conflict,
+		Checker:        checker,
+	}
+	pipelineOpts.PollInterval, _ = cmd.Flags().GetInt("interval")
+	if electionOpts := utils.GetLeaderElectionOptionsFromFlags(cmd); electionOpts != nil {
+		if pipelineOpts.Elector, err = election.New(electionOpts, etcdCli); err != nil {
+			log.Fatal().Err(err).Msg("error while setting up leader election")
+			return
+		}
+	}
+
+	pipeline := reader.New(sources[0], pipelineOpts)
+	for i := 1; i < len(sources); i++ {
+		if err := pipeline.AddSource(sources[i], intervals[i]); err != nil {
+			log.Fatal().Err(err).Msg("error while adding the service registry")
+			return
+		}
+	}
+	if err := utils.AddAdaptorSinks(pipeline, adaptors, auditLog, serverTarget); err != nil {
+		log.Fatal().Err(err).Msg("error while trying to connect to the adaptors")
+		return
+	}
+
+	exitChan := make(chan error, 1)
+	go func() {
+		exitChan <- pipeline.Run(ctx)
+	}()
+
+	// Graceful shutdown
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt)
+
+	select {
+	case <-sig:
+		fmt.Println()
+		log.Info().Msg("exit requested")
+
+		// Cancel the context and wait for objects that use it to receive
+		// the stop command
+		canc()
+		<-exitChan
+	case err := <-exitChan:
+		log.Err(err).Msg("error while observing the service registries")
+		return
+	}
+
+	log.Info().Msg("good bye!")
+}
@@ -0,0 +1,118 @@
+// Copyright © 2021 Cisco
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// All rights reserved.
+
+package run
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/configuration"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseFlags(t *testing.T) {
+	a := assert.New(t)
+	allRegistries := &configuration.ServiceRegistrySettings{
+		GCPServiceDirectory: &configuration.ServiceDirectoryConfig{},
+		AWSCloudMap:         &configuration.CloudMapConfig{},
+		Etcd:                &configuration.EtcdConfig{},
+	}
+
+	cases := []struct {
+		args   []string
+		conf   *configuration.Config
+		expRes *options
+		expErr error
+	}{
+		{
+			expErr: fmt.Errorf("no service registry provided"),
+		},
+		{
+			conf:   &configuration.Config{ServiceRegistry: &configuration.ServiceRegistrySettings{}},
+			expErr: fmt.Errorf("no service registry provided"),
+		},
+		{
+			conf: &configuration.Config{ServiceRegistry: allRegistries},
+			expRes: &options{
+				conflict:   "priority",
+				registries: []string{"servicedirectory", "cloudmap", "etcd"},
+			},
+		},
+		{
+			args: []string{"--conflict-policy=drop", "--priority=etcd"},
+			conf: &configuration.Config{ServiceRegistry: allRegistries},
+			expRes: &options{
+				conflict:   "drop",
+				registries: []string{"etcd", "servicedirectory", "cloudmap"},
+			},
+		},
+		{
+			conf: &configuration.Config{ServiceRegistry: &configuration.ServiceRegistrySettings{
+				AWSCloudMap:    &configuration.CloudMapConfig{},
+				Etcd:           &configuration.EtcdConfig{},
+				ConflictPolicy: "all",
+				Priority:       []string{"etcd", "cloudmap"},
+			}},
+			expRes: &options{
+				conflict:   "all",
+				registries: []string{"etcd", "cloudmap"},
+			},
+		},
+		{
+			args: []string{"--priority=cloudmap"},
+			conf: &configuration.Config{ServiceRegistry: &configuration.ServiceRegistrySettings{
+				AWSCloudMap: &configuration.CloudMapConfig{},
+				Etcd:        &configuration.EtcdConfig{},
+				Priority:    []string{"etcd", "cloudmap"},
+			}},
+			expRes: &options{
+				conflict:   "priority",
+				registries: []string{"cloudmap", "etcd"},
+			},
+		},
+		{
+			args:   []string{"--conflict-policy=newest"},
+			conf:   &configuration.Config{ServiceRegistry: allRegistries},
+			expErr: fmt.Errorf("unsupported conflict policy: newest"),
+		},
+		{
+			args:   []string{"--priority=consul"},
+			conf:   &configuration.Config{ServiceRegistry: allRegistries},
+			expErr: fmt.Errorf("unknown service registry: consul"),
+		},
+		{
+			args:   []string{"--priority=etcd,cloudmap,etcd"},
+			conf:   &configuration.Config{ServiceRegistry: allRegistries},
+			expErr: fmt.Errorf("service registry etcd is listed more than once"),
+		},
+	}
+
+	failed := func(i int) {
+		a.FailNow("case failed", fmt.Sprintf("case %d", i))
+	}
+	for i, currCase := range cases {
+		cmd := GetRunCommand()
+		cmd.Flags().Parse(currCase.args)
+
+		res, err := parseFlags(cmd, currCase.conf)
+		if !a.Equal(currCase.expErr, err) || !a.Equal(currCase.expRes, res) {
+			failed(i)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+// Copyright © 2021 Cisco
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// All rights reserved.
+
+package run
+
+const (
+	runUse   string = "run [--conflict-policy <policy>] [--priority <registries>]"
+	runShort string = "observe all the service registries in the configuration file"
+	runLong  string = `run observes all the service registries in the
+configuration file at the same time, i.e. Service Directory, Cloud Map and
+etcd, and sends the changes to their services to the adaptors as if they were
+one service registry.
+
+Each event is tagged with the service registry it comes from, and the IDs of
+the endpoints are prefixed with its name, e.g. cloudmap/ns/serv/endp, so that
+they don't clash.
+
+--conflict-policy is what to do when endpoints with the same address and port
+are found in more than one service registry: priority only keeps the one of the
+service registry with the highest priority, all keeps all of them and drop
+drops all of them until only one service registry has it.
+
+--priority is the order of the service registries, from the one with the
+highest priority. Service registries that are not listed come after the others
+in the default order.`
+	runExample string = "run --config config.yaml --conflict-policy priority --priority etcd,servicedirectory,cloudmap"
+
+	servicedirectoryName string = "servicedirectory"
+	cloudmapName         string = "cloudmap"
+	etcdName             string = "etcd"
+)
+
+var (
+	// defaultPriority is the order of the service registries, unless
+	// another one is specified.
+	defaultPriority = []string{servicedirectoryName, cloudmapName, etcdName}
+)
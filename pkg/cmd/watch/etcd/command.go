@@ -24,27 +24,19 @@ import (
 	"fmt"
 	"os"
 	"os/signal"
-	"time"
 
 	opetcd "github.com/CloudNativeSDWAN/cnwan-operator/pkg/servregistry/etcd"
-	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/queue"
-	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/services"
-	"github.com/rs/zerolog"
+	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/configuration"
+	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/election"
+	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/health"
+	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/internal/utils"
+	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/reader"
+	"github.com/rs/zerolog/log"
 	"github.com/spf13/cobra"
 	clientv3 "go.etcd.io/etcd/client/v3"
 	namespace "go.etcd.io/etcd/client/v3/namespace"
 )
 
-var (
-	log zerolog.Logger
-)
-
-func init() {
-	output := zerolog.ConsoleWriter{Out: os.Stdout}
-	log = zerolog.New(output).With().Timestamp().Logger()
-	zerolog.SetGlobalLevel(zerolog.InfoLevel)
-}
-
 // GetEtcdCommand returns the etcd command
 //
 // TODO: on next version this will probably be changed and adopt some
@@ -59,89 +51,93 @@ func GetEtcdCommand() *cobra.Command {
 		Example: etcdExample,
 		PreRun: func(cmd *cobra.Command, _ []string) {
 			// Parse the flags
-			options, err := parseFlags(cmd)
+			options, err := parseFlags(cmd, configuration.GetConfigFile())
 			if err != nil {
 				log.Fatal().Err(err).Msg("error while parsing commands, check usage with --help")
 				return
 			}
 
-			// Get the etcd clients
-			cli, err := clientv3.New(getEtcdClientConfig(options))
-			if err != nil {
+			if watcher, err = newEtcdWatcher(options); err != nil {
 				log.Fatal().Err(err).Msg("error while establishing connection to etcd client")
 				return
 			}
-
-			sr := opetcd.NewServiceRegistryWithEtcd(context.Background(), cli, &options.Prefix)
-
-			watcher = &etcdWatcher{
-				options: options,
-				cli:     cli,
-				kv:      namespace.NewKV(cli.KV, options.Prefix),
-				watcher: namespace.NewWatcher(cli.Watcher, options.Prefix),
-				servreg: sr,
-			}
 		},
 		Run: func(cmd *cobra.Command, args []string) {
 
 			defer watcher.cli.Close()
 
-			// Get the adaptor endpoint
-			fromFlag, _ := cmd.Flags().GetString("adaptor-api")
-			adaptorEndpoint, err := sanitizeLocalhost(fromFlag, os.Getenv("MODE"))
+			// Get the adaptors
+			adaptors, err := utils.GetAdaptorsFromFlags(cmd)
 			if err != nil {
-				log.Err(err).Str("adaptor-endpoint", fromFlag).Msg("adaptor endpoint doesn't seem valid")
+				log.Err(err).Msg("adaptor options are not valid")
 				return
 			}
 
-			// Get create events
-			log.Info().Msg("getting current state of service registry from etcd...")
-			currStateCtx, currStateCanc := context.WithTimeout(context.Background(), time.Minute)
-			initialEvents, err := watcher.getCurrentState(currStateCtx, "create")
-			currStateCanc()
-			if err != nil {
-				if errors.Is(err, context.DeadlineExceeded) {
-					log.Err(err).Int("seconds", 60).Msg("timeout expired while getting current state (did you specify the correct --endpoints ?)")
-					return
-				}
+			ctx, canc := context.WithCancel(context.Background())
+			exitChan := make(chan error, 1)
 
-				log.Err(err).Msg("error while retrieving current state from etcd")
+			checker := health.New()
+			checker.SetConnectionCheck(watcher.checkConnection)
+			serverTarget, err := utils.StartServer(ctx, utils.GetServerOptionsFromFlags(cmd), checker)
+			if err != nil {
+				log.Err(err).Msg("error while starting the server")
+				canc()
 				return
 			}
 
-			ctx, canc := context.WithCancel(context.Background())
-			exitChan := make(chan bool)
-
-			// Get the queue and send the events
-			servsHandler, err := services.NewHandler(ctx, adaptorEndpoint)
+			auditLog, err := utils.OpenAuditLog(utils.GetAuditOptionsFromFlags(cmd))
 			if err != nil {
-				log.Err(err).Msg("error while trying to connect to service directory")
+				log.Err(err).Msg("error while opening the audit log")
 				canc()
 				return
 			}
-			watcher.Queue = queue.New(ctx, servsHandler)
-			if len(initialEvents) > 0 {
-				go watcher.Enqueue(initialEvents)
+
+			pipelineOpts := &reader.Options{
+				ResyncInterval: utils.GetResyncIntervalFromFlags(cmd),
+				Checker:        checker,
+			}
+			if electionOpts := utils.GetLeaderElectionOptionsFromFlags(cmd); electionOpts != nil {
+				if pipelineOpts.Elector, err = election.New(electionOpts, watcher.cli); err != nil {
+					log.Err(err).Msg("error while setting up leader election")
+					canc()
+					return
+				}
+			}
+
+			pipeline := reader.New(watcher, pipelineOpts)
+			if err := utils.AddAdaptorSinks(pipeline, adaptors, auditLog, serverTarget); err != nil {
+				log.Err(err).Msg("error while trying to connect to the adaptors")
+				canc()
+				return
 			}
 
 			go func() {
-				log.Info().Msg("watching for changes...")
-				watcher.Watch(ctx)
-				close(exitChan)
+				exitChan <- pipeline.Run(ctx)
 			}()
 
 			// Graceful shutdown
 			sig := make(chan os.Signal, 1)
 			signal.Notify(sig, os.Interrupt)
 
-			<-sig
-			fmt.Println()
-			log.Info().Msg("exit requested")
+			select {
+			case <-sig:
+				fmt.Println()
+				log.Info().Msg("exit requested")
+
+				// Cancel the context and wait for objects that use it to
+				// receive the stop command
+				canc()
+				<-exitChan
+			case err := <-exitChan:
+				canc()
+				if errors.Is(err, context.DeadlineExceeded) {
+					log.Err(err).Int("seconds", 60).Msg("timeout expired while getting current state (did you specify the correct --endpoints ?)")
+					return
+				}
 
-			// Cancel the context and wait for objects that use it to receive
-			// the stop command
-			canc()
-			<-exitChan
+				log.Err(err).Msg("error while observing etcd")
+				return
+			}
 
 			log.Info().Msg("good bye!")
 		},
@@ -156,6 +152,52 @@ func GetEtcdCommand() *cobra.Command {
 	cmd.Flags().String("password", "", "the password to use for this user")
 	cmd.Flags().String("prefix", "/", "the prefix to include for all objects")
 	cmd.Flags().StringSlice("metadata-keys", []string{}, "the metadata keys to look for")
+	cmd.Flags().String("ca-cert", "", "path to the CA certificate to verify etcd's certificates with")
+	cmd.Flags().String("client-cert", "", "path to the client certificate to authenticate with")
+	cmd.Flags().String("client-key", "", "path to the private key of the client certificate")
+	cmd.Flags().Bool("insecure-skip-verify", false, "whether to skip verification of etcd's certificates (not recommended!)")
 
 	return cmd
 }
+
+// NewSource returns a source that watches etcd, with the settings defined
+// by the flags of cmd and by conf, along with its client, which must be
+// closed when the source is not needed anymore.
+// The connection to etcd is checked by checker, if not nil.
+func NewSource(cmd *cobra.Command, conf *configuration.Config, checker *health.Checker) (reader.Watcher, *clientv3.Client, error) {
+	options, err := parseFlags(cmd, conf)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	watcher, err := newEtcdWatcher(options)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if checker != nil {
+		checker.SetConnectionCheck(watcher.checkConnection)
+	}
+
+	return watcher, watcher.cli, nil
+}
+
+func newEtcdWatcher(options *Options) (*etcdWatcher, error) {
+	cfg, err := getEtcdClientConfig(options)
+	if err != nil {
+		return nil, fmt.Errorf("error while parsing etcd client configuration: %w", err)
+	}
+
+	cli, err := clientv3.New(*cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return &etcdWatcher{
+		options: options,
+		cli:     cli,
+		kv:      namespace.NewKV(cli.KV, options.Prefix),
+		watcher: namespace.NewWatcher(cli.Watcher, options.Prefix),
+		servreg: opetcd.NewServiceRegistryWithEtcd(context.Background(), cli, &options.Prefix),
+	}, nil
+}
@@ -26,6 +26,9 @@ type Options struct {
 	Credentials *Credentials `yaml:"credentials,omitempty"`
 	// Prefix where the service registry objects are stored
 	Prefix string `yaml:"prefix,omitempty"`
+	// TLS settings to use when connecting to the cluster, if it requires
+	// a secure connection
+	TLS *TLS `yaml:"tls,omitempty"`
 
 	// targetKeys is a list of metadata keys to look for.
 	// This is not dervied from etcd's own flags, so we make it unexported.
@@ -48,3 +51,19 @@ type Credentials struct {
 	// Password for this username
 	Password string `yaml:"password,omitempty"`
 }
+
+// TLS is a container with paths to certificates and keys for establishing a
+// secure connection to etcd
+type TLS struct {
+	// CACert is the path to the certificate of the CA that signed etcd's
+	// server certificates
+	CACert string `yaml:"caCert,omitempty"`
+	// ClientCert is the path to the certificate to present to etcd, in case
+	// client certificate authentication is enabled
+	ClientCert string `yaml:"clientCert,omitempty"`
+	// ClientKey is the path to the private key of ClientCert
+	ClientKey string `yaml:"clientKey,omitempty"`
+	// InsecureSkipVerify disables verification of etcd's server
+	// certificates. Only use this for testing!
+	InsecureSkipVerify bool `yaml:"insecureSkipVerify,omitempty"`
+}
@@ -21,13 +21,18 @@ package etcd
 import (
 	"fmt"
 	"os"
+	"sort"
 	"strconv"
 	"strings"
 
 	opsr "github.com/CloudNativeSDWAN/cnwan-operator/pkg/servregistry"
 	opetcd "github.com/CloudNativeSDWAN/cnwan-operator/pkg/servregistry/etcd"
+	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/configuration"
+	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/internal/utils"
 	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/openapi"
+	"github.com/rs/zerolog/log"
 	"github.com/spf13/cobra"
+	"go.etcd.io/etcd/client/pkg/v3/transport"
 	clientv3 "go.etcd.io/etcd/client/v3"
 	"gopkg.in/yaml.v3"
 )
@@ -99,14 +104,40 @@ func parseEndpointsFromFlags(endpoints []string) (parsed []Endpoint) {
 	return parsed
 }
 
-func parseFlags(cmd *cobra.Command) (*Options, error) {
+func parseFlags(cmd *cobra.Command, conf *configuration.Config) (*Options, error) {
 	opts := &Options{}
 
+	etcdConf := &configuration.EtcdConfig{}
+	if conf == nil {
+		conf = &configuration.Config{}
+	}
+	if conf.ServiceRegistry != nil && conf.ServiceRegistry.Etcd != nil {
+		etcdConf = conf.ServiceRegistry.Etcd
+	}
+
 	endpoints, _ := cmd.Flags().GetStringSlice("endpoints")
+	if !cmd.Flags().Changed("endpoints") && len(etcdConf.Endpoints) > 0 {
+		endpoints = []string{}
+		for _, endp := range etcdConf.Endpoints {
+			port := ""
+			if endp.Port > 0 {
+				port = strconv.FormatInt(int64(endp.Port), 10)
+			}
+			endpoints = append(endpoints, fmt.Sprintf("%s:%s", endp.Host, port))
+		}
+	}
+	if len(endpoints) == 0 {
+		// e.g. with the run command, which doesn't have the flags of this
+		// one
+		endpoints = []string{fmt.Sprintf("%s:%d", defaultHost, defaultPort)}
+	}
 	opts.Endpoints = parseEndpointsFromFlags(endpoints)
 
 	keys := []string{}
 	_keys, _ := cmd.Flags().GetStringSlice("metadata-keys")
+	if !cmd.Flags().Changed("metadata-keys") && len(conf.MetadataKeys) > 0 {
+		_keys = conf.MetadataKeys
+	}
 	switch l := len(_keys); {
 	case l == 0:
 		return nil, fmt.Errorf("no metadata keys provided")
@@ -121,6 +152,14 @@ func parseFlags(cmd *cobra.Command) (*Options, error) {
 
 	username, _ := cmd.Flags().GetString("username")
 	password, _ := cmd.Flags().GetString("password")
+	if etcdConf.Credentials != nil {
+		if !cmd.Flags().Changed("username") {
+			username = etcdConf.Credentials.Username
+		}
+		if !cmd.Flags().Changed("password") {
+			password = etcdConf.Credentials.Password
+		}
+	}
 
 	if len(username) > 0 && len(password) > 0 {
 		opts.Credentials = &Credentials{Username: username, Password: password}
@@ -134,18 +173,72 @@ func parseFlags(cmd *cobra.Command) (*Options, error) {
 	}
 
 	prefix, _ := cmd.Flags().GetString("prefix")
+	if !cmd.Flags().Changed("prefix") && len(etcdConf.Prefix) > 0 {
+		prefix = etcdConf.Prefix
+	}
 	opts.Prefix = parsePrefix(prefix)
 
+	tlsOpts, err := parseTLSFlags(cmd, etcdConf.TLS)
+	if err != nil {
+		return nil, err
+	}
+	opts.TLS = tlsOpts
+
 	return opts, nil
 }
 
-func getEtcdClientConfig(opts *Options) clientv3.Config {
+func parseTLSFlags(cmd *cobra.Command, tlsConf *configuration.EtcdTLS) (*TLS, error) {
+	if tlsConf == nil {
+		tlsConf = &configuration.EtcdTLS{}
+	}
+
+	caCert, _ := cmd.Flags().GetString("ca-cert")
+	if !cmd.Flags().Changed("ca-cert") {
+		caCert = tlsConf.CACert
+	}
+
+	clientCert, _ := cmd.Flags().GetString("client-cert")
+	if !cmd.Flags().Changed("client-cert") {
+		clientCert = tlsConf.ClientCert
+	}
+
+	clientKey, _ := cmd.Flags().GetString("client-key")
+	if !cmd.Flags().Changed("client-key") {
+		clientKey = tlsConf.ClientKey
+	}
+
+	insecure, _ := cmd.Flags().GetBool("insecure-skip-verify")
+	if !cmd.Flags().Changed("insecure-skip-verify") {
+		insecure = tlsConf.InsecureSkipVerify
+	}
+
+	if len(clientCert) > 0 && len(clientKey) == 0 {
+		return nil, fmt.Errorf("client certificate set but no client key provided")
+	}
+	if len(clientCert) == 0 && len(clientKey) > 0 {
+		return nil, fmt.Errorf("client key set but no client certificate provided")
+	}
+
+	if len(caCert) == 0 && len(clientCert) == 0 && !insecure {
+		// No TLS
+		return nil, nil
+	}
+
+	return &TLS{
+		CACert:             caCert,
+		ClientCert:         clientCert,
+		ClientKey:          clientKey,
+		InsecureSkipVerify: insecure,
+	}, nil
+}
+
+func getEtcdClientConfig(opts *Options) (*clientv3.Config, error) {
 	endps := []string{}
 
 	for _, endp := range opts.Endpoints {
 		endps = append(endps, fmt.Sprintf("%s:%d", endp.Host, endp.Port))
 	}
-	cfg := clientv3.Config{
+	cfg := &clientv3.Config{
 		Endpoints: endps,
 	}
 
@@ -154,8 +247,22 @@ func getEtcdClientConfig(opts *Options) clientv3.Config {
 		cfg.Password = opts.Credentials.Password
 	}
 
-	// TODO: support for TLS authentication
-	return cfg
+	if opts.TLS != nil {
+		tlsInfo := transport.TLSInfo{
+			TrustedCAFile:      opts.TLS.CACert,
+			CertFile:           opts.TLS.ClientCert,
+			KeyFile:            opts.TLS.ClientKey,
+			InsecureSkipVerify: opts.TLS.InsecureSkipVerify,
+		}
+
+		tlsConfig, err := tlsInfo.ClientConfig()
+		if err != nil {
+			return nil, fmt.Errorf("could not load TLS certificates: %w", err)
+		}
+		cfg.TLS = tlsConfig
+	}
+
+	return cfg, nil
 }
 
 func parsePrefix(prefix string) string {
@@ -197,15 +304,27 @@ func createOpenapiEvent(endp *opsr.Endpoint, srv *opsr.Service, eventType string
 	event := openapi.Event{
 		Event: eventType,
 		Service: openapi.Service{
-			Name:     endp.Name,
-			Address:  endp.Address,
-			Port:     endp.Port,
-			Metadata: []openapi.Metadata{},
+			Id:        utils.EndpointID(endp.NsName, endp.ServName, endp.Name),
+			Name:      endp.Name,
+			Address:   endp.Address,
+			Port:      endp.Port,
+			Namespace: endp.NsName,
+			Service:   endp.ServName,
+			Source:    sourceName,
+			Metadata:  []openapi.Metadata{},
 		},
 	}
 
-	for mtdKey, mtdVal := range srv.Metadata {
-		event.Service.Metadata = append(event.Service.Metadata, openapi.Metadata{Key: mtdKey, Value: mtdVal})
+	// Keys are sorted, so that the same metadata always results in the
+	// same event
+	mtdKeys := make([]string, 0, len(srv.Metadata))
+	for mtdKey := range srv.Metadata {
+		mtdKeys = append(mtdKeys, mtdKey)
+	}
+	sort.Strings(mtdKeys)
+
+	for _, mtdKey := range mtdKeys {
+		event.Service.Metadata = append(event.Service.Metadata, openapi.Metadata{Key: mtdKey, Value: srv.Metadata[mtdKey]})
 	}
 
 	return &event
@@ -19,13 +19,30 @@
 package etcd
 
 import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
 	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/url"
+	"os"
+	"path"
 	"testing"
+	"time"
 
 	opsr "github.com/CloudNativeSDWAN/cnwan-operator/pkg/servregistry"
+	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/configuration"
 	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/openapi"
 	"github.com/spf13/cobra"
 	"github.com/stretchr/testify/assert"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/server/v3/embed"
 	"gopkg.in/yaml.v2"
 )
 
@@ -125,6 +142,7 @@ func TestParseFlags(t *testing.T) {
 
 	cases := []struct {
 		cmd    *cobra.Command
+		conf   *configuration.Config
 		expRes *Options
 		expErr error
 	}{
@@ -167,6 +185,176 @@ func TestParseFlags(t *testing.T) {
 			}(),
 			expErr: fmt.Errorf("password set but no username provided"),
 		},
+		{
+			cmd: func() *cobra.Command {
+				c := GetEtcdCommand()
+				c.SetArgs([]string{"--metadata-keys=whatever", "--client-cert=client.crt"})
+				c.PreRun = func(*cobra.Command, []string) {}
+				c.Run = func(*cobra.Command, []string) {}
+				c.Execute()
+				return c
+			}(),
+			expErr: fmt.Errorf("client certificate set but no client key provided"),
+		},
+		{
+			cmd: func() *cobra.Command {
+				c := GetEtcdCommand()
+				c.SetArgs([]string{"--metadata-keys=whatever", "--client-key=client.key"})
+				c.PreRun = func(*cobra.Command, []string) {}
+				c.Run = func(*cobra.Command, []string) {}
+				c.Execute()
+				return c
+			}(),
+			expErr: fmt.Errorf("client key set but no client certificate provided"),
+		},
+		{
+			cmd: func() *cobra.Command {
+				c := GetEtcdCommand()
+				c.SetArgs([]string{
+					"--metadata-keys=whatever",
+					"--ca-cert=ca.crt",
+					"--client-cert=client.crt",
+					"--client-key=client.key",
+				})
+				c.PreRun = func(*cobra.Command, []string) {}
+				c.Run = func(*cobra.Command, []string) {}
+				c.Execute()
+				return c
+			}(),
+			expRes: &Options{
+				Endpoints:  []Endpoint{{Host: defaultHost, Port: defaultPort}},
+				Prefix:     "/",
+				targetKeys: []string{"whatever"},
+				TLS: &TLS{
+					CACert:     "ca.crt",
+					ClientCert: "client.crt",
+					ClientKey:  "client.key",
+				},
+			},
+		},
+		{
+			cmd: func() *cobra.Command {
+				c := GetEtcdCommand()
+				c.SetArgs([]string{"--metadata-keys=whatever", "--insecure-skip-verify"})
+				c.PreRun = func(*cobra.Command, []string) {}
+				c.Run = func(*cobra.Command, []string) {}
+				c.Execute()
+				return c
+			}(),
+			expRes: &Options{
+				Endpoints:  []Endpoint{{Host: defaultHost, Port: defaultPort}},
+				Prefix:     "/",
+				targetKeys: []string{"whatever"},
+				TLS:        &TLS{InsecureSkipVerify: true},
+			},
+		},
+		{
+			cmd: func() *cobra.Command {
+				c := GetEtcdCommand()
+				c.PreRun = func(*cobra.Command, []string) {}
+				c.Run = func(*cobra.Command, []string) {}
+				c.Execute()
+				return c
+			}(),
+			conf: &configuration.Config{
+				MetadataKeys: []string{"from-conf"},
+				ServiceRegistry: &configuration.ServiceRegistrySettings{
+					Etcd: &configuration.EtcdConfig{
+						Endpoints: []configuration.EtcdEndpoint{
+							{Host: "10.10.10.10", Port: 3344},
+							{Host: "example.com"},
+						},
+						Credentials: &configuration.EtcdCredentials{
+							Username: "user", Password: "pass",
+						},
+						Prefix: "service-registry",
+						TLS: &configuration.EtcdTLS{
+							CACert:     "ca.crt",
+							ClientCert: "client.crt",
+							ClientKey:  "client.key",
+						},
+					},
+				},
+			},
+			expRes: &Options{
+				Endpoints: []Endpoint{
+					{Host: "10.10.10.10", Port: 3344},
+					{Host: "example.com", Port: defaultPort},
+				},
+				Prefix: "/service-registry/",
+				Credentials: &Credentials{
+					Username: "user", Password: "pass",
+				},
+				TLS: &TLS{
+					CACert:     "ca.crt",
+					ClientCert: "client.crt",
+					ClientKey:  "client.key",
+				},
+				targetKeys: []string{"from-conf"},
+			},
+		},
+		{
+			cmd: func() *cobra.Command {
+				c := GetEtcdCommand()
+				c.SetArgs([]string{
+					"--metadata-keys=from-flag",
+					"--endpoints=localhost:3344",
+					"--password=from-flag",
+					"--prefix=/from-flag/",
+					"--ca-cert=from-flag.crt",
+				})
+				c.PreRun = func(*cobra.Command, []string) {}
+				c.Run = func(*cobra.Command, []string) {}
+				c.Execute()
+				return c
+			}(),
+			conf: &configuration.Config{
+				MetadataKeys: []string{"from-conf"},
+				ServiceRegistry: &configuration.ServiceRegistrySettings{
+					Etcd: &configuration.EtcdConfig{
+						Endpoints: []configuration.EtcdEndpoint{
+							{Host: "10.10.10.10", Port: 3344},
+						},
+						Credentials: &configuration.EtcdCredentials{
+							Username: "user", Password: "pass",
+						},
+						Prefix: "service-registry",
+						TLS: &configuration.EtcdTLS{
+							CACert: "ca.crt",
+						},
+					},
+				},
+			},
+			expRes: &Options{
+				Endpoints: []Endpoint{
+					{Host: "localhost", Port: 3344},
+				},
+				Prefix: "/from-flag/",
+				Credentials: &Credentials{
+					Username: "user", Password: "from-flag",
+				},
+				TLS: &TLS{
+					CACert: "from-flag.crt",
+				},
+				targetKeys: []string{"from-flag"},
+			},
+		},
+		{
+			// Commands without the flags of etcd, e.g. run, get the same
+			// defaults
+			cmd: &cobra.Command{},
+			conf: &configuration.Config{
+				MetadataKeys: []string{"from-conf"},
+				ServiceRegistry: &configuration.ServiceRegistrySettings{
+					Etcd: &configuration.EtcdConfig{},
+				},
+			},
+			expRes: &Options{
+				Endpoints:  []Endpoint{{Host: defaultHost, Port: defaultPort}},
+				Prefix:     "/",
+				targetKeys: []string{"from-conf"},
+			},
+		},
 		{
 			cmd: func() *cobra.Command {
 				c := GetEtcdCommand()
@@ -201,7 +389,7 @@ func TestParseFlags(t *testing.T) {
 	}
 
 	for i, currCase := range cases {
-		res, err := parseFlags(currCase.cmd)
+		res, err := parseFlags(currCase.cmd, currCase.conf)
 		er := currCase.expRes
 		if !a.Equal(currCase.expErr, err) {
 			failed(i)
@@ -213,6 +401,117 @@ func TestParseFlags(t *testing.T) {
 	}
 }
 
+func TestGetEtcdClientConfig(t *testing.T) {
+	a := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "cnwan-reader-etcd-tls")
+	if !a.NoError(err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	certs, err := generateTestCertificates(dir)
+	if !a.NoError(err) {
+		return
+	}
+
+	etcdServer, endpoint, err := startTestEtcdWithTLS(dir, certs)
+	if !a.NoError(err) {
+		return
+	}
+	defer etcdServer.Close()
+
+	cases := []struct {
+		tls           *TLS
+		expErr        bool
+		expConnectErr bool
+	}{
+		{
+			tls: &TLS{
+				CACert: path.Join(dir, "does-not-exist.crt"),
+			},
+			expErr: true,
+		},
+		{
+			tls: &TLS{
+				CACert:     certs.caCert,
+				ClientCert: path.Join(dir, "does-not-exist.crt"),
+				ClientKey:  path.Join(dir, "does-not-exist.key"),
+			},
+			expErr: true,
+		},
+		{
+			// Server requires a client certificate
+			tls: &TLS{
+				CACert: certs.caCert,
+			},
+			expConnectErr: true,
+		},
+		{
+			// Server certificate is not trusted
+			tls: &TLS{
+				ClientCert: certs.clientCert,
+				ClientKey:  certs.clientKey,
+			},
+			expConnectErr: true,
+		},
+		{
+			tls: &TLS{
+				CACert:     certs.caCert,
+				ClientCert: certs.clientCert,
+				ClientKey:  certs.clientKey,
+			},
+		},
+		{
+			tls: &TLS{
+				ClientCert:         certs.clientCert,
+				ClientKey:          certs.clientKey,
+				InsecureSkipVerify: true,
+			},
+		},
+	}
+
+	for i, currCase := range cases {
+		cfg, err := getEtcdClientConfig(&Options{
+			Endpoints: []Endpoint{endpoint},
+			TLS:       currCase.tls,
+		})
+		if currCase.expErr {
+			if !a.Error(err) {
+				a.FailNow(fmt.Sprintf("case %d failed", i))
+			}
+			continue
+		}
+		if !a.NoError(err) || !a.NotNil(cfg.TLS) {
+			a.FailNow(fmt.Sprintf("case %d failed", i))
+		}
+
+		cfg.DialTimeout = 2 * time.Second
+		cli, err := clientv3.New(*cfg)
+		if err != nil {
+			if !currCase.expConnectErr {
+				a.FailNow(fmt.Sprintf("case %d failed", i), err.Error())
+			}
+			continue
+		}
+
+		ctx, canc := context.WithTimeout(context.Background(), 2*time.Second)
+		_, err = cli.Put(ctx, "key", "value")
+		canc()
+		cli.Close()
+
+		if currCase.expConnectErr != (err != nil) {
+			a.FailNow(fmt.Sprintf("case %d failed", i))
+		}
+	}
+
+	// No TLS
+	cfg, err := getEtcdClientConfig(&Options{Endpoints: []Endpoint{endpoint}})
+	a.NoError(err)
+	a.Nil(cfg.TLS)
+	a.Equal([]string{fmt.Sprintf("%s:%d", endpoint.Host, endpoint.Port)}, cfg.Endpoints)
+}
+
 func TestParsePrefix(t *testing.T) {
 	a := assert.New(t)
 	empty := ""
@@ -381,9 +680,13 @@ func TestCreateOpenapiEvent(t *testing.T) {
 	expRes := &openapi.Event{
 		Event: "create",
 		Service: openapi.Service{
-			Name:    endp.Name,
-			Address: endp.Address,
-			Port:    endp.Port,
+			Id:        "ns/srv/endp",
+			Name:      endp.Name,
+			Address:   endp.Address,
+			Port:      endp.Port,
+			Namespace: "ns",
+			Service:   "srv",
+			Source:    sourceName,
 			Metadata: []openapi.Metadata{
 				{Key: "name", Value: "srv"},
 				{Key: "srv", Value: "yes"},
@@ -475,3 +778,148 @@ func TestMapValuesChanged(t *testing.T) {
 		}
 	}
 }
+
+type testCertificates struct {
+	caCert     string
+	serverCert string
+	serverKey  string
+	clientCert string
+	clientKey  string
+}
+
+// generateTestCertificates creates a CA and uses it to sign a server and a
+// client certificate, writing all of them in dir.
+func generateTestCertificates(dir string) (*testCertificates, error) {
+	writePEM := func(fileName, pemType string, data []byte) (string, error) {
+		filePath := path.Join(dir, fileName)
+		pemData := pem.EncodeToMemory(&pem.Block{Type: pemType, Bytes: data})
+		return filePath, ioutil.WriteFile(filePath, pemData, 0600)
+	}
+
+	newCert := func(template, parent *x509.Certificate, parentKey *ecdsa.PrivateKey, name string) (*x509.Certificate, *ecdsa.PrivateKey, error) {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			return nil, nil, err
+		}
+		if parent == nil {
+			parent, parentKey = template, key
+		}
+
+		der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+		if err != nil {
+			return nil, nil, err
+		}
+		if _, err := writePEM(name+".crt", "CERTIFICATE", der); err != nil {
+			return nil, nil, err
+		}
+
+		keyDer, err := x509.MarshalECPrivateKey(key)
+		if err != nil {
+			return nil, nil, err
+		}
+		if _, err := writePEM(name+".key", "EC PRIVATE KEY", keyDer); err != nil {
+			return nil, nil, err
+		}
+
+		cert, err := x509.ParseCertificate(der)
+		return cert, key, err
+	}
+
+	notBefore := time.Now().Add(-time.Hour)
+	notAfter := time.Now().Add(time.Hour)
+
+	ca, caKey, err := newCert(&x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "cnwan-reader-test-ca"},
+		NotBefore:             notBefore,
+		NotAfter:              notAfter,
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+	}, nil, nil, "ca")
+	if err != nil {
+		return nil, err
+	}
+
+	if _, _, err := newCert(&x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		NotBefore:    notBefore,
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}, ca, caKey, "server"); err != nil {
+		return nil, err
+	}
+
+	if _, _, err := newCert(&x509.Certificate{
+		SerialNumber: big.NewInt(3),
+		Subject:      pkix.Name{CommonName: "cnwan-reader"},
+		NotBefore:    notBefore,
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, ca, caKey, "client"); err != nil {
+		return nil, err
+	}
+
+	return &testCertificates{
+		caCert:     path.Join(dir, "ca.crt"),
+		serverCert: path.Join(dir, "server.crt"),
+		serverKey:  path.Join(dir, "server.key"),
+		clientCert: path.Join(dir, "client.crt"),
+		clientKey:  path.Join(dir, "client.key"),
+	}, nil
+}
+
+// startTestEtcdWithTLS starts an embedded etcd server that requires clients
+// to authenticate with a certificate signed by the test CA.
+func startTestEtcdWithTLS(dir string, certs *testCertificates) (*embed.Etcd, Endpoint, error) {
+	freePort := func() (int, error) {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			return 0, err
+		}
+		defer l.Close()
+		return l.Addr().(*net.TCPAddr).Port, nil
+	}
+
+	clientPort, err := freePort()
+	if err != nil {
+		return nil, Endpoint{}, err
+	}
+	peerPort, err := freePort()
+	if err != nil {
+		return nil, Endpoint{}, err
+	}
+
+	clientURL, _ := url.Parse(fmt.Sprintf("https://127.0.0.1:%d", clientPort))
+	peerURL, _ := url.Parse(fmt.Sprintf("http://127.0.0.1:%d", peerPort))
+
+	cfg := embed.NewConfig()
+	cfg.Dir = path.Join(dir, "data")
+	cfg.LogLevel = "error"
+	cfg.LCUrls, cfg.ACUrls = []url.URL{*clientURL}, []url.URL{*clientURL}
+	cfg.LPUrls, cfg.APUrls = []url.URL{*peerURL}, []url.URL{*peerURL}
+	cfg.InitialCluster = cfg.InitialClusterFromName(cfg.Name)
+	cfg.ClientTLSInfo.CertFile = certs.serverCert
+	cfg.ClientTLSInfo.KeyFile = certs.serverKey
+	cfg.ClientTLSInfo.TrustedCAFile = certs.caCert
+	cfg.ClientTLSInfo.ClientCertAuth = true
+
+	e, err := embed.StartEtcd(cfg)
+	if err != nil {
+		return nil, Endpoint{}, err
+	}
+
+	select {
+	case <-e.Server.ReadyNotify():
+	case <-time.After(30 * time.Second):
+		e.Close()
+		return nil, Endpoint{}, fmt.Errorf("embedded etcd took too long to start")
+	}
+
+	return e, Endpoint{Host: "127.0.0.1", Port: int32(clientPort)}, nil
+}
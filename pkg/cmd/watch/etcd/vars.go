@@ -33,9 +33,16 @@ use your cluster (not recommended!).
 --prefix is a string that will be placed before each query and specifies that your service
 registry objects, i.e. Namespaces, Services and Endpoints, all have keys that start with
 these values. If you have authentication mode enabled, make sure your user has enough
-permissions for the cnwan-reader to do its job: it must have read access to this prefix.`
-	etcdExample string = "etcd --endpoints localhost:2379 --username user --password pass"
+permissions for the cnwan-reader to do its job: it must have read access to this prefix.
+
+--ca-cert is the path to the certificate of the CA that signed etcd's certificates and
+must be provided if your cluster is serving with TLS. If your cluster also requires
+clients to authenticate with certificates, provide them with --client-cert and
+--client-key. --insecure-skip-verify disables verification of etcd's certificates: only
+use it for testing.`
+	etcdExample string = "etcd --endpoints localhost:2379 --username user --password pass --ca-cert ca.crt"
 
 	defaultPort int32  = 2379
 	defaultHost string = "localhost"
+	sourceName  string = "etcd"
 )
@@ -20,15 +20,23 @@ package etcd
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"time"
 
 	opsr "github.com/CloudNativeSDWAN/cnwan-operator/pkg/servregistry"
 	opetcd "github.com/CloudNativeSDWAN/cnwan-operator/pkg/servregistry/etcd"
+	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/internal/utils"
+	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/metrics"
 	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/openapi"
-	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/queue"
+	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/tracing"
 	"github.com/google/go-cmp/cmp"
+	"github.com/rs/zerolog/log"
 	"go.etcd.io/etcd/api/v3/mvccpb"
 	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc/connectivity"
 	"gopkg.in/yaml.v3"
 )
 
@@ -38,17 +46,52 @@ type etcdWatcher struct {
 	cli     *clientv3.Client
 	kv      clientv3.KV
 	watcher clientv3.Watcher
-	queue.Queue
 	servreg opsr.ServiceRegistry
 }
 
-func (e *etcdWatcher) Watch(ctx context.Context) {
+// Name returns the name of the service registry.
+func (e *etcdWatcher) Name() string {
+	return sourceName
+}
+
+// State returns the endpoints that are currently registered.
+func (e *etcdWatcher) State(ctx context.Context) (map[string]*openapi.Service, error) {
+	stateCtx, stateCanc := context.WithTimeout(ctx, time.Minute)
+	defer stateCanc()
+
+	events, err := e.getCurrentState(stateCtx, "create")
+	if err != nil {
+		return nil, err
+	}
+
+	servs := make(map[string]*openapi.Service, len(events))
+	for key, event := range events {
+		servs[key] = &event.Service
+	}
+
+	return servs, nil
+}
+
+// Watch calls notify with the events of each change, until ctx is
+// canceled.
+func (e *etcdWatcher) Watch(ctx context.Context, notify func(context.Context, map[string]*openapi.Event)) error {
 	log.Info().Msg(e.options.Prefix)
 	wchan := e.watcher.Watch(ctx, "", clientv3.WithPrefix(), clientv3.WithPrevKV())
 	defer e.watcher.Close()
 
 	for wresp := range wchan {
+		if err := wresp.Err(); err != nil {
+			metrics.RegistryErrors.WithLabelValues(sourceName).Inc()
+			log.Err(err).Msg("error while watching for changes")
+			continue
+		}
+
 		for _, ev := range wresp.Events {
+			evCtx, span := tracing.Tracer().Start(ctx, "watch event", trace.WithAttributes(
+				attribute.String("cnwan.source", sourceName),
+				attribute.String("cnwan.key", string(ev.Kv.Key)),
+				attribute.String("cnwan.type", ev.Type.String()),
+			))
 
 			key := opetcd.KeyFromString(string(ev.Kv.Key))
 			var eventsToSend map[string]*openapi.Event
@@ -58,21 +101,21 @@ func (e *etcdWatcher) Watch(ctx context.Context) {
 				if key.ObjectType() == opetcd.EndpointObject && ev.PrevKv != nil && ev.PrevKv.Value != nil {
 					log.Info().Str("key", key.String()).Msg("detected deleted endpoint")
 					if endpEv, err := e.parseEndpointAndCreateEvent(ev.PrevKv, "delete"); err == nil && endpEv != nil {
-						eventsToSend = map[string]*openapi.Event{key.String(): endpEv}
+						eventsToSend = map[string]*openapi.Event{endpEv.Service.Id: endpEv}
 					}
 				}
 			case evType == mvccpb.PUT && ev.IsCreate():
 				if key.ObjectType() == opetcd.EndpointObject && ev.Kv.Value != nil {
 					log.Info().Str("key", key.String()).Msg("new endpoint detected")
-					if endpEv, err := e.parseEndpointAndCreateEvent(ev.PrevKv, "create"); err == nil && endpEv != nil {
-						eventsToSend = map[string]*openapi.Event{key.String(): endpEv}
+					if endpEv, err := e.parseEndpointAndCreateEvent(ev.Kv, "create"); err == nil && endpEv != nil {
+						eventsToSend = map[string]*openapi.Event{endpEv.Service.Id: endpEv}
 					}
 				}
 			case evType == mvccpb.PUT && ev.IsModify():
 				if key.ObjectType() == opetcd.EndpointObject {
 					log.Info().Str("key", key.String()).Msg("detected updated endpoint")
 					if endpEv, err := e.parseEndpointChange(ev.Kv, ev.PrevKv); err == nil && endpEv != nil {
-						eventsToSend = map[string]*openapi.Event{key.String(): endpEv}
+						eventsToSend = map[string]*openapi.Event{endpEv.Service.Id: endpEv}
 					}
 				}
 				if key.ObjectType() == opetcd.ServiceObject {
@@ -83,11 +126,19 @@ func (e *etcdWatcher) Watch(ctx context.Context) {
 				}
 			}
 
-			if e.Queue != nil && len(eventsToSend) > 0 {
-				go e.Queue.Enqueue(eventsToSend)
+			span.SetAttributes(attribute.Int("cnwan.events", len(eventsToSend)))
+			span.End()
+			if len(eventsToSend) > 0 {
+				notify(evCtx, eventsToSend)
 			}
 		}
 	}
+
+	if ctx.Err() != nil {
+		return nil
+	}
+
+	return errors.New("watch channel has been closed")
 }
 
 func (e *etcdWatcher) parseEndpointAndCreateEvent(kvpair *mvccpb.KeyValue, eventName string) (*openapi.Event, error) {
@@ -162,8 +213,8 @@ func (e *etcdWatcher) parseEndpointChange(now, prev *mvccpb.KeyValue) (*openapi.
 		return nil, nil
 	}
 
-	// TODO: on future versions, this will be removed, in favor of a
-	// simple map[string]string, the ones used by the operator
+	// The list is only used by v1 of the API: when v2 is used, the
+	// handler converts it back to a map.
 	parsedMetadata := []openapi.Metadata{}
 	for key, val := range srv.Metadata {
 		parsedMetadata = append(parsedMetadata, openapi.Metadata{Key: key, Value: val})
@@ -175,10 +226,14 @@ func (e *etcdWatcher) parseEndpointChange(now, prev *mvccpb.KeyValue) (*openapi.
 		return &openapi.Event{
 			Event: "delete",
 			Service: openapi.Service{
-				Name:     parsedPrev.Name,
-				Address:  parsedPrev.Address,
-				Port:     parsedPrev.Port,
-				Metadata: parsedMetadata,
+				Id:        utils.EndpointID(parsedPrev.NsName, parsedPrev.ServName, parsedPrev.Name),
+				Name:      parsedPrev.Name,
+				Address:   parsedPrev.Address,
+				Port:      parsedPrev.Port,
+				Namespace: parsedPrev.NsName,
+				Service:   parsedPrev.ServName,
+				Source:    sourceName,
+				Metadata:  parsedMetadata,
 			},
 		}, nil
 	}
@@ -189,10 +244,14 @@ func (e *etcdWatcher) parseEndpointChange(now, prev *mvccpb.KeyValue) (*openapi.
 		return &openapi.Event{
 			Event: "create",
 			Service: openapi.Service{
-				Name:     parsedNow.Name,
-				Address:  parsedNow.Address,
-				Port:     parsedNow.Port,
-				Metadata: parsedMetadata,
+				Id:        utils.EndpointID(parsedNow.NsName, parsedNow.ServName, parsedNow.Name),
+				Name:      parsedNow.Name,
+				Address:   parsedNow.Address,
+				Port:      parsedNow.Port,
+				Namespace: parsedNow.NsName,
+				Service:   parsedNow.ServName,
+				Source:    sourceName,
+				Metadata:  parsedMetadata,
 			},
 		}, nil
 	}
@@ -205,10 +264,14 @@ func (e *etcdWatcher) parseEndpointChange(now, prev *mvccpb.KeyValue) (*openapi.
 		return &openapi.Event{
 			Event: "update",
 			Service: openapi.Service{
-				Name:     parsedNow.Name,
-				Address:  parsedNow.Address,
-				Port:     parsedNow.Port,
-				Metadata: parsedMetadata,
+				Id:        utils.EndpointID(parsedNow.NsName, parsedNow.ServName, parsedNow.Name),
+				Name:      parsedNow.Name,
+				Address:   parsedNow.Address,
+				Port:      parsedNow.Port,
+				Namespace: parsedNow.NsName,
+				Service:   parsedNow.ServName,
+				Source:    sourceName,
+				Metadata:  parsedMetadata,
 			},
 		}, nil
 	}
@@ -286,22 +349,34 @@ func (e *etcdWatcher) parseServiceChange(now, prev *mvccpb.KeyValue) (map[string
 	// if you're here, it means that there are indeed changes to be made.
 	endpList, err := e.servreg.ListEndp(srv.NsName, srv.Name)
 	if err != nil {
+		metrics.RegistryErrors.WithLabelValues(sourceName).Inc()
 		log.Err(err).Msg("could not get list of endpoints, skipping...")
 		return nil, err
 	}
 
 	events := map[string]*openapi.Event{}
 	for _, endp := range endpList {
-		key := opetcd.KeyFromNames(endp.NsName, endp.ServName, endp.Name)
-		events[key.String()] = createOpenapiEvent(endp, srv, event)
+		ev := createOpenapiEvent(endp, srv, event)
+		events[ev.Service.Id] = ev
 	}
 
 	return events, nil
 }
 
+// checkConnection returns an error if the connection to etcd is failing.
+func (e *etcdWatcher) checkConnection() error {
+	switch state := e.cli.ActiveConnection().GetState(); state {
+	case connectivity.TransientFailure, connectivity.Shutdown:
+		return fmt.Errorf("connection to etcd is in state %s", state)
+	}
+
+	return nil
+}
+
 func (e *etcdWatcher) getCurrentState(ctx context.Context, event string) (map[string]*openapi.Event, error) {
 	resp, err := e.kv.Get(ctx, "namespaces", clientv3.WithPrefix(), clientv3.WithSort(clientv3.SortByKey, clientv3.SortAscend))
 	if err != nil {
+		metrics.RegistryErrors.WithLabelValues(sourceName).Inc()
 		return nil, err
 	}
 
@@ -357,12 +432,17 @@ func (e *etcdWatcher) getCurrentState(ctx context.Context, event string) (map[st
 		}
 
 		for _, endp := range endpList {
+			evKey := utils.EndpointID(endp.NsName, endp.ServName, endp.Name)
 			ev := openapi.Event{
 				Event: event,
 				Service: openapi.Service{
-					Name:    endp.Name,
-					Address: endp.Address,
-					Port:    endp.Port,
+					Id:        evKey,
+					Name:      endp.Name,
+					Address:   endp.Address,
+					Port:      endp.Port,
+					Namespace: endp.NsName,
+					Service:   endp.ServName,
+					Source:    sourceName,
 				},
 			}
 
@@ -371,8 +451,6 @@ func (e *etcdWatcher) getCurrentState(ctx context.Context, event string) (map[st
 				metadataList = append(metadataList, openapi.Metadata{Key: key, Value: val})
 			}
 			ev.Service.Metadata = metadataList
-
-			evKey := fmt.Sprintf("%s:%d", endp.Address, endp.Port)
 			events[evKey] = &ev
 		}
 	}
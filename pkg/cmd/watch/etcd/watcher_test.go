@@ -20,11 +20,13 @@ package etcd
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"testing"
 
 	opsr "github.com/CloudNativeSDWAN/cnwan-operator/pkg/servregistry"
 	opetcd "github.com/CloudNativeSDWAN/cnwan-operator/pkg/servregistry/etcd"
+	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/internal/utils"
 	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/openapi"
 	"github.com/stretchr/testify/assert"
 	"go.etcd.io/etcd/api/v3/mvccpb"
@@ -139,13 +141,17 @@ func TestGetCurrentState(t *testing.T) {
 			},
 			options: &Options{targetKeys: []string{"stay"}},
 			expRes: map[string]*openapi.Event{
-				fmt.Sprintf("%s:%d", okEp.Address, okEp.Port): {
+				"whatever/should-stay/should-stay": {
 					Event: "event-type",
 					Service: openapi.Service{
-						Name:     okEp.Name,
-						Address:  okEp.Address,
-						Port:     okEp.Port,
-						Metadata: []openapi.Metadata{{Key: "stay", Value: "yes"}},
+						Id:        "whatever/should-stay/should-stay",
+						Name:      okEp.Name,
+						Address:   okEp.Address,
+						Port:      okEp.Port,
+						Namespace: okEp.NsName,
+						Service:   okEp.ServName,
+						Source:    sourceName,
+						Metadata:  []openapi.Metadata{{Key: "stay", Value: "yes"}},
 					},
 				},
 			},
@@ -245,10 +251,14 @@ func TestParseEndpointAndCreateEvent(t *testing.T) {
 			expRes: &openapi.Event{
 				Event: "just-to-see-if-its-this",
 				Service: openapi.Service{
-					Name:     okEndp.Name,
-					Address:  okEndp.Address,
-					Port:     okEndp.Port,
-					Metadata: []openapi.Metadata{{Key: "yes", Value: "yes"}},
+					Id:        utils.EndpointID(okEndp.NsName, okEndp.ServName, okEndp.Name),
+					Name:      okEndp.Name,
+					Address:   okEndp.Address,
+					Port:      okEndp.Port,
+					Namespace: okEndp.NsName,
+					Service:   okEndp.ServName,
+					Source:    sourceName,
+					Metadata:  []openapi.Metadata{{Key: "yes", Value: "yes"}},
 				},
 			},
 		},
@@ -374,10 +384,14 @@ func TestParseEndpointChange(t *testing.T) {
 			expRes: &openapi.Event{
 				Event: "delete",
 				Service: openapi.Service{
-					Name:     epPrev.Name,
-					Address:  epPrev.Address,
-					Port:     epPrev.Port,
-					Metadata: []openapi.Metadata{{Key: "yes", Value: "yes"}},
+					Id:        utils.EndpointID(epPrev.NsName, epPrev.ServName, epPrev.Name),
+					Name:      epPrev.Name,
+					Address:   epPrev.Address,
+					Port:      epPrev.Port,
+					Namespace: epPrev.NsName,
+					Service:   epPrev.ServName,
+					Source:    sourceName,
+					Metadata:  []openapi.Metadata{{Key: "yes", Value: "yes"}},
 				},
 			},
 		},
@@ -400,10 +414,14 @@ func TestParseEndpointChange(t *testing.T) {
 			expRes: &openapi.Event{
 				Event: "create",
 				Service: openapi.Service{
-					Name:     epNow.Name,
-					Address:  epNow.Address,
-					Port:     epNow.Port,
-					Metadata: []openapi.Metadata{{Key: "yes", Value: "yes"}},
+					Id:        utils.EndpointID(epNow.NsName, epNow.ServName, epNow.Name),
+					Name:      epNow.Name,
+					Address:   epNow.Address,
+					Port:      epNow.Port,
+					Namespace: epNow.NsName,
+					Service:   epNow.ServName,
+					Source:    sourceName,
+					Metadata:  []openapi.Metadata{{Key: "yes", Value: "yes"}},
 				},
 			},
 		},
@@ -459,10 +477,14 @@ func TestParseEndpointChange(t *testing.T) {
 			expRes: &openapi.Event{
 				Event: "update",
 				Service: openapi.Service{
-					Name:     epNow.Name,
-					Address:  epNow.Address,
-					Port:     epNow.Port,
-					Metadata: []openapi.Metadata{{Key: "yes", Value: "yes"}},
+					Id:        utils.EndpointID(epNow.NsName, epNow.ServName, epNow.Name),
+					Name:      epNow.Name,
+					Address:   epNow.Address,
+					Port:      epNow.Port,
+					Namespace: epNow.NsName,
+					Service:   epNow.ServName,
+					Source:    sourceName,
+					Metadata:  []openapi.Metadata{{Key: "yes", Value: "yes"}},
 				},
 			},
 		},
@@ -563,15 +585,17 @@ func TestParseServiceChange(t *testing.T) {
 				}, nil
 			},
 			expRes: map[string]*openapi.Event{
-				opetcd.KeyFromNames("ns", "srv", "endp1").String(): {
+				"ns/srv/endp1": {
 					Event: "delete",
-					Service: openapi.Service{Name: "endp1", Address: "10.10.10.10", Port: 9090,
+					Service: openapi.Service{Id: "ns/srv/endp1", Name: "endp1", Address: "10.10.10.10", Port: 9090,
+						Namespace: "ns", Service: "srv", Source: sourceName,
 						Metadata: []openapi.Metadata{{Key: "yes", Value: "yes"}},
 					},
 				},
-				opetcd.KeyFromNames("ns", "srv", "endp2").String(): {
+				"ns/srv/endp2": {
 					Event: "delete",
-					Service: openapi.Service{Name: "endp2", Address: "11.11.11.11", Port: 9191,
+					Service: openapi.Service{Id: "ns/srv/endp2", Name: "endp2", Address: "11.11.11.11", Port: 9191,
+						Namespace: "ns", Service: "srv", Source: sourceName,
 						Metadata: []openapi.Metadata{{Key: "yes", Value: "yes"}},
 					},
 				},
@@ -609,15 +633,17 @@ func TestParseServiceChange(t *testing.T) {
 				}, nil
 			},
 			expRes: map[string]*openapi.Event{
-				opetcd.KeyFromNames("ns", "srv", "endp1").String(): {
+				"ns/srv/endp1": {
 					Event: "delete",
-					Service: openapi.Service{Name: "endp1", Address: "10.10.10.10", Port: 9090,
+					Service: openapi.Service{Id: "ns/srv/endp1", Name: "endp1", Address: "10.10.10.10", Port: 9090,
+						Namespace: "ns", Service: "srv", Source: sourceName,
 						Metadata: []openapi.Metadata{{Key: "yes", Value: "yes"}},
 					},
 				},
-				opetcd.KeyFromNames("ns", "srv", "endp2").String(): {
+				"ns/srv/endp2": {
 					Event: "delete",
-					Service: openapi.Service{Name: "endp2", Address: "11.11.11.11", Port: 9191,
+					Service: openapi.Service{Id: "ns/srv/endp2", Name: "endp2", Address: "11.11.11.11", Port: 9191,
+						Namespace: "ns", Service: "srv", Source: sourceName,
 						Metadata: []openapi.Metadata{{Key: "yes", Value: "yes"}},
 					},
 				},
@@ -655,15 +681,17 @@ func TestParseServiceChange(t *testing.T) {
 				}, nil
 			},
 			expRes: map[string]*openapi.Event{
-				opetcd.KeyFromNames("ns", "srv", "endp1").String(): {
+				"ns/srv/endp1": {
 					Event: "create",
-					Service: openapi.Service{Name: "endp1", Address: "10.10.10.10", Port: 9090,
+					Service: openapi.Service{Id: "ns/srv/endp1", Name: "endp1", Address: "10.10.10.10", Port: 9090,
+						Namespace: "ns", Service: "srv", Source: sourceName,
 						Metadata: []openapi.Metadata{{Key: "yes", Value: "yes"}},
 					},
 				},
-				opetcd.KeyFromNames("ns", "srv", "endp2").String(): {
+				"ns/srv/endp2": {
 					Event: "create",
-					Service: openapi.Service{Name: "endp2", Address: "11.11.11.11", Port: 9191,
+					Service: openapi.Service{Id: "ns/srv/endp2", Name: "endp2", Address: "11.11.11.11", Port: 9191,
+						Namespace: "ns", Service: "srv", Source: sourceName,
 						Metadata: []openapi.Metadata{{Key: "yes", Value: "yes"}},
 					},
 				},
@@ -696,15 +724,17 @@ func TestParseServiceChange(t *testing.T) {
 				}, nil
 			},
 			expRes: map[string]*openapi.Event{
-				opetcd.KeyFromNames("ns", "srv", "endp1").String(): {
+				"ns/srv/endp1": {
 					Event: "create",
-					Service: openapi.Service{Name: "endp1", Address: "10.10.10.10", Port: 9090,
+					Service: openapi.Service{Id: "ns/srv/endp1", Name: "endp1", Address: "10.10.10.10", Port: 9090,
+						Namespace: "ns", Service: "srv", Source: sourceName,
 						Metadata: []openapi.Metadata{{Key: "yes", Value: "yes"}},
 					},
 				},
-				opetcd.KeyFromNames("ns", "srv", "endp2").String(): {
+				"ns/srv/endp2": {
 					Event: "create",
-					Service: openapi.Service{Name: "endp2", Address: "11.11.11.11", Port: 9191,
+					Service: openapi.Service{Id: "ns/srv/endp2", Name: "endp2", Address: "11.11.11.11", Port: 9191,
+						Namespace: "ns", Service: "srv", Source: sourceName,
 						Metadata: []openapi.Metadata{{Key: "yes", Value: "yes"}},
 					},
 				},
@@ -774,15 +804,17 @@ func TestParseServiceChange(t *testing.T) {
 				}, nil
 			},
 			expRes: map[string]*openapi.Event{
-				opetcd.KeyFromNames("ns", "srv", "endp1").String(): {
+				"ns/srv/endp1": {
 					Event: "update",
-					Service: openapi.Service{Name: "endp1", Address: "10.10.10.10", Port: 9090,
+					Service: openapi.Service{Id: "ns/srv/endp1", Name: "endp1", Address: "10.10.10.10", Port: 9090,
+						Namespace: "ns", Service: "srv", Source: sourceName,
 						Metadata: []openapi.Metadata{{Key: "yes", Value: "yes"}},
 					},
 				},
-				opetcd.KeyFromNames("ns", "srv", "endp2").String(): {
+				"ns/srv/endp2": {
 					Event: "update",
-					Service: openapi.Service{Name: "endp2", Address: "11.11.11.11", Port: 9191,
+					Service: openapi.Service{Id: "ns/srv/endp2", Name: "endp2", Address: "11.11.11.11", Port: 9191,
+						Namespace: "ns", Service: "srv", Source: sourceName,
 						Metadata: []openapi.Metadata{{Key: "yes", Value: "yes"}},
 					},
 				},
@@ -851,3 +883,100 @@ func TestParseServiceChange(t *testing.T) {
 		}
 	}
 }
+
+func TestWatchKeysMatchCurrentState(t *testing.T) {
+	a := assert.New(t)
+	srv := &opsr.Service{
+		Name:     "srv",
+		NsName:   "ns",
+		Metadata: map[string]string{"yes": "yes"},
+	}
+	srvKey := opetcd.KeyFromNames(srv.NsName, srv.Name)
+	srvVal, _ := yaml.Marshal(srv)
+
+	endp := &opsr.Endpoint{
+		Name:     "endp",
+		ServName: srv.Name,
+		NsName:   srv.NsName,
+		Address:  "10.10.10.10",
+		Port:     8080,
+	}
+	endpKey := opetcd.KeyFromNames(endp.NsName, endp.ServName, endp.Name)
+	endpVal, _ := yaml.Marshal(endp)
+
+	changedEndp := *endp
+	changedEndp.Port = 9090
+	changedEndpVal, _ := yaml.Marshal(&changedEndp)
+
+	newEndp := *endp
+	newEndp.Name = "new-endp"
+	newEndpKey := opetcd.KeyFromNames(newEndp.NsName, newEndp.ServName, newEndp.Name)
+	newEndpVal, _ := yaml.Marshal(&newEndp)
+
+	wchan := make(chan clientv3.WatchResponse, 1)
+	wchan <- clientv3.WatchResponse{
+		Events: []*clientv3.Event{
+			{
+				Type: mvccpb.PUT,
+				Kv:   &mvccpb.KeyValue{Key: []byte(endpKey.String()), Value: changedEndpVal, CreateRevision: 1, ModRevision: 2},
+				PrevKv: &mvccpb.KeyValue{
+					Key: []byte(endpKey.String()), Value: endpVal, CreateRevision: 1, ModRevision: 1,
+				},
+			},
+			{
+				Type: mvccpb.PUT,
+				Kv:   &mvccpb.KeyValue{Key: []byte(newEndpKey.String()), Value: newEndpVal, CreateRevision: 3, ModRevision: 3},
+			},
+			{
+				Type:   mvccpb.DELETE,
+				Kv:     &mvccpb.KeyValue{Key: []byte(endpKey.String()), ModRevision: 4},
+				PrevKv: &mvccpb.KeyValue{Key: []byte(endpKey.String()), Value: changedEndpVal, CreateRevision: 1, ModRevision: 2},
+			},
+		},
+	}
+	close(wchan)
+
+	e := &etcdWatcher{
+		options: &Options{targetKeys: []string{"yes"}},
+		kv: &fakeKV{
+			_get: func(ctx context.Context, key string, opts ...clientv3.OpOption) (*clientv3.GetResponse, error) {
+				return &clientv3.GetResponse{
+					Kvs: []*mvccpb.KeyValue{
+						{Key: []byte(srvKey.String()), Value: srvVal},
+						{Key: []byte(endpKey.String()), Value: endpVal},
+					},
+				}, nil
+			},
+		},
+		watcher: &fakeWatcher{
+			_watch: func(ctx context.Context, key string, opts ...clientv3.OpOption) clientv3.WatchChan {
+				return wchan
+			},
+		},
+		servreg: &fakeSR{
+			_getServ: func(nsName, servName string) (*opsr.Service, error) {
+				return srv, nil
+			},
+		},
+	}
+
+	initial, err := e.getCurrentState(context.Background(), "create")
+	a.NoError(err)
+	a.Len(initial, 1)
+	a.Contains(initial, "ns/srv/endp")
+
+	received := []string{}
+	err = e.Watch(context.Background(), func(ctx context.Context, events map[string]*openapi.Event) {
+		for key, ev := range events {
+			a.Equal(key, ev.Service.Id)
+			received = append(received, key+"@"+ev.Event)
+		}
+	})
+	a.Equal(errors.New("watch channel has been closed"), err)
+
+	a.Equal([]string{
+		"ns/srv/endp@update",
+		"ns/srv/new-endp@create",
+		"ns/srv/endp@delete",
+	}, received)
+}
@@ -20,16 +20,194 @@ package configuration
 
 // Config contains the configuration of the program
 type Config struct {
-	// DebugMode specifies whether to log debug or not
+	// DebugMode specifies whether to log debug or not. It is the same as
+	// setting debug as the level in Log
 	DebugMode bool `yaml:"debugMode,omitempty"`
+	// Log contains settings about how and where to write logs
+	Log *LogConfig `yaml:"log,omitempty"`
 	// Adaptor specifies the adaptor configuration
 	Adaptor string `yaml:"adaptor,omitempty"`
+	// APIVersion is the version of the API implemented by the adaptor
+	APIVersion string `yaml:"apiVersion,omitempty"`
+	// EventFormat is the format of the events sent to the adaptor
+	EventFormat string `yaml:"eventFormat,omitempty"`
+	// ResyncInterval is the number of seconds between two consecutive
+	// deliveries of the full current state to the adaptor. 0 disables it
+	ResyncInterval int `yaml:"resyncInterval,omitempty"`
+	// AdaptorAuth contains the credentials to authenticate to the adaptor
+	AdaptorAuth *AdaptorAuthConfig `yaml:"adaptorAuth,omitempty"`
+	// AdaptorHeaders are included in every request sent to the adaptor
+	AdaptorHeaders map[string]string `yaml:"adaptorHeaders,omitempty"`
+	// AdaptorTLS contains settings to connect to https:// adaptors
+	AdaptorTLS *AdaptorTLSConfig `yaml:"adaptorTLS,omitempty"`
+	// AdaptorSigning contains the secrets to sign requests with
+	AdaptorSigning *AdaptorSigningConfig `yaml:"adaptorSigning,omitempty"`
+	// Adaptors is a list of adaptors where events are sent to. If set, it
+	// is used instead of Adaptor and the other adaptor settings above
+	Adaptors []AdaptorConfig `yaml:"adaptors,omitempty"`
+	// Server contains settings about the HTTP server that adaptors can
+	// query to get the current state and the latest events
+	Server *ServerConfig `yaml:"server,omitempty"`
+	// Tracing contains settings about where to export spans
+	Tracing *TracingConfig `yaml:"tracing,omitempty"`
+	// Audit contains settings about where to record the batches of events
+	// sent to the adaptors
+	Audit *AuditConfig `yaml:"audit,omitempty"`
+	// LeaderElection contains settings about how to elect the instance
+	// that sends events, when more than one is running
+	LeaderElection *LeaderElectionConfig `yaml:"leaderElection,omitempty"`
 	// MetadataKeys is the key to look for in a service's metadata
 	MetadataKeys []string `yaml:"metadataKeys"`
 	// ServiceRegistry settings about the service registry to use
 	ServiceRegistry *ServiceRegistrySettings `yaml:"serviceRegistry"`
 }
 
+// AdaptorConfig contains the configuration of one of the adaptors where
+// events are sent to.
+type AdaptorConfig struct {
+	// Name of the adaptor, used to identify it in logs
+	Name string `yaml:"name,omitempty"`
+	// API is the endpoint of the adaptor, in the same format as Adaptor
+	API string `yaml:"api"`
+	// APIVersion is the version of the API implemented by the adaptor
+	APIVersion string `yaml:"apiVersion,omitempty"`
+	// EventFormat is the format of the events sent to the adaptor
+	EventFormat string `yaml:"eventFormat,omitempty"`
+	// Auth contains the credentials to authenticate to the adaptor
+	Auth *AdaptorAuthConfig `yaml:"auth,omitempty"`
+	// Headers are included in every request sent to the adaptor
+	Headers map[string]string `yaml:"headers,omitempty"`
+	// TLS contains settings to connect to the adaptor, if it is https://
+	TLS *AdaptorTLSConfig `yaml:"tls,omitempty"`
+	// Signing contains the secrets to sign requests with
+	Signing *AdaptorSigningConfig `yaml:"signing,omitempty"`
+	// Selector contains the metadata an endpoint must have to be sent to
+	// this adaptor. A key with an empty value only requires the key
+	Selector map[string]string `yaml:"selector,omitempty"`
+	// Retry contains settings about how to retry sending events
+	Retry *AdaptorRetryConfig `yaml:"retry,omitempty"`
+}
+
+// AdaptorRetryConfig contains settings about how to retry sending events
+// that could not be sent to the adaptor.
+type AdaptorRetryConfig struct {
+	// MinBackoff is the number of seconds to wait before retrying the
+	// first time. It is doubled after each failure
+	MinBackoff int `yaml:"minBackoff,omitempty"`
+	// MaxBackoff is the maximum number of seconds to wait before retrying
+	MaxBackoff int `yaml:"maxBackoff,omitempty"`
+}
+
+// AdaptorAuthConfig contains the credentials to authenticate to the
+// adaptor with. Its fields are the same as the CLI flags, although the latter
+// can override them.
+type AdaptorAuthConfig struct {
+	// TokenFile is the path of a file containing a bearer token
+	TokenFile string `yaml:"tokenFile,omitempty"`
+	// Username for basic auth
+	Username string `yaml:"username,omitempty"`
+	// Password for basic auth
+	Password string `yaml:"password,omitempty"`
+	// APIKey to send to the adaptor
+	APIKey string `yaml:"apiKey,omitempty"`
+	// APIKeyHeader is the header where to send the API key
+	APIKeyHeader string `yaml:"apiKeyHeader,omitempty"`
+}
+
+// AdaptorTLSConfig contains paths to certificates and keys for establishing
+// a secure connection to the adaptor. Its fields are the same as the CLI
+// flags, although the latter can override them.
+type AdaptorTLSConfig struct {
+	// CACert is the path to the certificates of the CAs that signed the
+	// adaptor's certificate
+	CACert string `yaml:"caCert,omitempty"`
+	// ClientCert is the path to the certificate to present to the adaptor
+	ClientCert string `yaml:"clientCert,omitempty"`
+	// ClientKey is the path to the private key of ClientCert
+	ClientKey string `yaml:"clientKey,omitempty"`
+	// ServerName is the name to expect in the adaptor's certificate
+	ServerName string `yaml:"serverName,omitempty"`
+}
+
+// AdaptorSigningConfig contains the secrets to sign requests to the adaptor
+// with. Its fields are the same as the CLI flags, although the latter can
+// override them.
+type AdaptorSigningConfig struct {
+	// SecretFiles are paths of files, each containing a secret
+	SecretFiles []string `yaml:"secretFiles,omitempty"`
+}
+
+// ServerConfig contains settings about the HTTP server of the program. Its
+// fields are the same as the CLI flags, although the latter can override
+// them.
+type ServerConfig struct {
+	// Address where to serve requests, e.g. :8080. If empty, the server
+	// is not started
+	Address string `yaml:"address,omitempty"`
+	// HistorySize is the number of events kept in the history
+	HistorySize int `yaml:"historySize,omitempty"`
+	// LivenessThreshold is the number of seconds after which the program
+	// is not alive anymore if the service registry has not been polled
+	// successfully. If 0, it is not checked
+	LivenessThreshold int `yaml:"livenessThreshold,omitempty"`
+}
+
+// TracingConfig contains settings about where to export spans with OTLP.
+// Its fields are the same as the CLI flags, although the latter can
+// override them.
+type TracingConfig struct {
+	// Endpoint of the OTLP collector, e.g. localhost:4317. If empty,
+	// spans are not exported
+	Endpoint string `yaml:"endpoint,omitempty"`
+	// Protocol to export spans with: grpc or http
+	Protocol string `yaml:"protocol,omitempty"`
+	// Insecure disables TLS when connecting to the collector
+	Insecure bool `yaml:"insecure,omitempty"`
+}
+
+// AuditConfig contains settings about where to record the batches of events
+// sent to the adaptors. Its fields are the same as the CLI flags, although
+// the latter can override them.
+type AuditConfig struct {
+	// Path of the audit log. If empty, batches are not recorded
+	Path string `yaml:"path,omitempty"`
+	// MaxSize is the size in megabytes after which the log is rotated
+	MaxSize int `yaml:"maxSize,omitempty"`
+	// MaxBackups is the number of rotated logs to keep
+	MaxBackups int `yaml:"maxBackups,omitempty"`
+}
+
+// LeaderElectionConfig contains settings about how to elect the instance
+// that sends events to the adaptors. Its fields are the same as the CLI
+// flags, although the latter can override them.
+type LeaderElectionConfig struct {
+	// Backend used to elect the leader: etcd, kubernetes or file. If
+	// empty, leader election is disabled
+	Backend string `yaml:"backend,omitempty"`
+	// Name of the etcd key or of the Kubernetes Lease
+	Name string `yaml:"name,omitempty"`
+	// Namespace of the Kubernetes Lease
+	Namespace string `yaml:"namespace,omitempty"`
+	// File to lock with the file backend
+	File string `yaml:"file,omitempty"`
+	// LeaseDuration is the number of seconds after which another instance
+	// becomes the leader if the current one stops renewing its lease
+	LeaseDuration int `yaml:"leaseDuration,omitempty"`
+}
+
+// LogConfig contains settings about how and where to write logs. Its fields
+// are the same as the CLI flags, although the latter can override them.
+type LogConfig struct {
+	// Format of the log lines: console or json
+	Format string `yaml:"format,omitempty"`
+	// Level is the minimum level of the lines to write, e.g. debug
+	Level string `yaml:"level,omitempty"`
+	// File where to append logs to. If empty, logs are written to the
+	// standard output, or to the standard error if events are written
+	// to the standard output
+	File string `yaml:"file,omitempty"`
+}
+
 // ServiceRegistrySettings contains information
 type ServiceRegistrySettings struct {
 	// GCPServiceDirectory is the field with configuration about service
@@ -37,6 +215,15 @@ type ServiceRegistrySettings struct {
 	GCPServiceDirectory *ServiceDirectoryConfig `yaml:"gcpServiceDirectory,omitempty"`
 	// AWSCloudMap contains configuration about AWS CloudMap
 	AWSCloudMap *CloudMapConfig `yaml:"awsCloudMap,omitempty"`
+	// Etcd contains configuration about etcd
+	Etcd *EtcdConfig `yaml:"etcd,omitempty"`
+	// ConflictPolicy is what to do when endpoints with the same address and
+	// port are found in more than one service registry: priority, all or
+	// drop. It is only used when more than one is present
+	ConflictPolicy string `yaml:"conflictPolicy,omitempty"`
+	// Priority is the order of the service registries, from the one with
+	// the highest priority: servicedirectory, cloudmap or etcd
+	Priority []string `yaml:"priority,omitempty"`
 }
 
 // ServiceDirectoryConfig contains Service Directory configuration.
@@ -62,3 +249,49 @@ type CloudMapConfig struct {
 	// PollInterval is the number of seconds between two consecutive polls
 	PollInterval int `yaml:"pollInterval,omitempty"`
 }
+
+// EtcdConfig contains etcd configuration.
+// Its fields are the same as the CLI flags, although the latter can override
+// them.
+type EtcdConfig struct {
+	// Endpoints is a list of hosts and ports where etcd nodes are running
+	Endpoints []EtcdEndpoint `yaml:"endpoints,omitempty"`
+	// Credentials to connect to the cluster, if authentication mode is enabled
+	Credentials *EtcdCredentials `yaml:"credentials,omitempty"`
+	// Prefix where the service registry objects are stored
+	Prefix string `yaml:"prefix,omitempty"`
+	// TLS settings to use when connecting to the cluster
+	TLS *EtcdTLS `yaml:"tls,omitempty"`
+}
+
+// EtcdEndpoint is a container with host and port of an etcd node
+type EtcdEndpoint struct {
+	// Host of the etcd node
+	Host string `yaml:"host,omitempty"`
+	// Port where the etcd node is listening from
+	Port int32 `yaml:"port,omitempty"`
+}
+
+// EtcdCredentials is a container with username and password for
+// authenticating to etcd
+type EtcdCredentials struct {
+	// Username to authenticate as
+	Username string `yaml:"username,omitempty"`
+	// Password for this username
+	Password string `yaml:"password,omitempty"`
+}
+
+// EtcdTLS is a container with paths to certificates and keys for
+// establishing a secure connection to etcd
+type EtcdTLS struct {
+	// CACert is the path to the certificate of the CA that signed etcd's
+	// server certificates
+	CACert string `yaml:"caCert,omitempty"`
+	// ClientCert is the path to the certificate to present to etcd
+	ClientCert string `yaml:"clientCert,omitempty"`
+	// ClientKey is the path to the private key of ClientCert
+	ClientKey string `yaml:"clientKey,omitempty"`
+	// InsecureSkipVerify disables verification of etcd's server
+	// certificates
+	InsecureSkipVerify bool `yaml:"insecureSkipVerify,omitempty"`
+}
@@ -0,0 +1,208 @@
+// Copyright © 2021 Cisco
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// All rights reserved.
+
+package election
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/metrics"
+	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/openapi"
+	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/queue"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+const (
+	// BackendEtcd elects the leader with a lease on etcd.
+	BackendEtcd string = "etcd"
+	// BackendKubernetes elects the leader with a Kubernetes Lease.
+	BackendKubernetes string = "kubernetes"
+	// BackendFile elects the leader with a lock on a local file, for
+	// instances running on the same machine.
+	BackendFile string = "file"
+
+	// DefaultName is the name of the etcd key or of the Kubernetes Lease,
+	// if not set.
+	DefaultName string = "cnwan-reader"
+	// DefaultLeaseDuration is the time after which another instance
+	// becomes the leader if the current one stops renewing its lease.
+	DefaultLeaseDuration time.Duration = 15 * time.Second
+)
+
+// Elector elects one leader among the instances that use the same lock.
+type Elector interface {
+	// Run campaigns to become the leader until ctx is done. Whenever this
+	// instance becomes the leader, lead is called with a context that is
+	// done as soon as it is not the leader anymore, and it must return
+	// then. After that, Run campaigns again.
+	Run(ctx context.Context, lead func(ctx context.Context))
+}
+
+// Options contains settings about how to elect the leader.
+type Options struct {
+	// Backend used to elect the leader: BackendEtcd, BackendKubernetes or
+	// BackendFile
+	Backend string
+	// Name of the etcd key or of the Kubernetes Lease.
+	// If empty, DefaultName is used
+	Name string
+	// Namespace of the Kubernetes Lease. If empty, the namespace of the
+	// pod is used
+	Namespace string
+	// File to lock with BackendFile. If empty, cnwan-reader.lock in the
+	// temporary directory is used
+	File string
+	// LeaseDuration is the time after which another instance becomes the
+	// leader if the current one stops renewing its lease.
+	// If 0, DefaultLeaseDuration is used
+	LeaseDuration time.Duration
+	// Identity of this instance, shown as the holder of the lock.
+	// If empty, the hostname followed by a random suffix is used
+	Identity string
+}
+
+// New returns an Elector that uses the backend defined by opts.
+// cli is only used with BackendEtcd, so that the same client used to watch
+// the service registry is used to elect the leader.
+func New(opts *Options, cli *clientv3.Client) (Elector, error) {
+	if opts == nil {
+		return nil, fmt.Errorf("no leader election options provided")
+	}
+
+	o := *opts
+	if len(o.Name) == 0 {
+		o.Name = DefaultName
+	}
+	if len(o.File) == 0 {
+		o.File = filepath.Join(os.TempDir(), DefaultName+".lock")
+	}
+	if o.LeaseDuration <= 0 {
+		o.LeaseDuration = DefaultLeaseDuration
+	}
+	if len(o.Identity) == 0 {
+		hostname, _ := os.Hostname()
+		o.Identity = fmt.Sprintf("%s_%s", hostname, uuid.New().String()[:8])
+	}
+
+	switch o.Backend {
+	case BackendEtcd:
+		if cli == nil {
+			return nil, fmt.Errorf("etcd leader election is only available when watching etcd")
+		}
+		return newEtcdElector(cli, &o)
+	case BackendKubernetes:
+		return newKubernetesElector(&o)
+	case BackendFile:
+		return newFileElector(&o)
+	default:
+		return nil, fmt.Errorf("unsupported leader election backend: %s", o.Backend)
+	}
+}
+
+// LeaderQueue is a queue that only sends data while this instance is the
+// leader. Data received by standby instances is discarded, since they only
+// keep their state up to date.
+type LeaderQueue struct {
+	newQueue func(ctx context.Context) queue.Queue
+	lock     sync.RWMutex
+	// queue is only set while this instance is the leader
+	queue queue.Queue
+}
+
+// NewLeaderQueue returns a LeaderQueue that sends data to a queue returned by
+// newQueue. It doesn't send anything until it becomes the leader: look at
+// Campaign.
+//
+// A new queue is created every time this instance becomes the leader, with a
+// context that is done as soon as it is not the leader anymore. This way,
+// data that the queue is still sending or retrying is dropped, and only the
+// new leader sends it.
+func NewLeaderQueue(newQueue func(ctx context.Context) queue.Queue) *LeaderQueue {
+	return &LeaderQueue{newQueue: newQueue}
+}
+
+// Campaign campaigns to become the leader with elector until ctx is done.
+// Whenever this instance becomes the leader, resync is called to send the
+// full current state, so that the changes occurred during the failover are
+// not missed.
+func (l *LeaderQueue) Campaign(ctx context.Context, elector Elector, resync func(context.Context)) {
+	metrics.Leader.Set(0)
+
+	elector.Run(ctx, func(leadCtx context.Context) {
+		log.Info().Msg("became the leader: sending the current state...")
+		l.setQueue(l.newQueue(leadCtx))
+		metrics.Leader.Set(1)
+
+		resync(leadCtx)
+		<-leadCtx.Done()
+
+		l.setQueue(nil)
+		metrics.Leader.Set(0)
+		if ctx.Err() == nil {
+			log.Warn().Msg("not the leader anymore: standing by...")
+		}
+	})
+}
+
+func (l *LeaderQueue) setQueue(q queue.Queue) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.queue = q
+}
+
+// Enqueue sends the events to the queue, if this instance is the leader.
+func (l *LeaderQueue) Enqueue(ctx context.Context, events map[string]*openapi.Event) {
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+
+	if l.queue != nil {
+		l.queue.Enqueue(ctx, events)
+	}
+}
+
+// Sync sends the current state to the queue, if this instance is the
+// leader.
+func (l *LeaderQueue) Sync(servs []openapi.Service) {
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+
+	if l.queue != nil {
+		l.queue.Sync(servs)
+	}
+}
+
+// wait waits for d or until ctx is done, and returns false in the latter
+// case.
+func wait(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,217 @@
+// Copyright © 2021 Cisco
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// All rights reserved.
+
+package election
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/metrics"
+	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/openapi"
+	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/queue"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNew(t *testing.T) {
+	a := assert.New(t)
+
+	cases := []struct {
+		opts   *Options
+		expErr error
+	}{
+		{
+			expErr: fmt.Errorf("no leader election options provided"),
+		},
+		{
+			opts:   &Options{},
+			expErr: fmt.Errorf("unsupported leader election backend: "),
+		},
+		{
+			opts:   &Options{Backend: "zookeeper"},
+			expErr: fmt.Errorf("unsupported leader election backend: zookeeper"),
+		},
+		{
+			opts:   &Options{Backend: BackendEtcd},
+			expErr: fmt.Errorf("etcd leader election is only available when watching etcd"),
+		},
+		{
+			opts: &Options{Backend: BackendFile, File: path.Join(t.TempDir(), "test.lock")},
+		},
+	}
+
+	failed := func(i int) {
+		a.FailNow("case failed", fmt.Sprintf("case %d", i))
+	}
+	for i, currCase := range cases {
+		elector, err := New(currCase.opts, nil)
+		if !a.Equal(currCase.expErr, err) || !a.Equal(err == nil, elector != nil) {
+			failed(i)
+		}
+	}
+}
+
+type fakeElector struct {
+	leading chan context.CancelFunc
+}
+
+func (f *fakeElector) Run(ctx context.Context, lead func(context.Context)) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case stop := <-f.leading:
+			leadCtx, leadCanc := context.WithCancel(ctx)
+			go func() {
+				stop()
+				leadCanc()
+			}()
+			lead(leadCtx)
+		}
+	}
+}
+
+type fakeQueue struct {
+	lock   sync.Mutex
+	events []string
+	syncs  int
+}
+
+func (f *fakeQueue) Enqueue(ctx context.Context, events map[string]*openapi.Event) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	for key := range events {
+		f.events = append(f.events, key)
+	}
+}
+
+func (f *fakeQueue) Sync(servs []openapi.Service) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.syncs++
+}
+
+func (f *fakeQueue) get() ([]string, int) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return append([]string{}, f.events...), f.syncs
+}
+
+func TestLeaderQueue(t *testing.T) {
+	a := assert.New(t)
+	ctx, canc := context.WithCancel(context.Background())
+	defer canc()
+
+	elector := &fakeElector{leading: make(chan context.CancelFunc)}
+	q := &fakeQueue{}
+	terms := make(chan context.Context, 1)
+	resynced := make(chan bool, 1)
+	lq := NewLeaderQueue(func(termCtx context.Context) queue.Queue {
+		terms <- termCtx
+		return q
+	})
+	go lq.Campaign(ctx, elector, func(context.Context) {
+		lq.Sync(nil)
+		resynced <- true
+	})
+
+	// Standbys don't send anything
+	lq.Enqueue(ctx, map[string]*openapi.Event{"standby": {}})
+	lq.Sync(nil)
+	events, syncs := q.get()
+	a.Empty(events)
+	a.Zero(syncs)
+	a.Zero(testutil.ToFloat64(metrics.Leader))
+
+	// The state is sent as soon as it becomes the leader
+	stopLeading := make(chan bool)
+	elector.leading <- func() { <-stopLeading }
+	select {
+	case <-resynced:
+	case <-time.After(time.Second):
+		a.FailNow("the state should have been sent")
+	}
+	termCtx := <-terms
+	lq.Enqueue(ctx, map[string]*openapi.Event{"leader": {}})
+	events, syncs = q.get()
+	a.Equal([]string{"leader"}, events)
+	a.Equal(1, syncs)
+	a.Equal(float64(1), testutil.ToFloat64(metrics.Leader))
+
+	// Then it stands by again
+	close(stopLeading)
+	for i := 0; i < 100 && testutil.ToFloat64(metrics.Leader) == 1; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	lq.Enqueue(ctx, map[string]*openapi.Event{"standby-again": {}})
+	events, _ = q.get()
+	a.Equal([]string{"leader"}, events)
+	a.Zero(testutil.ToFloat64(metrics.Leader))
+
+	// The queue of the term is stopped, so it doesn't send what it had
+	// left
+	a.Error(termCtx.Err())
+}
+
+// testElection runs two electors, makes sure only one of them is the leader
+// at any time and that the other one takes over when the leader stops.
+func testElection(t *testing.T, first, second Elector) {
+	a := assert.New(t)
+
+	leaders := make(chan string, 2)
+	run := func(ctx context.Context, elector Elector, name string) {
+		elector.Run(ctx, func(leadCtx context.Context) {
+			leaders <- name
+			<-leadCtx.Done()
+		})
+	}
+
+	firstCtx, firstCanc := context.WithCancel(context.Background())
+	defer firstCanc()
+	go run(firstCtx, first, "first")
+
+	select {
+	case leader := <-leaders:
+		a.Equal("first", leader)
+	case <-time.After(10 * time.Second):
+		a.FailNow("first elector should have become the leader")
+	}
+
+	secondCtx, secondCanc := context.WithCancel(context.Background())
+	defer secondCanc()
+	go run(secondCtx, second, "second")
+
+	select {
+	case leader := <-leaders:
+		a.FailNow("there should be only one leader", leader)
+	case <-time.After(500 * time.Millisecond):
+	}
+
+	firstCanc()
+	select {
+	case leader := <-leaders:
+		a.Equal("second", leader)
+	case <-time.After(10 * time.Second):
+		a.FailNow("second elector should have become the leader")
+	}
+}
@@ -0,0 +1,96 @@
+// Copyright © 2021 Cisco
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// All rights reserved.
+
+package election
+
+import (
+	"context"
+	"path"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/client/v3/concurrency"
+)
+
+type etcdElector struct {
+	cli      *clientv3.Client
+	prefix   string
+	identity string
+	ttl      int
+	retry    time.Duration
+}
+
+func newEtcdElector(cli *clientv3.Client, opts *Options) (Elector, error) {
+	ttl := int(opts.LeaseDuration.Seconds())
+	if ttl < 1 {
+		ttl = 1
+	}
+
+	return &etcdElector{
+		cli:      cli,
+		prefix:   path.Join("/", opts.Name, "leader"),
+		identity: opts.Identity,
+		ttl:      ttl,
+		retry:    opts.LeaseDuration / 5,
+	}, nil
+}
+
+// Run campaigns to become the leader with a lease on etcd, which is kept
+// alive as long as the session is.
+func (e *etcdElector) Run(ctx context.Context, lead func(context.Context)) {
+	l := log.With().Str("func", "election.etcdElector.Run").Str("identity", e.identity).Logger()
+
+	for ctx.Err() == nil {
+		session, err := concurrency.NewSession(e.cli, concurrency.WithTTL(e.ttl), concurrency.WithContext(ctx))
+		if err != nil {
+			l.Err(err).Msg("error while creating the etcd session, retrying...")
+			wait(ctx, e.retry)
+			continue
+		}
+
+		election := concurrency.NewElection(session, e.prefix)
+		if err := election.Campaign(ctx, e.identity); err != nil {
+			if ctx.Err() == nil {
+				l.Err(err).Msg("error while campaigning, retrying...")
+			}
+			session.Close()
+			wait(ctx, e.retry)
+			continue
+		}
+
+		leadCtx, leadCanc := context.WithCancel(ctx)
+		go func() {
+			select {
+			case <-session.Done():
+				// The lease expired, e.g. because etcd was unreachable
+			case <-leadCtx.Done():
+			}
+			leadCanc()
+		}()
+		lead(leadCtx)
+		leadCanc()
+
+		// Let the others know immediately, rather than when the lease
+		// expires
+		resignCtx, resignCanc := context.WithTimeout(context.Background(), e.retry)
+		election.Resign(resignCtx)
+		resignCanc()
+		session.Close()
+	}
+}
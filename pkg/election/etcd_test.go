@@ -0,0 +1,101 @@
+// Copyright © 2021 Cisco
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// All rights reserved.
+
+package election
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/server/v3/embed"
+)
+
+func TestEtcdElector(t *testing.T) {
+	a := assert.New(t)
+	e, endpoint, err := startTestEtcd(t.TempDir())
+	if !a.NoError(err) {
+		return
+	}
+	defer e.Close()
+
+	newClient := func() *clientv3.Client {
+		cli, err := clientv3.New(clientv3.Config{Endpoints: []string{endpoint}, DialTimeout: 5 * time.Second})
+		if !a.NoError(err) {
+			a.FailNow("could not connect to etcd")
+		}
+		return cli
+	}
+	firstCli, secondCli := newClient(), newClient()
+	defer firstCli.Close()
+	defer secondCli.Close()
+
+	first, _ := New(&Options{Backend: BackendEtcd, LeaseDuration: 5 * time.Second, Identity: "first"}, firstCli)
+	second, _ := New(&Options{Backend: BackendEtcd, LeaseDuration: 5 * time.Second, Identity: "second"}, secondCli)
+	testElection(t, first, second)
+}
+
+// startTestEtcd starts an embedded etcd server.
+func startTestEtcd(dir string) (*embed.Etcd, string, error) {
+	freePort := func() (int, error) {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			return 0, err
+		}
+		defer l.Close()
+		return l.Addr().(*net.TCPAddr).Port, nil
+	}
+
+	clientPort, err := freePort()
+	if err != nil {
+		return nil, "", err
+	}
+	peerPort, err := freePort()
+	if err != nil {
+		return nil, "", err
+	}
+
+	clientURL, _ := url.Parse(fmt.Sprintf("http://127.0.0.1:%d", clientPort))
+	peerURL, _ := url.Parse(fmt.Sprintf("http://127.0.0.1:%d", peerPort))
+
+	cfg := embed.NewConfig()
+	cfg.Dir = path.Join(dir, "data")
+	cfg.LogLevel = "error"
+	cfg.LCUrls, cfg.ACUrls = []url.URL{*clientURL}, []url.URL{*clientURL}
+	cfg.LPUrls, cfg.APUrls = []url.URL{*peerURL}, []url.URL{*peerURL}
+	cfg.InitialCluster = cfg.InitialClusterFromName(cfg.Name)
+
+	e, err := embed.StartEtcd(cfg)
+	if err != nil {
+		return nil, "", err
+	}
+
+	select {
+	case <-e.Server.ReadyNotify():
+	case <-time.After(30 * time.Second):
+		e.Close()
+		return nil, "", fmt.Errorf("embedded etcd took too long to start")
+	}
+
+	return e, clientURL.Host, nil
+}
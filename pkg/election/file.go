@@ -0,0 +1,89 @@
+// Copyright © 2021 Cisco
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// All rights reserved.
+
+//go:build !windows
+// +build !windows
+
+package election
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+type fileElector struct {
+	path     string
+	identity string
+	retry    time.Duration
+}
+
+func newFileElector(opts *Options) (Elector, error) {
+	return &fileElector{
+		path:     opts.File,
+		identity: opts.Identity,
+		retry:    opts.LeaseDuration / 5,
+	}, nil
+}
+
+// Run campaigns to become the leader by locking the file. The lock is
+// released by the operating system if the process exits, so this instance
+// is the leader until ctx is done.
+func (f *fileElector) Run(ctx context.Context, lead func(context.Context)) {
+	l := log.With().Str("func", "election.fileElector.Run").Str("file", f.path).Logger()
+
+	for ctx.Err() == nil {
+		file, err := f.lock()
+		if err != nil {
+			if !errors.Is(err, syscall.EWOULDBLOCK) {
+				l.Err(err).Msg("error while locking the file, retrying...")
+			}
+			wait(ctx, f.retry)
+			continue
+		}
+
+		lead(ctx)
+
+		syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+		file.Close()
+	}
+}
+
+// lock locks the file and writes the identity of this instance in it.
+func (f *fileElector) lock() (*os.File, error) {
+	file, err := os.OpenFile(f.path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	// This is only informative, so errors are not important
+	file.Truncate(0)
+	fmt.Fprintln(file, f.identity)
+
+	return file, nil
+}
@@ -0,0 +1,44 @@
+// Copyright © 2021 Cisco
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// All rights reserved.
+
+//go:build !windows
+// +build !windows
+
+package election
+
+import (
+	"io/ioutil"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileElector(t *testing.T) {
+	a := assert.New(t)
+	lockPath := path.Join(t.TempDir(), "test.lock")
+
+	first, _ := New(&Options{Backend: BackendFile, File: lockPath, LeaseDuration: 500 * time.Millisecond, Identity: "first"}, nil)
+	second, _ := New(&Options{Backend: BackendFile, File: lockPath, LeaseDuration: 500 * time.Millisecond, Identity: "second"}, nil)
+	testElection(t, first, second)
+
+	content, _ := ioutil.ReadFile(lockPath)
+	a.Equal("second", strings.TrimSpace(string(content)))
+}
@@ -16,14 +16,13 @@
 //
 // All rights reserved.
 
-package etcd
+//go:build windows
+// +build windows
 
-import "github.com/CloudNativeSDWAN/cnwan-reader/pkg/openapi"
+package election
 
-type fakeQ struct {
-	_enqueue func(map[string]*openapi.Event)
-}
+import "fmt"
 
-func (f *fakeQ) Enqueue(m map[string]*openapi.Event) {
-	f._enqueue(m)
+func newFileElector(opts *Options) (Elector, error) {
+	return nil, fmt.Errorf("file leader election is not supported on windows")
 }
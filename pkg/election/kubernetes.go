@@ -0,0 +1,114 @@
+// Copyright © 2021 Cisco
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// All rights reserved.
+
+package election
+
+import (
+	"context"
+	"io/ioutil"
+	"strings"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	coordinationv1 "k8s.io/client-go/kubernetes/typed/coordination/v1"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+)
+
+const (
+	// namespaceFile contains the namespace of the pod.
+	namespaceFile string = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+)
+
+type kubernetesElector struct {
+	config leaderelection.LeaderElectionConfig
+}
+
+func newKubernetesElector(opts *Options) (Elector, error) {
+	cfg, err := rest.InClusterConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	cli, err := coordinationv1.NewForConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return newKubernetesElectorWithClient(cli, opts), nil
+}
+
+func newKubernetesElectorWithClient(cli coordinationv1.LeasesGetter, opts *Options) *kubernetesElector {
+	namespace := opts.Namespace
+	if len(namespace) == 0 {
+		namespace = "default"
+		if ns, err := ioutil.ReadFile(namespaceFile); err == nil && len(strings.TrimSpace(string(ns))) > 0 {
+			namespace = strings.TrimSpace(string(ns))
+		}
+	}
+
+	return &kubernetesElector{
+		config: leaderelection.LeaderElectionConfig{
+			Lock: &resourcelock.LeaseLock{
+				LeaseMeta: metav1.ObjectMeta{
+					Name:      opts.Name,
+					Namespace: namespace,
+				},
+				Client:     cli,
+				LockConfig: resourcelock.ResourceLockConfig{Identity: opts.Identity},
+			},
+			LeaseDuration: opts.LeaseDuration,
+			// Same proportions as the Kubernetes controllers
+			RenewDeadline:   opts.LeaseDuration * 2 / 3,
+			RetryPeriod:     opts.LeaseDuration / 5,
+			ReleaseOnCancel: true,
+			Name:            opts.Name,
+		},
+	}
+}
+
+// Run campaigns to become the leader by acquiring a Kubernetes Lease, which
+// is renewed as long as this instance is the leader.
+func (k *kubernetesElector) Run(ctx context.Context, lead func(context.Context)) {
+	// lead is called in its own goroutine: make sure that it has returned
+	// before it is called again
+	var leadLock sync.Mutex
+
+	config := k.config
+	config.Callbacks = leaderelection.LeaderCallbacks{
+		OnStartedLeading: func(leadCtx context.Context) {
+			leadLock.Lock()
+			defer leadLock.Unlock()
+			lead(leadCtx)
+		},
+		OnStoppedLeading: func() {},
+	}
+
+	for ctx.Err() == nil {
+		elector, err := leaderelection.NewLeaderElector(config)
+		if err != nil {
+			log.Err(err).Str("func", "election.kubernetesElector.Run").Msg("invalid leader election settings")
+			return
+		}
+
+		// It returns when the lease is lost or ctx is done
+		elector.Run(ctx)
+	}
+}
@@ -0,0 +1,56 @@
+// Copyright © 2021 Cisco
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// All rights reserved.
+
+package election
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	coordinationapi "k8s.io/api/coordination/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/serializer"
+	"k8s.io/client-go/kubernetes/typed/coordination/v1/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestKubernetesElector(t *testing.T) {
+	a := assert.New(t)
+
+	scheme := runtime.NewScheme()
+	if !a.NoError(coordinationapi.AddToScheme(scheme)) {
+		return
+	}
+	tracker := k8stesting.NewObjectTracker(scheme, serializer.NewCodecFactory(scheme).UniversalDecoder())
+	cli := &fake.FakeCoordinationV1{Fake: &k8stesting.Fake{}}
+	cli.AddReactor("*", "*", k8stesting.ObjectReaction(tracker))
+
+	opts := &Options{Name: "test-lease", Namespace: "test-ns", LeaseDuration: 1500 * time.Millisecond, Identity: "first"}
+	first := newKubernetesElectorWithClient(cli, opts)
+	opts.Identity = "second"
+	second := newKubernetesElectorWithClient(cli, opts)
+	testElection(t, first, second)
+
+	lease, err := cli.Leases("test-ns").Get(context.Background(), "test-lease", metav1.GetOptions{})
+	if a.NoError(err) && a.NotNil(lease.Spec.HolderIdentity) {
+		a.Equal("second", *lease.Spec.HolderIdentity)
+	}
+}
@@ -0,0 +1,205 @@
+// Copyright © 2021 Cisco
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// All rights reserved.
+
+package health
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Checker is told about the state of the service registry and of the loop
+// that observes it, and uses it to tell whether the program is alive and
+// ready.
+type Checker struct {
+	lock sync.Mutex
+	// ready is true once the initial state has been loaded
+	ready bool
+	// polls contains the state of each service registry that is polled,
+	// keyed by its name
+	polls map[string]*pollState
+	// stopErr is the reason why the loop stopped, if it did
+	stopErr error
+	// connCheck tells whether the connection to the service registry is
+	// alive, if it can be checked
+	connCheck func() error
+	now       func() time.Time
+}
+
+type pollState struct {
+	// last is the time of the last successful poll
+	last time.Time
+	// err is the error of the last poll, if it failed
+	err error
+}
+
+// New returns a checker that is alive but not ready.
+func New() *Checker {
+	return &Checker{polls: map[string]*pollState{}, now: time.Now}
+}
+
+// SetReady records that the initial state of the service registry has been
+// loaded.
+func (c *Checker) SetReady() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.ready = true
+}
+
+// PollSucceeded records that the service registry with the given name has
+// just been polled.
+func (c *Checker) PollSucceeded(name string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.polls[name] = &pollState{last: c.now()}
+}
+
+// PollFailed records that the service registry with the given name could not
+// be polled, which means that it is not reachable until its next poll
+// succeeds.
+func (c *Checker) PollFailed(name string, err error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	state, exists := c.polls[name]
+	if !exists {
+		state = &pollState{last: c.now()}
+		c.polls[name] = state
+	}
+	state.err = err
+}
+
+// sortedPolls returns the names of the polled service registries, sorted, so
+// that errors are always reported in the same order. It must be called with
+// the lock held.
+func (c *Checker) sortedPolls() []string {
+	names := make([]string, 0, len(c.polls))
+	for name := range c.polls {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// Stopped records that the loop that observes the service registry has
+// stopped, although the program is still running.
+func (c *Checker) Stopped(err error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.stopErr = err
+}
+
+// SetConnectionCheck sets the function that tells whether the connection to
+// the service registry is alive, for registries that are not polled.
+func (c *Checker) SetConnectionCheck(check func() error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.connCheck = check
+}
+
+// Live returns an error if the loop that observes the service registry has
+// stopped or, if threshold is greater than 0, if the last successful poll of
+// any of the polled service registries is older than threshold.
+func (c *Checker) Live(threshold time.Duration) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.stopErr != nil {
+		return fmt.Errorf("stopped observing the service registry: %w", c.stopErr)
+	}
+
+	if threshold <= 0 {
+		return nil
+	}
+
+	for _, name := range c.sortedPolls() {
+		if elapsed := c.now().Sub(c.polls[name].last); elapsed > threshold {
+			return fmt.Errorf("last successful poll of %s was %s ago", name, elapsed.Round(time.Second))
+		}
+	}
+
+	return nil
+}
+
+// Ready returns an error if the initial state has not been loaded yet or
+// the service registry is not reachable.
+func (c *Checker) Ready() error {
+	connCheck, err := func() (func() error, error) {
+		c.lock.Lock()
+		defer c.lock.Unlock()
+
+		switch {
+		case c.stopErr != nil:
+			return nil, fmt.Errorf("stopped observing the service registry: %w", c.stopErr)
+		case !c.ready:
+			return nil, errors.New("initial state has not been loaded yet")
+		}
+
+		for _, name := range c.sortedPolls() {
+			if err := c.polls[name].err; err != nil {
+				return nil, fmt.Errorf("service registry %s is not reachable: %w", name, err)
+			}
+		}
+
+		return c.connCheck, nil
+	}()
+	if err != nil {
+		return err
+	}
+
+	// The check may take a while, so it must not hold up the others
+	if connCheck != nil {
+		if err := connCheck(); err != nil {
+			return fmt.Errorf("service registry is not reachable: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// LivenessHandler returns an http.Handler that responds with 200 if the
+// program is alive, or with 503 otherwise. Look at Live.
+func (c *Checker) LivenessHandler(threshold time.Duration) http.Handler {
+	return probeHandler(func() error {
+		return c.Live(threshold)
+	})
+}
+
+// ReadinessHandler returns an http.Handler that responds with 200 if the
+// program is ready, or with 503 otherwise. Look at Ready.
+func (c *Checker) ReadinessHandler() http.Handler {
+	return probeHandler(c.Ready)
+}
+
+func probeHandler(probe func() error) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		if err := probe(); err != nil {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			fmt.Fprintln(w, err)
+			return
+		}
+
+		fmt.Fprintln(w, "ok")
+	})
+}
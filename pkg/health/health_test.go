@@ -0,0 +1,189 @@
+// Copyright © 2021 Cisco
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// All rights reserved.
+
+package health
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChecker(t *testing.T) {
+	a := assert.New(t)
+	start := time.Date(2021, 6, 10, 9, 30, 0, 0, time.UTC)
+
+	cases := []struct {
+		setup    func(c *Checker)
+		elapsed  time.Duration
+		expLive  error
+		expReady error
+	}{
+		{
+			setup:    func(c *Checker) {},
+			expReady: errors.New("initial state has not been loaded yet"),
+		},
+		{
+			setup: func(c *Checker) {
+				c.SetReady()
+			},
+			elapsed: time.Hour,
+		},
+		{
+			setup: func(c *Checker) {
+				c.SetReady()
+				c.PollSucceeded("cloudmap")
+			},
+			elapsed: 30 * time.Second,
+		},
+		{
+			setup: func(c *Checker) {
+				c.SetReady()
+				c.PollSucceeded("cloudmap")
+			},
+			elapsed: 2 * time.Minute,
+			expLive: errors.New("last successful poll of cloudmap was 2m0s ago"),
+		},
+		{
+			setup: func(c *Checker) {
+				c.SetReady()
+				c.PollSucceeded("cloudmap")
+				c.PollFailed("cloudmap", errors.New("timeout"))
+			},
+			expReady: fmt.Errorf("service registry cloudmap is not reachable: %w", errors.New("timeout")),
+		},
+		{
+			setup: func(c *Checker) {
+				c.SetReady()
+				c.PollFailed("cloudmap", errors.New("timeout"))
+				c.PollSucceeded("cloudmap")
+			},
+		},
+		{
+			setup: func(c *Checker) {
+				c.SetReady()
+				c.PollFailed("cloudmap", errors.New("timeout"))
+				c.PollSucceeded("servicedirectory")
+			},
+			expReady: fmt.Errorf("service registry cloudmap is not reachable: %w", errors.New("timeout")),
+		},
+		{
+			setup: func(c *Checker) {
+				c.SetReady()
+				c.PollSucceeded("cloudmap")
+				c.PollFailed("servicedirectory", errors.New("timeout"))
+			},
+			elapsed:  2 * time.Minute,
+			expLive:  errors.New("last successful poll of cloudmap was 2m0s ago"),
+			expReady: fmt.Errorf("service registry servicedirectory is not reachable: %w", errors.New("timeout")),
+		},
+		{
+			setup: func(c *Checker) {
+				c.SetReady()
+				c.SetConnectionCheck(func() error {
+					return errors.New("connection lost")
+				})
+			},
+			expReady: fmt.Errorf("service registry is not reachable: %w", errors.New("connection lost")),
+		},
+		{
+			setup: func(c *Checker) {
+				c.SetReady()
+				c.Stopped(errors.New("watch channel closed"))
+			},
+			expLive:  fmt.Errorf("stopped observing the service registry: %w", errors.New("watch channel closed")),
+			expReady: fmt.Errorf("stopped observing the service registry: %w", errors.New("watch channel closed")),
+		},
+	}
+
+	failed := func(i int) {
+		a.FailNow("case failed", fmt.Sprintf("case %d", i))
+	}
+	for i, currCase := range cases {
+		now := start
+		c := New()
+		c.now = func() time.Time { return now }
+		currCase.setup(c)
+		now = now.Add(currCase.elapsed)
+
+		if !a.Equal(currCase.expLive, c.Live(time.Minute)) || !a.Equal(currCase.expReady, c.Ready()) {
+			failed(i)
+		}
+	}
+}
+
+func TestSlowConnectionCheck(t *testing.T) {
+	a := assert.New(t)
+	c := New()
+	c.SetReady()
+
+	checking, unblock := make(chan bool), make(chan bool)
+	c.SetConnectionCheck(func() error {
+		checking <- true
+		<-unblock
+		return nil
+	})
+	ready := make(chan error)
+	go func() {
+		ready <- c.Ready()
+	}()
+	<-checking
+
+	// The others are not held up while the connection is checked
+	done := make(chan bool)
+	go func() {
+		c.PollSucceeded("cloudmap")
+		c.PollFailed("servicedirectory", errors.New("unreachable"))
+		a.NoError(c.Live(0))
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		a.Fail("the checker should not be locked")
+	}
+
+	close(unblock)
+	a.NoError(<-ready)
+	a.Error(c.Ready())
+}
+
+func TestHandlers(t *testing.T) {
+	a := assert.New(t)
+	c := New()
+
+	rec := httptest.NewRecorder()
+	c.ReadinessHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	a.Equal(http.StatusServiceUnavailable, rec.Code)
+	a.Equal("initial state has not been loaded yet\n", rec.Body.String())
+
+	c.SetReady()
+	rec = httptest.NewRecorder()
+	c.ReadinessHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	a.Equal(http.StatusOK, rec.Code)
+	a.Equal("ok\n", rec.Body.String())
+
+	rec = httptest.NewRecorder()
+	c.LivenessHandler(0).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	a.Equal(http.StatusOK, rec.Code)
+}
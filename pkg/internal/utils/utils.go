@@ -19,12 +19,22 @@
 package utils
 
 import (
+	"context"
 	"fmt"
+	"net"
 	"net/url"
 	"os"
 	"strings"
+	"time"
 
+	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/audit"
 	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/configuration"
+	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/election"
+	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/health"
+	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/queue"
+	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/reader"
+	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/server"
+	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/services"
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/cobra"
 )
@@ -64,6 +74,14 @@ func MapContainsKeys(subject map[string]string, targets []string) bool {
 	return foundKeys == len(targets)
 }
 
+// EndpointID returns the identity of an endpoint, which is built from the
+// names of its namespace, its service and its own name.
+// The same endpoint always has the same identity, no matter where and when it
+// was found, so this can be used to correlate events about the same endpoint.
+func EndpointID(nsName, servName, endpName string) string {
+	return strings.Join([]string{nsName, servName, endpName}, "/")
+}
+
 // GetAdaptorEndpointFromFlags gets the value of --adaptor-api or returns an
 // error in case it is not valid.
 func GetAdaptorEndpointFromFlags(cmd *cobra.Command) (string, error) {
@@ -77,30 +95,517 @@ func GetAdaptorEndpointFromFlags(cmd *cobra.Command) (string, error) {
 		}
 	}
 
-	_endp := fmt.Sprintf("http://%s", endp)
-	if _, err := url.ParseRequestURI(_endp); err != nil {
+	return parseAdaptorEndpoint(endp)
+}
+
+// parseAdaptorEndpoint returns the endpoint without the http:// scheme, as
+// it is the default one, or an error in case it is not valid.
+// Endpoints of sinks other than http and https are returned as they are.
+func parseAdaptorEndpoint(endp string) (string, error) {
+	if i := strings.Index(endp, "://"); i >= 0 {
+		switch endp[:i] {
+		case "http", "https":
+		default:
+			// Other sinks, e.g. stdout://, parse the endpoint themselves
+			return endp, nil
+		}
+	}
+
+	scheme := "http://"
+	if strings.HasPrefix(endp, "https://") {
+		scheme = "https://"
+	}
+	endp = strings.TrimPrefix(strings.TrimPrefix(endp, "https://"), "http://")
+
+	if _, err := url.ParseRequestURI(scheme + endp); err != nil {
 		return "", err
 	}
 
 	if strings.HasPrefix(endp, "localhost") {
-		return SanitizeLocalhost(endp)
+		_endp, err := SanitizeLocalhost(endp)
+		if err != nil {
+			return "", err
+		}
+		endp = _endp
+	}
+
+	if scheme == "https://" {
+		return scheme + endp, nil
 	}
 
 	return endp, nil
 }
 
-// GetDebugModeFromFlags gets the value of --debug flag
-func GetDebugModeFromFlags(cmd *cobra.Command) bool {
-	if cmd.Flags().Changed("debug") {
-		_debug, _ := cmd.Flags().GetBool("debug")
-		return _debug
+// GetAPIVersionFromFlags gets the value of --api-version or returns an error
+// in case it is not a supported version.
+func GetAPIVersionFromFlags(cmd *cobra.Command) (string, error) {
+	apiVersion := "v1"
+
+	if cmd.Flags().Changed("api-version") {
+		apiVersion, _ = cmd.Flags().GetString("api-version")
+	} else {
+		if conf := configuration.GetConfigFile(); conf != nil && len(conf.APIVersion) > 0 {
+			apiVersion = conf.APIVersion
+		}
+	}
+
+	if apiVersion != "v1" && apiVersion != "v2" {
+		return "", fmt.Errorf("unsupported api version: %s", apiVersion)
+	}
+
+	return apiVersion, nil
+}
+
+// GetEventFormatFromFlags gets the value of --event-format
+func GetEventFormatFromFlags(cmd *cobra.Command) string {
+	if cmd.Flags().Changed("event-format") {
+		format, _ := cmd.Flags().GetString("event-format")
+		return format
+	}
+
+	if conf := configuration.GetConfigFile(); conf != nil && len(conf.EventFormat) > 0 {
+		return conf.EventFormat
+	}
+
+	return "openapi"
+}
+
+// GetAdaptorAuthFromFlags gets the credentials to authenticate to the adaptor
+// with, from the --adaptor-* flags or the configuration file.
+// It returns nil if no credentials are set.
+func GetAdaptorAuthFromFlags(cmd *cobra.Command) *services.AuthOptions {
+	authConf := &configuration.AdaptorAuthConfig{}
+	if conf := configuration.GetConfigFile(); conf != nil && conf.AdaptorAuth != nil {
+		authConf = conf.AdaptorAuth
+	}
+
+	getString := func(flag, confValue string) string {
+		if cmd.Flags().Changed(flag) {
+			val, _ := cmd.Flags().GetString(flag)
+			return val
+		}
+
+		if len(confValue) > 0 {
+			return confValue
+		}
+
+		val, _ := cmd.Flags().GetString(flag)
+		return val
+	}
+
+	auth := &services.AuthOptions{
+		BearerTokenFile: getString("adaptor-token-file", authConf.TokenFile),
+		Username:        getString("adaptor-username", authConf.Username),
+		Password:        getString("adaptor-password", authConf.Password),
+		APIKey:          getString("adaptor-api-key", authConf.APIKey),
+		APIKeyHeader:    getString("adaptor-api-key-header", authConf.APIKeyHeader),
+	}
+
+	if len(auth.BearerTokenFile) == 0 && len(auth.Username) == 0 &&
+		len(auth.Password) == 0 && len(auth.APIKey) == 0 {
+		return nil
+	}
+
+	return auth
+}
+
+// GetAdaptorHeadersFromFlags gets the headers to include in every request to
+// the adaptor from --adaptor-header or the configuration file.
+func GetAdaptorHeadersFromFlags(cmd *cobra.Command) map[string]string {
+	if cmd.Flags().Changed("adaptor-header") {
+		headers, _ := cmd.Flags().GetStringToString("adaptor-header")
+		return headers
+	}
+
+	if conf := configuration.GetConfigFile(); conf != nil && len(conf.AdaptorHeaders) > 0 {
+		return conf.AdaptorHeaders
+	}
+
+	return map[string]string{}
+}
+
+// GetAdaptorTLSFromFlags gets the settings about how to establish a secure
+// connection to the adaptor, from the --adaptor-* flags or the configuration
+// file. It returns nil if none are set.
+func GetAdaptorTLSFromFlags(cmd *cobra.Command) *services.TLSOptions {
+	tlsConf := &configuration.AdaptorTLSConfig{}
+	if conf := configuration.GetConfigFile(); conf != nil && conf.AdaptorTLS != nil {
+		tlsConf = conf.AdaptorTLS
+	}
+
+	getString := func(flag, confValue string) string {
+		if !cmd.Flags().Changed(flag) && len(confValue) > 0 {
+			return confValue
+		}
+
+		val, _ := cmd.Flags().GetString(flag)
+		return val
+	}
+
+	tlsOpts := &services.TLSOptions{
+		CACert:     getString("adaptor-ca-cert", tlsConf.CACert),
+		ClientCert: getString("adaptor-client-cert", tlsConf.ClientCert),
+		ClientKey:  getString("adaptor-client-key", tlsConf.ClientKey),
+		ServerName: getString("adaptor-server-name", tlsConf.ServerName),
+	}
+
+	if len(tlsOpts.CACert) == 0 && len(tlsOpts.ClientCert) == 0 &&
+		len(tlsOpts.ClientKey) == 0 && len(tlsOpts.ServerName) == 0 {
+		return nil
+	}
+
+	return tlsOpts
+}
+
+// GetAdaptorSigningFromFlags gets the secrets to sign requests to the adaptor
+// with, from --adaptor-signing-secret-file or the configuration file.
+// It returns nil if none are set.
+func GetAdaptorSigningFromFlags(cmd *cobra.Command) *services.SigningOptions {
+	secretFiles, _ := cmd.Flags().GetStringSlice("adaptor-signing-secret-file")
+	if !cmd.Flags().Changed("adaptor-signing-secret-file") {
+		if conf := configuration.GetConfigFile(); conf != nil && conf.AdaptorSigning != nil {
+			secretFiles = conf.AdaptorSigning.SecretFiles
+		}
+	}
+
+	if len(secretFiles) == 0 {
+		return nil
+	}
+
+	return &services.SigningOptions{SecretFiles: secretFiles}
+}
+
+// GetHandlerOptionsFromFlags gets the options about how events must be sent
+// to the adaptor, or returns an error in case they are not valid.
+func GetHandlerOptionsFromFlags(cmd *cobra.Command) (*services.HandlerOptions, error) {
+	apiVersion, err := GetAPIVersionFromFlags(cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	return &services.HandlerOptions{
+		APIVersion: apiVersion,
+		Format:     GetEventFormatFromFlags(cmd),
+		Auth:       GetAdaptorAuthFromFlags(cmd),
+		Headers:    GetAdaptorHeadersFromFlags(cmd),
+		TLS:        GetAdaptorTLSFromFlags(cmd),
+		Signing:    GetAdaptorSigningFromFlags(cmd),
+	}, nil
+}
+
+// AdaptorOptions contains the settings of an adaptor where events are sent
+// to.
+type AdaptorOptions struct {
+	// Name of the adaptor, used to identify it in logs
+	Name string
+	// Endpoint of the adaptor
+	Endpoint string
+	// Handler contains options about how events must be sent
+	Handler *services.HandlerOptions
+	// Selector contains the metadata an endpoint must have to be sent to
+	// this adaptor
+	Selector map[string]string
+	// Retry contains options about how to retry sending events
+	Retry *queue.Options
+}
+
+// GetAdaptorsFromFlags returns the adaptors where events must be sent to:
+// the ones in the configuration file or, in case there are none or
+// --adaptor-api is set, the one defined by the --adaptor-* flags.
+func GetAdaptorsFromFlags(cmd *cobra.Command) ([]*AdaptorOptions, error) {
+	conf := configuration.GetConfigFile()
+	if conf == nil || len(conf.Adaptors) == 0 || cmd.Flags().Changed("adaptor-api") {
+		endpoint, err := GetAdaptorEndpointFromFlags(cmd)
+		if err != nil {
+			return nil, err
+		}
+
+		handlerOpts, err := GetHandlerOptionsFromFlags(cmd)
+		if err != nil {
+			return nil, err
+		}
+
+		return []*AdaptorOptions{{Name: endpoint, Endpoint: endpoint, Handler: handlerOpts}}, nil
+	}
+
+	adaptors := make([]*AdaptorOptions, len(conf.Adaptors))
+	names := map[string]bool{}
+	for i, adaptorConf := range conf.Adaptors {
+		adaptor, err := parseAdaptorConfig(adaptorConf)
+		if err != nil {
+			return nil, fmt.Errorf("adaptor %d is not valid: %w", i, err)
+		}
+
+		if names[adaptor.Name] {
+			return nil, fmt.Errorf("adaptor name %s is used more than once", adaptor.Name)
+		}
+		names[adaptor.Name] = true
+		adaptors[i] = adaptor
+	}
+
+	return adaptors, nil
+}
+
+func parseAdaptorConfig(adaptorConf configuration.AdaptorConfig) (*AdaptorOptions, error) {
+	if len(adaptorConf.API) == 0 {
+		return nil, fmt.Errorf("no api provided")
+	}
+
+	endpoint, err := parseAdaptorEndpoint(adaptorConf.API)
+	if err != nil {
+		return nil, err
+	}
+
+	adaptor := &AdaptorOptions{
+		Name:     adaptorConf.Name,
+		Endpoint: endpoint,
+		Handler: &services.HandlerOptions{
+			APIVersion: adaptorConf.APIVersion,
+			Format:     adaptorConf.EventFormat,
+			Headers:    adaptorConf.Headers,
+		},
+		Selector: adaptorConf.Selector,
+	}
+	if len(adaptor.Name) == 0 {
+		adaptor.Name = endpoint
+	}
+	if len(adaptor.Handler.APIVersion) == 0 {
+		adaptor.Handler.APIVersion = "v1"
+	}
+	if len(adaptor.Handler.Format) == 0 {
+		adaptor.Handler.Format = "openapi"
+	}
+
+	if auth := adaptorConf.Auth; auth != nil {
+		adaptor.Handler.Auth = &services.AuthOptions{
+			BearerTokenFile: auth.TokenFile,
+			Username:        auth.Username,
+			Password:        auth.Password,
+			APIKey:          auth.APIKey,
+			APIKeyHeader:    auth.APIKeyHeader,
+		}
+	}
+
+	if tlsConf := adaptorConf.TLS; tlsConf != nil {
+		adaptor.Handler.TLS = &services.TLSOptions{
+			CACert:     tlsConf.CACert,
+			ClientCert: tlsConf.ClientCert,
+			ClientKey:  tlsConf.ClientKey,
+			ServerName: tlsConf.ServerName,
+		}
+	}
+
+	if signing := adaptorConf.Signing; signing != nil && len(signing.SecretFiles) > 0 {
+		adaptor.Handler.Signing = &services.SigningOptions{SecretFiles: signing.SecretFiles}
+	}
+
+	if retry := adaptorConf.Retry; retry != nil {
+		adaptor.Retry = &queue.Options{
+			MinBackoff: time.Duration(retry.MinBackoff) * time.Second,
+			MaxBackoff: time.Duration(retry.MaxBackoff) * time.Second,
+		}
+	}
+
+	return adaptor, nil
+}
+
+// AddAdaptorSinks adds all the adaptors to the pipeline, or returns an
+// error in case the settings of one of them are not valid.
+// Batches sent to the adaptors are recorded in auditLog, if not nil.
+// The local targets, if any, are added as well, and they receive events
+// even when this instance is not the leader.
+func AddAdaptorSinks(p *reader.Pipeline, adaptors []*AdaptorOptions, auditLog *audit.Log, local ...*queue.Target) error {
+	for _, adaptor := range adaptors {
+		servsHandler, err := services.NewHandler(adaptor.Endpoint, adaptor.Handler)
+		if err != nil {
+			return fmt.Errorf("adaptor %s is not valid: %w", adaptor.Name, err)
+		}
+
+		if err := p.AddSink(adaptor.Name, servsHandler, &reader.SinkOptions{
+			Selector: adaptor.Selector,
+			Retry:    adaptor.Retry,
+			Audit:    auditLog,
+		}); err != nil {
+			return err
+		}
+	}
+
+	for _, target := range local {
+		if target == nil {
+			continue
+		}
+
+		if err := p.AddSink(target.Name, target.Handler, &reader.SinkOptions{
+			Selector: target.Selector,
+			Retry:    target.Options,
+			Audit:    target.Audit,
+			Local:    true,
+		}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ServerOptions contains settings about the HTTP server that adaptors can
+// query.
+type ServerOptions struct {
+	// Address where to serve requests
+	Address string
+	// HistorySize is the number of events kept in the history
+	HistorySize int
+	// LivenessThreshold is the time after which the program is not alive
+	// anymore if the service registry has not been polled successfully.
+	// If 0, it is not checked
+	LivenessThreshold time.Duration
+}
+
+// GetServerOptionsFromFlags returns the settings of the server from
+// --server-address, --server-history-size and --liveness-threshold, or nil
+// if the server must not be started.
+func GetServerOptionsFromFlags(cmd *cobra.Command) *ServerOptions {
+	opts := &ServerOptions{}
+	if conf := configuration.GetConfigFile(); conf != nil && conf.Server != nil {
+		opts.Address = conf.Server.Address
+		opts.HistorySize = conf.Server.HistorySize
+		opts.LivenessThreshold = time.Duration(conf.Server.LivenessThreshold) * time.Second
+	}
+
+	if cmd.Flags().Changed("server-address") {
+		opts.Address, _ = cmd.Flags().GetString("server-address")
+	}
+	if cmd.Flags().Changed("server-history-size") || opts.HistorySize == 0 {
+		opts.HistorySize, _ = cmd.Flags().GetInt("server-history-size")
+	}
+	if cmd.Flags().Changed("liveness-threshold") {
+		threshold, _ := cmd.Flags().GetInt("liveness-threshold")
+		opts.LivenessThreshold = time.Duration(threshold) * time.Second
+	}
+
+	if len(opts.Address) == 0 {
+		return nil
+	}
+
+	return opts
+}
+
+// GetAuditOptionsFromFlags returns where to record the batches of events
+// sent to the adaptors, from the flags and the configuration file, or nil if
+// they must not be recorded.
+func GetAuditOptionsFromFlags(cmd *cobra.Command) *audit.Options {
+	opts := &audit.Options{}
+	if conf := configuration.GetConfigFile(); conf != nil && conf.Audit != nil {
+		opts.Path = conf.Audit.Path
+		opts.MaxSize = conf.Audit.MaxSize
+		opts.MaxBackups = conf.Audit.MaxBackups
+	}
+
+	if cmd.Flags().Changed("audit-log") {
+		opts.Path, _ = cmd.Flags().GetString("audit-log")
+	}
+	if cmd.Flags().Changed("audit-log-max-size") || opts.MaxSize == 0 {
+		opts.MaxSize, _ = cmd.Flags().GetInt("audit-log-max-size")
+	}
+	if cmd.Flags().Changed("audit-log-max-backups") || opts.MaxBackups == 0 {
+		opts.MaxBackups, _ = cmd.Flags().GetInt("audit-log-max-backups")
+	}
+
+	if len(opts.Path) == 0 {
+		return nil
+	}
+
+	return opts
+}
+
+// GetLeaderElectionOptionsFromFlags returns how to elect the instance that
+// sends events to the adaptors, from the flags and the configuration file,
+// or nil if leader election is disabled.
+func GetLeaderElectionOptionsFromFlags(cmd *cobra.Command) *election.Options {
+	opts := &election.Options{}
+	if conf := configuration.GetConfigFile(); conf != nil && conf.LeaderElection != nil {
+		opts.Backend = conf.LeaderElection.Backend
+		opts.Name = conf.LeaderElection.Name
+		opts.Namespace = conf.LeaderElection.Namespace
+		opts.File = conf.LeaderElection.File
+		opts.LeaseDuration = time.Duration(conf.LeaderElection.LeaseDuration) * time.Second
+	}
+
+	if cmd.Flags().Changed("leader-election") {
+		opts.Backend, _ = cmd.Flags().GetString("leader-election")
+	}
+	if cmd.Flags().Changed("leader-election-name") {
+		opts.Name, _ = cmd.Flags().GetString("leader-election-name")
+	}
+	if cmd.Flags().Changed("leader-election-namespace") {
+		opts.Namespace, _ = cmd.Flags().GetString("leader-election-namespace")
+	}
+	if cmd.Flags().Changed("leader-election-file") {
+		opts.File, _ = cmd.Flags().GetString("leader-election-file")
+	}
+	if cmd.Flags().Changed("leader-election-lease-duration") {
+		leaseDuration, _ := cmd.Flags().GetInt("leader-election-lease-duration")
+		opts.LeaseDuration = time.Duration(leaseDuration) * time.Second
+	}
+
+	if len(opts.Backend) == 0 {
+		return nil
+	}
+
+	return opts
+}
+
+// OpenAuditLog opens the audit log defined by opts, or returns nil if opts
+// is nil.
+func OpenAuditLog(opts *audit.Options) (*audit.Log, error) {
+	if opts == nil {
+		return nil, nil
+	}
+
+	return audit.Open(opts)
+}
+
+// StartServer starts serving requests in background, until ctx is
+// canceled, and returns the target that feeds the server with events.
+// Liveness and readiness are served according to checker, if not nil.
+// If opts is nil, no server is started and nil is returned.
+func StartServer(ctx context.Context, opts *ServerOptions, checker *health.Checker) (*queue.Target, error) {
+	if opts == nil {
+		return nil, nil
+	}
+
+	lis, err := net.Listen("tcp", opts.Address)
+	if err != nil {
+		return nil, err
+	}
+
+	store := server.NewStore(opts.HistorySize)
+	srv := server.New(store)
+	if checker != nil {
+		srv.Handle("/healthz", checker.LivenessHandler(opts.LivenessThreshold))
+		srv.Handle("/readyz", checker.ReadinessHandler())
+	}
+	go func() {
+		if err := srv.Serve(ctx, lis); err != nil {
+			log.Err(err).Msg("error while serving requests")
+		}
+	}()
+
+	return &queue.Target{Name: "server", Handler: store}, nil
+}
+
+// GetResyncIntervalFromFlags gets the value of --resync-interval
+func GetResyncIntervalFromFlags(cmd *cobra.Command) int {
+	if cmd.Flags().Changed("resync-interval") {
+		interval, _ := cmd.Flags().GetInt("resync-interval")
+		return interval
 	}
 
 	if conf := configuration.GetConfigFile(); conf != nil {
-		return conf.DebugMode
+		return conf.ResyncInterval
 	}
 
-	return false
+	return 0
 }
 
 // SanitizeLocalhost changes localhost to host.docker.internal in case the
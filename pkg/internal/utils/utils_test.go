@@ -19,10 +19,22 @@
 package utils
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
 	"testing"
+	"time"
 
+	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/audit"
+	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/configuration"
+	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/election"
+	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/health"
+	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/openapi"
+	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/queue"
+	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/server"
+	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/services"
+	"github.com/spf13/cobra"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -111,3 +123,250 @@ func TestSanitizeLocalhost(t *testing.T) {
 		}
 	}
 }
+
+func TestGetAdaptorEndpointFromFlags(t *testing.T) {
+	a := assert.New(t)
+
+	cases := []struct {
+		endp   string
+		mode   string
+		expRes string
+	}{
+		{
+			expRes: "localhost:80/cnwan",
+		},
+		{
+			endp:   "example.com:8080/cnwan",
+			expRes: "example.com:8080/cnwan",
+		},
+		{
+			endp:   "http://example.com:8080/cnwan",
+			expRes: "example.com:8080/cnwan",
+		},
+		{
+			endp:   "https://example.com:8443/cnwan",
+			expRes: "https://example.com:8443/cnwan",
+		},
+		{
+			endp:   "https://localhost:8443/cnwan/",
+			mode:   "docker",
+			expRes: "https://host.docker.internal:8443/cnwan",
+		},
+		{
+			endp:   "stdout://",
+			expRes: "stdout://",
+		},
+		{
+			endp:   "unix:///run/adaptor.sock?path=/cnwan",
+			expRes: "unix:///run/adaptor.sock?path=/cnwan",
+		},
+	}
+
+	for i, currCase := range cases {
+		os.Clearenv()
+		if len(currCase.mode) > 0 {
+			os.Setenv("MODE", currCase.mode)
+		}
+
+		cmd := &cobra.Command{}
+		cmd.Flags().String("adaptor-api", "localhost:80/cnwan", "")
+		if len(currCase.endp) > 0 {
+			cmd.Flags().Set("adaptor-api", currCase.endp)
+		}
+
+		res, err := GetAdaptorEndpointFromFlags(cmd)
+		if !a.NoError(err) || !a.Equal(currCase.expRes, res) {
+			a.FailNow(fmt.Sprintf("case %d failed", i))
+		}
+	}
+}
+
+func TestParseAdaptorConfig(t *testing.T) {
+	a := assert.New(t)
+
+	cases := []struct {
+		conf   configuration.AdaptorConfig
+		expRes *AdaptorOptions
+		expErr error
+	}{
+		{
+			expErr: errors.New("no api provided"),
+		},
+		{
+			conf: configuration.AdaptorConfig{API: "http://controller.example.com/cnwan"},
+			expRes: &AdaptorOptions{
+				Name:     "controller.example.com/cnwan",
+				Endpoint: "controller.example.com/cnwan",
+				Handler:  &services.HandlerOptions{APIVersion: "v1", Format: "openapi"},
+			},
+		},
+		{
+			conf: configuration.AdaptorConfig{
+				Name:        "audit",
+				API:         "https://audit.example.com",
+				APIVersion:  "v2",
+				EventFormat: "cloudevents-batch",
+				Auth:        &configuration.AdaptorAuthConfig{APIKey: "key"},
+				Headers:     map[string]string{"X-Tenant": "acme"},
+				TLS:         &configuration.AdaptorTLSConfig{CACert: "ca.crt"},
+				Selector:    map[string]string{"traffic-profile": ""},
+				Retry:       &configuration.AdaptorRetryConfig{MinBackoff: 2, MaxBackoff: 30},
+			},
+			expRes: &AdaptorOptions{
+				Name:     "audit",
+				Endpoint: "https://audit.example.com",
+				Handler: &services.HandlerOptions{
+					APIVersion: "v2",
+					Format:     "cloudevents-batch",
+					Auth:       &services.AuthOptions{APIKey: "key"},
+					Headers:    map[string]string{"X-Tenant": "acme"},
+					TLS:        &services.TLSOptions{CACert: "ca.crt"},
+				},
+				Selector: map[string]string{"traffic-profile": ""},
+				Retry:    &queue.Options{MinBackoff: 2 * time.Second, MaxBackoff: 30 * time.Second},
+			},
+		},
+	}
+
+	for i, currCase := range cases {
+		res, err := parseAdaptorConfig(currCase.conf)
+		if !a.Equal(currCase.expRes, res) || !a.Equal(currCase.expErr, err) {
+			a.FailNow(fmt.Sprintf("case %d failed", i))
+		}
+	}
+}
+
+func TestGetServerOptionsFromFlags(t *testing.T) {
+	a := assert.New(t)
+
+	cases := []struct {
+		args   []string
+		expRes *ServerOptions
+	}{
+		{},
+		{
+			args:   []string{"--server-address=:8080"},
+			expRes: &ServerOptions{Address: ":8080", HistorySize: 1000},
+		},
+		{
+			args:   []string{"--server-address=127.0.0.1:8080", "--server-history-size=50"},
+			expRes: &ServerOptions{Address: "127.0.0.1:8080", HistorySize: 50},
+		},
+		{
+			args:   []string{"--server-address=:8080", "--liveness-threshold=90"},
+			expRes: &ServerOptions{Address: ":8080", HistorySize: 1000, LivenessThreshold: 90 * time.Second},
+		},
+	}
+
+	for i, currCase := range cases {
+		cmd := &cobra.Command{}
+		cmd.Flags().String("server-address", "", "")
+		cmd.Flags().Int("server-history-size", 1000, "")
+		cmd.Flags().Int("liveness-threshold", 0, "")
+		cmd.Flags().Parse(currCase.args)
+
+		if !a.Equal(currCase.expRes, GetServerOptionsFromFlags(cmd)) {
+			a.FailNow(fmt.Sprintf("case %d failed", i))
+		}
+	}
+}
+
+func TestGetAuditOptionsFromFlags(t *testing.T) {
+	a := assert.New(t)
+
+	cases := []struct {
+		args   []string
+		expRes *audit.Options
+	}{
+		{},
+		{
+			args:   []string{"--audit-log=/var/log/audit.log"},
+			expRes: &audit.Options{Path: "/var/log/audit.log", MaxSize: 100, MaxBackups: 5},
+		},
+		{
+			args:   []string{"--audit-log=audit.log", "--audit-log-max-size=10", "--audit-log-max-backups=2"},
+			expRes: &audit.Options{Path: "audit.log", MaxSize: 10, MaxBackups: 2},
+		},
+	}
+
+	for i, currCase := range cases {
+		cmd := &cobra.Command{}
+		cmd.Flags().String("audit-log", "", "")
+		cmd.Flags().Int("audit-log-max-size", 100, "")
+		cmd.Flags().Int("audit-log-max-backups", 5, "")
+		cmd.Flags().Parse(currCase.args)
+
+		if !a.Equal(currCase.expRes, GetAuditOptionsFromFlags(cmd)) {
+			a.FailNow(fmt.Sprintf("case %d failed", i))
+		}
+	}
+}
+
+func TestGetLeaderElectionOptionsFromFlags(t *testing.T) {
+	a := assert.New(t)
+
+	cases := []struct {
+		args   []string
+		expRes *election.Options
+	}{
+		{},
+		{
+			args:   []string{"--leader-election=kubernetes"},
+			expRes: &election.Options{Backend: election.BackendKubernetes},
+		},
+		{
+			args: []string{"--leader-election=kubernetes", "--leader-election-name=reader", "--leader-election-namespace=sdwan", "--leader-election-lease-duration=30"},
+			expRes: &election.Options{
+				Backend:       election.BackendKubernetes,
+				Name:          "reader",
+				Namespace:     "sdwan",
+				LeaseDuration: 30 * time.Second,
+			},
+		},
+		{
+			args:   []string{"--leader-election=file", "--leader-election-file=/run/reader.lock"},
+			expRes: &election.Options{Backend: election.BackendFile, File: "/run/reader.lock"},
+		},
+	}
+
+	for i, currCase := range cases {
+		cmd := &cobra.Command{}
+		cmd.Flags().String("leader-election", "", "")
+		cmd.Flags().String("leader-election-name", election.DefaultName, "")
+		cmd.Flags().String("leader-election-namespace", "", "")
+		cmd.Flags().String("leader-election-file", "", "")
+		cmd.Flags().Int("leader-election-lease-duration", 15, "")
+		cmd.Flags().Parse(currCase.args)
+
+		if !a.Equal(currCase.expRes, GetLeaderElectionOptionsFromFlags(cmd)) {
+			a.FailNow(fmt.Sprintf("case %d failed", i))
+		}
+	}
+}
+
+func TestStartServer(t *testing.T) {
+	a := assert.New(t)
+	ctx, canc := context.WithCancel(context.Background())
+	defer canc()
+
+	target, err := StartServer(ctx, nil, nil)
+	a.Nil(target)
+	a.NoError(err)
+
+	target, err = StartServer(ctx, &ServerOptions{Address: "127.0.0.1:0"}, health.New())
+	if !a.NoError(err) || !a.NotNil(target) {
+		return
+	}
+	a.Equal("server", target.Name)
+
+	// The store behind the server receives events as any other adaptor
+	a.NoError(target.Handler.Send(ctx, []openapi.Event{
+		{Event: "create", Service: openapi.Service{Id: "ns/serv/endp", Name: "endp"}},
+	}))
+	store := target.Handler.(*server.Store)
+	_, exists := store.Service("ns/serv/endp")
+	a.True(exists)
+
+	_, err = StartServer(ctx, &ServerOptions{Address: "invalid-address"}, nil)
+	a.Error(err)
+}
@@ -0,0 +1,99 @@
+// Copyright © 2021 Cisco
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// All rights reserved.
+
+package logging
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// FormatConsole writes human-readable log lines.
+	FormatConsole string = "console"
+	// FormatJSON writes one JSON object per log line.
+	FormatJSON string = "json"
+)
+
+// Options contains settings about how and where to write logs.
+type Options struct {
+	// Format of the log lines: FormatConsole or FormatJSON.
+	// If empty, FormatConsole is used
+	Format string
+	// Level is the minimum level of the lines to write, e.g. debug or
+	// info. If empty, info is used
+	Level string
+	// File where to append logs to. If empty, logs are written to the
+	// writer passed to Setup
+	File string
+}
+
+// Setup configures the global logger, which is the one used by every
+// package, as defined by opts. Logs are written to out, unless opts
+// specifies a file.
+func Setup(opts *Options, out io.Writer) error {
+	if opts == nil {
+		opts = &Options{}
+	}
+
+	level := zerolog.InfoLevel
+	if len(opts.Level) > 0 {
+		lvl, err := zerolog.ParseLevel(strings.ToLower(opts.Level))
+		if err != nil || lvl == zerolog.NoLevel {
+			return fmt.Errorf("unsupported log level: %s", opts.Level)
+		}
+		level = lvl
+	}
+
+	if opts.Format != "" && opts.Format != FormatConsole && opts.Format != FormatJSON {
+		return fmt.Errorf("unsupported log format: %s", opts.Format)
+	}
+
+	toFile := false
+	if len(opts.File) > 0 {
+		// The file is kept open until the program exits
+		file, err := os.OpenFile(opts.File, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+		if err != nil {
+			return fmt.Errorf("could not open log file: %w", err)
+		}
+		out, toFile = file, true
+	}
+
+	if opts.Format != FormatJSON {
+		out = consoleWriter(out, toFile)
+	}
+
+	zerolog.SetGlobalLevel(level)
+	log.Logger = zerolog.New(out).With().Timestamp().Logger()
+	return nil
+}
+
+func consoleWriter(out io.Writer, noColor bool) zerolog.ConsoleWriter {
+	return zerolog.ConsoleWriter{
+		Out:     out,
+		NoColor: noColor,
+		FormatMessage: func(i interface{}) string {
+			return fmt.Sprintf("%s\t|", i)
+		},
+	}
+}
@@ -0,0 +1,131 @@
+// Copyright © 2021 Cisco
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// All rights reserved.
+
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetup(t *testing.T) {
+	a := assert.New(t)
+	defer func(logger zerolog.Logger, level zerolog.Level) {
+		log.Logger = logger
+		zerolog.SetGlobalLevel(level)
+	}(log.Logger, zerolog.GlobalLevel())
+
+	logFile := path.Join(t.TempDir(), "reader.log")
+	cases := []struct {
+		opts     *Options
+		expErr   error
+		expLevel zerolog.Level
+		expOut   func(string) bool
+		expFile  func(string) bool
+	}{
+		{
+			opts:     &Options{Format: "xml"},
+			expErr:   fmt.Errorf("unsupported log format: xml"),
+			expLevel: zerolog.InfoLevel,
+		},
+		{
+			opts:     &Options{Level: "verbose"},
+			expErr:   fmt.Errorf("unsupported log level: verbose"),
+			expLevel: zerolog.InfoLevel,
+		},
+		{
+			expLevel: zerolog.InfoLevel,
+			expOut: func(out string) bool {
+				return strings.Contains(out, "hello\t|") && !strings.Contains(out, "debug line")
+			},
+		},
+		{
+			opts:     &Options{Format: FormatJSON, Level: "DEBUG"},
+			expLevel: zerolog.DebugLevel,
+			expOut: func(out string) bool {
+				lines := strings.Split(strings.TrimSpace(out), "\n")
+				if len(lines) != 2 {
+					return false
+				}
+
+				line := map[string]interface{}{}
+				if err := json.Unmarshal([]byte(lines[1]), &line); err != nil {
+					return false
+				}
+				return line["message"] == "hello" && line["level"] == "info"
+			},
+		},
+		{
+			opts:     &Options{Format: FormatJSON, Level: "warn", File: logFile},
+			expLevel: zerolog.WarnLevel,
+			expOut: func(out string) bool {
+				return len(out) == 0
+			},
+			expFile: func(out string) bool {
+				return len(out) == 0
+			},
+		},
+		{
+			opts:     &Options{Level: "info", File: logFile},
+			expLevel: zerolog.InfoLevel,
+			expOut: func(out string) bool {
+				return len(out) == 0
+			},
+			expFile: func(out string) bool {
+				return strings.Contains(out, "INF hello\t|")
+			},
+		},
+	}
+
+	failed := func(i int) {
+		a.FailNow("case failed", fmt.Sprintf("case %d", i))
+	}
+	for i, currCase := range cases {
+		zerolog.SetGlobalLevel(zerolog.InfoLevel)
+		var out bytes.Buffer
+		err := Setup(currCase.opts, &out)
+		if !a.Equal(currCase.expErr, err) || !a.Equal(currCase.expLevel, zerolog.GlobalLevel()) {
+			failed(i)
+		}
+		if err != nil {
+			continue
+		}
+
+		log.Debug().Msg("debug line")
+		log.Info().Msg("hello")
+		if !a.True(currCase.expOut(out.String())) {
+			failed(i)
+		}
+
+		if currCase.expFile != nil {
+			content, _ := ioutil.ReadFile(logFile)
+			if !a.True(currCase.expFile(string(content))) {
+				failed(i)
+			}
+		}
+	}
+}
@@ -0,0 +1,157 @@
+// Copyright © 2021 Cisco
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// All rights reserved.
+
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "cnwan_reader"
+
+var (
+	// Registry contains all the metrics of the CN-WAN Reader, together with
+	// the ones about the Go runtime and the process.
+	Registry = prometheus.NewRegistry()
+
+	// Polls counts the times a service registry has been polled.
+	Polls = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "polls_total",
+		Help:      "Number of times the service registry has been polled.",
+	}, []string{"source"})
+
+	// PollDuration observes how long it takes to poll a service registry.
+	PollDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "poll_duration_seconds",
+		Help:      "Time it takes to poll the service registry.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"source"})
+
+	// RegistryErrors counts the errors returned by the API of a service
+	// registry.
+	RegistryErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "registry_errors_total",
+		Help:      "Number of errors returned by the API of the service registry.",
+	}, []string{"source"})
+
+	// Events counts the events generated from changes in the service
+	// registry, by type.
+	Events = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "events_total",
+		Help:      "Number of events generated from changes in the service registry.",
+	}, []string{"type"})
+
+	// QueueDepth is the number of events waiting to be sent to an adaptor.
+	QueueDepth = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "queue_depth",
+		Help:      "Number of events waiting to be sent to the adaptor.",
+	}, []string{"adaptor"})
+
+	// BatchSize observes the number of events or services sent to an
+	// adaptor in a single request.
+	BatchSize = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "batch_size",
+		Help:      "Number of events or services sent to the adaptor in a single request.",
+		Buckets:   prometheus.ExponentialBuckets(1, 4, 8),
+	}, []string{"adaptor", "operation"})
+
+	// SendDuration observes how long it takes to send data to an adaptor,
+	// including requests that failed.
+	SendDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "send_duration_seconds",
+		Help:      "Time it takes to send data to the adaptor.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"adaptor", "operation", "result"})
+
+	// AdaptorResponses counts the responses received from an adaptor, by
+	// status code.
+	AdaptorResponses = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "adaptor_responses_total",
+		Help:      "Number of responses received from the adaptor, by status code.",
+	}, []string{"adaptor", "code"})
+
+	// AdaptorResourceErrors counts the resources that an adaptor reported
+	// as not processed, e.g. in a 207 response, by status code.
+	AdaptorResourceErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "adaptor_resource_errors_total",
+		Help:      "Number of resources that the adaptor could not process, by status code.",
+	}, []string{"adaptor", "code"})
+
+	// Leader is 1 if this instance is the leader and sends events to the
+	// adaptors, or 0 if it is standing by. It is only set when leader
+	// election is enabled.
+	Leader = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "leader",
+		Help:      "Whether this instance is the leader (1) or is standing by (0).",
+	})
+)
+
+const (
+	// OperationSend is the operation of sending events.
+	OperationSend string = "send"
+	// OperationSync is the operation of sending the full current state.
+	OperationSync string = "sync"
+	// ResultSuccess is the result of data that has been sent.
+	ResultSuccess string = "success"
+	// ResultFailure is the result of data that could not be sent.
+	ResultFailure string = "failure"
+)
+
+func init() {
+	Registry.MustRegister(
+		prometheus.NewGoCollector(),
+		prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}),
+		Polls,
+		PollDuration,
+		RegistryErrors,
+		Events,
+		QueueDepth,
+		BatchSize,
+		SendDuration,
+		AdaptorResponses,
+		AdaptorResourceErrors,
+		Leader,
+	)
+}
+
+// Handler returns an http.Handler that serves the metrics in Registry.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
+
+// Result returns ResultSuccess if err is nil and ResultFailure otherwise.
+func Result(err error) string {
+	if err != nil {
+		return ResultFailure
+	}
+
+	return ResultSuccess
+}
@@ -19,7 +19,7 @@
 /*
  * CN-WAN Reader API
  *
- * The CN-WAN Reader implements the [service discovery](https://en.wikipedia.org/wiki/Service_discovery) pattern by connecting to a service registry and observing changes in registered services/endpoints. Detected changes are then processed and sent as events to the API endpoints defined below.  Events are **sent** to the following endpoints, thus any program interested in receiving them must generate the *server* code from this OpenAPI specification and define their own logic in the generated code.  By default, the CN-WAN Reader expects the server that will receive events to operate on port `80` and receive events on `/cnwan/events`, but if your server uses a different port/endpoint you can override this value on the generated server code with the one your server is using. Once done, when launching the CN-WAN Reader specify the correct endpoint by providing it as a command line argument, e.g. with `--adaptor-api localhost:9909` events will be sent on `localhost:9909/events`, and with `--adaptor-api example.com/another/path` events will be sent to `example.com/another/path/events`.  As a final note, please take in mind that this specification can also serve as a reference/guide for the creation of an adaptor.   As a matter of fact, your adaptor can even provided its own OpenAPI which includes the endpoints described here with different descriptions and different meanings for the response codes, or it can even include other endpoints as well. But as long as formats, returned response code and the endpoints of this specification match the ones on your adaptor's specification, compatibility with CN-WAN Reader is guaranteed.
+ * The CN-WAN Reader implements the [service discovery](https://en.wikipedia.org/wiki/Service_discovery) pattern by connecting to a service registry and observing changes in registered services/endpoints. Detected changes are then processed and sent as events to the API endpoints defined below.  Events are **sent** to the following endpoints, thus any program interested in receiving them must generate the *server* code from this OpenAPI specification and define their own logic in the generated code.  By default, the CN-WAN Reader expects the server that will receive events to operate on port `80` and receive events on `/cnwan/events`, but if your server uses a different port/endpoint you can override this value on the generated server code with the one your server is using. Once done, when launching the CN-WAN Reader specify the correct endpoint by providing it as a command line argument, e.g. with `--adaptor-api localhost:9909` events will be sent on `localhost:9909/events`, and with `--adaptor-api example.com/another/path` events will be sent to `example.com/another/path/events`.  If the CN-WAN Reader is launched with `--adaptor-signing-secret-file`, every request includes two headers that adaptors can use to verify that it was sent by the CN-WAN Reader and that it is not being replayed: `X-Cnwan-Timestamp`, the time when the request was signed as seconds since the Unix epoch, and `X-Cnwan-Signature`, in the form `v1=<signature>,v1=<signature>`, with one signature for each secret the CN-WAN Reader is using. Each signature is the hex-encoded HMAC-SHA256, keyed with a secret, of the timestamp, a `.` and the raw request body. Adaptors should accept a request if any of the signatures matches one of their secrets, and reject it if the timestamp is too old, e.g. more than five minutes. Since requests are signed with all the secrets, a secret can be rotated by adding the new one to both the CN-WAN Reader and the adaptor before removing the old one.  Endpoints tagged with `pull` are the exception: they are **served** by the CN-WAN Reader when it is launched with `--server-address`, so that adaptors can get the current state when they start and catch up with the events they missed while they were down.  As a final note, please take in mind that this specification can also serve as a reference/guide for the creation of an adaptor.   As a matter of fact, your adaptor can even provided its own OpenAPI which includes the endpoints described here with different descriptions and different meanings for the response codes, or it can even include other endpoints as well. But as long as formats, returned response code and the endpoints of this specification match the ones on your adaptor's specification, compatibility with CN-WAN Reader is guaranteed.
  *
  * API version: 1.0.0 beta
  * Contact: cnwan@cisco.com
@@ -28,8 +28,18 @@
 
 package openapi
 
+import (
+	"time"
+)
+
 // Event struct for Event
 type Event struct {
+	// A unique identifier of the event. It is the same if the event is sent again, so it can be used to discard duplicates.
+	Id string `json:"id,omitempty"`
+	// When the event was detected by the CN-WAN Reader.
+	Timestamp time.Time `json:"timestamp"`
+	// A number that increases with every event, so events about the same endpoint can be ordered even if they are in different batches. It keeps increasing when the endpoint is created again after being deleted.
+	Sequence int64 `json:"sequence,omitempty"`
 	// The event that occurred
 	Event   string  `json:"event,omitempty"`
 	Service Service `json:"service"`
@@ -0,0 +1,37 @@
+// Copyright © 2020 Cisco
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// All rights reserved.
+
+/*
+ * CN-WAN Reader API
+ *
+ * The CN-WAN Reader implements the [service discovery](https://en.wikipedia.org/wiki/Service_discovery) pattern by connecting to a service registry and observing changes in registered services/endpoints. Detected changes are then processed and sent as events to the API endpoints defined below.  Events are **sent** to the following endpoints, thus any program interested in receiving them must generate the *server* code from this OpenAPI specification and define their own logic in the generated code.  By default, the CN-WAN Reader expects the server that will receive events to operate on port `80` and receive events on `/cnwan/events`, but if your server uses a different port/endpoint you can override this value on the generated server code with the one your server is using. Once done, when launching the CN-WAN Reader specify the correct endpoint by providing it as a command line argument, e.g. with `--adaptor-api localhost:9909` events will be sent on `localhost:9909/events`, and with `--adaptor-api example.com/another/path` events will be sent to `example.com/another/path/events`.  If the CN-WAN Reader is launched with `--adaptor-signing-secret-file`, every request includes two headers that adaptors can use to verify that it was sent by the CN-WAN Reader and that it is not being replayed: `X-Cnwan-Timestamp`, the time when the request was signed as seconds since the Unix epoch, and `X-Cnwan-Signature`, in the form `v1=<signature>,v1=<signature>`, with one signature for each secret the CN-WAN Reader is using. Each signature is the hex-encoded HMAC-SHA256, keyed with a secret, of the timestamp, a `.` and the raw request body. Adaptors should accept a request if any of the signatures matches one of their secrets, and reject it if the timestamp is too old, e.g. more than five minutes. Since requests are signed with all the secrets, a secret can be rotated by adding the new one to both the CN-WAN Reader and the adaptor before removing the old one.  Endpoints tagged with `pull` are the exception: they are **served** by the CN-WAN Reader when it is launched with `--server-address`, so that adaptors can get the current state when they start and catch up with the events they missed while they were down.  As a final note, please take in mind that this specification can also serve as a reference/guide for the creation of an adaptor.   As a matter of fact, your adaptor can even provided its own OpenAPI which includes the endpoints described here with different descriptions and different meanings for the response codes, or it can even include other endpoints as well. But as long as formats, returned response code and the endpoints of this specification match the ones on your adaptor's specification, compatibility with CN-WAN Reader is guaranteed.
+ *
+ * API version: 1.0.0 beta
+ * Contact: cnwan@cisco.com
+ * Generated by: OpenAPI Generator (https://openapi-generator.tech)
+ */
+
+package openapi
+
+// EventHistory struct for EventHistory
+type EventHistory struct {
+	// The events, from the oldest to the newest.
+	Events []HistoryEvent `json:"events"`
+	// The `seq` of the latest event observed by the CN-WAN Reader, to use as `since` on the next request. It is `0` if there are none.
+	Last int64 `json:"last"`
+}
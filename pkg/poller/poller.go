@@ -23,23 +23,32 @@ import (
 	"errors"
 	"time"
 
+	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/metrics"
+	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/tracing"
 	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
-type fn func()
+type fn func(context.Context)
 
 // Poller periodically executes a given function
 type Poller interface {
 	// Start the poller
 	Start() error
-	// SetPollFunction sets the function that must be called
+	// SetPollFunction sets the function that must be called. It receives
+	// a context that carries the span of the poll, if any
 	SetPollFunction(fn)
+	// SetSource sets the name of the service registry that is polled, so
+	// that polls are counted and timed in the metrics and traced
+	SetSource(string)
 }
 
 type funcPoller struct {
 	interval time.Duration
 	mainCtx  context.Context
 	pollFunc fn
+	source   string
 }
 
 // New returns a new instance of a poller
@@ -54,13 +63,17 @@ func (p *funcPoller) SetPollFunction(function fn) {
 	p.pollFunc = function
 }
 
+func (p *funcPoller) SetSource(source string) {
+	p.source = source
+}
+
 // Start starts the poller
 func (p *funcPoller) Start() error {
 	if p.pollFunc == nil {
 		return errors.New("poll function is not set")
 	}
 
-	p.pollFunc()
+	p.call()
 
 	// Now poll on a timer
 	go p.poll()
@@ -76,7 +89,7 @@ func (p *funcPoller) poll() {
 		// Which one happens first?
 		select {
 		case <-ticker.C:
-			go p.pollFunc()
+			go p.call()
 		case <-p.mainCtx.Done():
 			l.Info().Msg("stop requested")
 			ticker.Stop()
@@ -84,3 +97,20 @@ func (p *funcPoller) poll() {
 		}
 	}
 }
+
+// call executes the poll function and, if the poller has a source, records
+// it in the metrics and in a span.
+func (p *funcPoller) call() {
+	if len(p.source) == 0 {
+		p.pollFunc(p.mainCtx)
+		return
+	}
+
+	ctx, span := tracing.Tracer().Start(p.mainCtx, "poll", trace.WithAttributes(attribute.String("cnwan.source", p.source)))
+	defer span.End()
+
+	start := time.Now()
+	p.pollFunc(ctx)
+	metrics.Polls.WithLabelValues(p.source).Inc()
+	metrics.PollDuration.WithLabelValues(p.source).Observe(time.Since(start).Seconds())
+}
@@ -23,6 +23,8 @@ import (
 	"testing"
 	"time"
 
+	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	assert "github.com/stretchr/testify/assert"
 )
 
@@ -30,7 +32,7 @@ type fakeData struct {
 	count int
 }
 
-func (f *fakeData) call() {
+func (f *fakeData) call(context.Context) {
 	f.count++
 }
 
@@ -50,3 +52,17 @@ func TestPoll(t *testing.T) {
 		assert.Fail(t, "polled more than twice or 3 times")
 	}
 }
+
+func TestPollMetrics(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	d := &fakeData{}
+	polls := testutil.ToFloat64(metrics.Polls.WithLabelValues("test"))
+	p := New(ctx, 60)
+	p.SetPollFunction(d.call)
+	p.SetSource("test")
+	p.Start()
+
+	assert.Equal(t, 1, d.count)
+	assert.Equal(t, polls+1, testutil.ToFloat64(metrics.Polls.WithLabelValues("test")))
+}
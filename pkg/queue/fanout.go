@@ -0,0 +1,177 @@
+// Copyright © 2021 Cisco
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// All rights reserved.
+
+package queue
+
+import (
+	"context"
+	"sync"
+
+	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/audit"
+	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/openapi"
+	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/services"
+)
+
+// Target is an adaptor where data is sent to.
+type Target struct {
+	// Name of the adaptor, used to identify it in logs.
+	Name string
+	// Handler that sends data to the adaptor.
+	Handler services.Handler
+	// Selector contains the metadata that an endpoint must have in order
+	// to be sent to this adaptor. A key with an empty value only requires
+	// the key to be there. If empty, all endpoints are sent.
+	Selector map[string]string
+	// Options about how to retry sending data to this adaptor.
+	Options *Options
+	// Audit is where to record the batches of events sent to this adaptor.
+	// If nil, they are not recorded.
+	Audit *audit.Log
+}
+
+type fanOutQueue struct {
+	targets []*fanOutTarget
+}
+
+type fanOutTarget struct {
+	queue    Queue
+	selector map[string]string
+	lock     sync.Mutex
+	// selected contains the IDs of the endpoints that have been sent to
+	// the adaptor, so that it is told to delete them when they don't match
+	// the selector anymore. Events are keyed by the ID of their endpoint.
+	selected map[string]bool
+}
+
+// NewFanOut returns a Queue that sends data to all targets.
+// Each target has its own queue, so a slow or failing adaptor does not hold
+// up the others.
+func NewFanOut(ctx context.Context, targets []*Target) Queue {
+	fanOut := &fanOutQueue{targets: make([]*fanOutTarget, len(targets))}
+	for i, target := range targets {
+		opts := Options{}
+		if target.Options != nil {
+			opts = *target.Options
+		}
+		opts.name = target.Name
+		opts.audit = target.Audit
+
+		fanOut.targets[i] = &fanOutTarget{
+			queue:    New(ctx, target.Handler, &opts),
+			selector: target.Selector,
+			selected: map[string]bool{},
+		}
+	}
+
+	return fanOut
+}
+
+// Enqueue sends the events to the queue of each target, after filtering them
+// with the target's selector.
+func (f *fanOutQueue) Enqueue(ctx context.Context, events map[string]*openapi.Event) {
+	for _, target := range f.targets {
+		target.enqueue(ctx, events)
+	}
+}
+
+// Sync sends the services to the queue of each target, after filtering them
+// with the target's selector.
+func (f *fanOutQueue) Sync(servs []openapi.Service) {
+	for _, target := range f.targets {
+		target.sync(servs)
+	}
+}
+
+func (t *fanOutTarget) enqueue(ctx context.Context, events map[string]*openapi.Event) {
+	if len(t.selector) == 0 {
+		t.queue.Enqueue(ctx, events)
+		return
+	}
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	filtered := map[string]*openapi.Event{}
+	for key, event := range events {
+		matches := event.Event != "delete" && matchesSelector(event.Service, t.selector)
+		wasSelected := t.selected[key]
+
+		switch {
+		case matches && wasSelected:
+			filtered[key] = event
+		case matches:
+			// For this adaptor, the endpoint has just been created
+			ev := *event
+			ev.Event = "create"
+			filtered[key] = &ev
+			t.selected[key] = true
+		case wasSelected:
+			// For this adaptor, the endpoint has just been deleted
+			ev := *event
+			ev.Event = "delete"
+			filtered[key] = &ev
+			delete(t.selected, key)
+		}
+	}
+
+	if len(filtered) > 0 {
+		t.queue.Enqueue(ctx, filtered)
+	}
+}
+
+func (t *fanOutTarget) sync(servs []openapi.Service) {
+	if len(t.selector) == 0 {
+		t.queue.Sync(servs)
+		return
+	}
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	// The adaptor gets the filtered state either as it is or, if it can't
+	// sync, as the events that turn what it has been sent into it: either
+	// way, it ends up with the selected endpoints only.
+	filtered := []openapi.Service{}
+	t.selected = map[string]bool{}
+	for _, serv := range servs {
+		if matchesSelector(serv, t.selector) {
+			filtered = append(filtered, serv)
+			t.selected[serv.Id] = true
+		}
+	}
+
+	t.queue.Sync(filtered)
+}
+
+// matchesSelector returns true if the service has all the metadata in
+// selector.
+func matchesSelector(serv openapi.Service, selector map[string]string) bool {
+	metadata := make(map[string]string, len(serv.Metadata))
+	for _, m := range serv.Metadata {
+		metadata[m.Key] = m.Value
+	}
+
+	for key, val := range selector {
+		servVal, exists := metadata[key]
+		if !exists || (len(val) > 0 && val != servVal) {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,221 @@
+// Copyright © 2021 Cisco
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// All rights reserved.
+
+package queue
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/openapi"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeBlocking struct {
+	unblock chan struct{}
+}
+
+func (f *fakeBlocking) Send(ctx context.Context, events []openapi.Event) error {
+	<-f.unblock
+	return nil
+}
+
+func TestFanOut(t *testing.T) {
+	a := assert.New(t)
+	ctx, canc := context.WithCancel(context.Background())
+	defer canc()
+
+	newRecorder := func() *fakeSyncer {
+		return &fakeSyncer{
+			fakeRecorder: fakeRecorder{
+				batchIDs: make(chan string, 10),
+				batches:  make(chan []openapi.Event, 10),
+			},
+			states: make(chan []openapi.Service, 10),
+		}
+	}
+	all, video := newRecorder(), newRecorder()
+	blocking := &fakeBlocking{unblock: make(chan struct{})}
+	defer close(blocking.unblock)
+
+	q := NewFanOut(ctx, []*Target{
+		{Name: "blocking", Handler: blocking},
+		{Name: "all", Handler: all},
+		{Name: "video", Handler: video, Selector: map[string]string{"profile": "video"}},
+	})
+
+	endpoint := func(profile string) openapi.Service {
+		return openapi.Service{
+			Id:       "ns/serv/endp",
+			Metadata: []openapi.Metadata{{Key: "profile", Value: profile}},
+		}
+	}
+
+	cases := []struct {
+		event    *openapi.Event
+		expVideo string
+	}{
+		{
+			event: &openapi.Event{Event: "create", Service: endpoint("voice")},
+		},
+		{
+			event:    &openapi.Event{Event: "update", Service: endpoint("video")},
+			expVideo: "create",
+		},
+		{
+			event:    &openapi.Event{Event: "update", Service: endpoint("video")},
+			expVideo: "update",
+		},
+		{
+			event:    &openapi.Event{Event: "update", Service: endpoint("voice")},
+			expVideo: "delete",
+		},
+		{
+			event: &openapi.Event{Event: "delete", Service: endpoint("voice")},
+		},
+	}
+
+	failed := func(i int) {
+		a.FailNow("case failed", fmt.Sprintf("case %d", i))
+	}
+	for i, currCase := range cases {
+		// This must not be held up by the blocking adaptor
+		q.Enqueue(ctx, map[string]*openapi.Event{"ns/serv/endp": currCase.event})
+
+		select {
+		case batch := <-all.batches:
+			if !a.Len(batch, 1) || !a.Equal(currCase.event.Event, batch[0].Event) {
+				failed(i)
+			}
+		case <-time.After(time.Second):
+			failed(i)
+		}
+
+		select {
+		case batch := <-video.batches:
+			if !a.Len(batch, 1) || !a.Equal(currCase.expVideo, batch[0].Event) {
+				failed(i)
+			}
+		case <-time.After(100 * time.Millisecond):
+			if len(currCase.expVideo) > 0 {
+				failed(i)
+			}
+		}
+	}
+
+	// The state is filtered as well
+	q.Sync([]openapi.Service{
+		endpoint("video"),
+		{Id: "ns/serv/other", Metadata: []openapi.Metadata{{Key: "profile", Value: "voice"}}},
+	})
+	a.Len(<-all.states, 2)
+	a.Equal([]openapi.Service{endpoint("video")}, <-video.states)
+
+	q.Enqueue(ctx, map[string]*openapi.Event{"ns/serv/endp": {Event: "delete", Service: endpoint("video")}})
+	batch := <-video.batches
+	if a.Len(batch, 1) {
+		a.Equal("delete", batch[0].Event)
+	}
+}
+
+func TestMatchesSelector(t *testing.T) {
+	a := assert.New(t)
+	serv := openapi.Service{
+		Metadata: []openapi.Metadata{
+			{Key: "profile", Value: "video"},
+			{Key: "tier", Value: "gold"},
+		},
+	}
+
+	cases := []struct {
+		selector map[string]string
+		expRes   bool
+	}{
+		{
+			expRes: true,
+		},
+		{
+			selector: map[string]string{"profile": "video", "tier": "gold"},
+			expRes:   true,
+		},
+		{
+			selector: map[string]string{"profile": ""},
+			expRes:   true,
+		},
+		{
+			selector: map[string]string{"profile": "voice"},
+		},
+		{
+			selector: map[string]string{"region": ""},
+		},
+	}
+
+	for i, currCase := range cases {
+		if !a.Equal(currCase.expRes, matchesSelector(serv, currCase.selector)) {
+			a.FailNow("case failed", fmt.Sprintf("case %d", i))
+		}
+	}
+}
+
+func TestFanOutSyncWithoutSyncer(t *testing.T) {
+	a := assert.New(t)
+	ctx, canc := context.WithCancel(context.Background())
+	defer canc()
+
+	video := &fakeRecorder{
+		batchIDs: make(chan string, 10),
+		batches:  make(chan []openapi.Event, 10),
+	}
+	q := NewFanOut(ctx, []*Target{
+		{Name: "video", Handler: video, Selector: map[string]string{"profile": "video"}},
+	})
+	endpoint := func(id, profile string) openapi.Service {
+		return openapi.Service{
+			Id:       id,
+			Metadata: []openapi.Metadata{{Key: "profile", Value: profile}},
+		}
+	}
+	receive := func() map[string]string {
+		received := map[string]string{}
+		select {
+		case batch := <-video.batches:
+			for _, ev := range batch {
+				received[ev.Service.Id] = ev.Event
+			}
+		case <-time.After(time.Second):
+			a.FailNow("timeout while waiting for events")
+		}
+		return received
+	}
+
+	q.Enqueue(ctx, map[string]*openapi.Event{"ns/serv/first": {Event: "create", Service: endpoint("ns/serv/first", "video")}})
+	a.Equal(map[string]string{"ns/serv/first": "create"}, receive())
+
+	// Endpoints selected by the state are created, and the others deleted,
+	// so that later events are consistent with what the adaptor has got
+	q.Sync([]openapi.Service{endpoint("ns/serv/first", "voice"), endpoint("ns/serv/second", "video")})
+	a.Equal(map[string]string{"ns/serv/first": "delete", "ns/serv/second": "create"}, receive())
+
+	q.Enqueue(ctx, map[string]*openapi.Event{
+		"ns/serv/first":  {Event: "update", Service: endpoint("ns/serv/first", "video")},
+		"ns/serv/second": {Event: "update", Service: endpoint("ns/serv/second", "voice")},
+	})
+	a.Equal(map[string]string{"ns/serv/first": "create", "ns/serv/second": "delete"}, receive())
+}
@@ -20,35 +20,143 @@ package queue
 
 import (
 	"context"
+	"reflect"
 	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/audit"
+	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/metrics"
 	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/openapi"
 	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/services"
+	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/tracing"
+	"github.com/google/uuid"
 	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // Queue contains data that will be sent to a handler
 type Queue interface {
-	// Enqueue intructs the queue that a new data must be sent on next request
-	Enqueue(events map[string]*openapi.Event)
+	// Enqueue intructs the queue that a new data must be sent on next request.
+	// The span in ctx, if any, is linked to the one of the batch that
+	// sends the events
+	Enqueue(ctx context.Context, events map[string]*openapi.Event)
+	// Sync instructs the queue that the full current state must be sent on
+	// next request. Events that have not been sent yet are discarded if the
+	// state already includes them, and sent after it otherwise, as they may
+	// have happened after the state was taken.
+	// Handlers that don't support receiving the state are sent the events
+	// that turn what they have been sent so far into it.
+	Sync(services []openapi.Service)
+}
+
+const (
+	// DefaultMinBackoff is the time to wait before retrying to send data
+	// for the first time.
+	DefaultMinBackoff time.Duration = time.Second
+	// DefaultMaxBackoff is the maximum time to wait before retrying to send
+	// data.
+	DefaultMaxBackoff time.Duration = time.Minute
+)
+
+// lastSequence is the sequence number of the latest event enqueued by any
+// queue. It is shared, so that sequences keep increasing when an endpoint is
+// created again or when a queue is replaced, e.g. by a new leader term.
+var lastSequence int64
+
+// Options contains options about how the queue should retry sending data
+// that could not be sent.
+type Options struct {
+	// MinBackoff is the time to wait before retrying for the first time.
+	// It is doubled after each failure, up to MaxBackoff.
+	// If 0, DefaultMinBackoff is used.
+	MinBackoff time.Duration
+	// MaxBackoff is the maximum time to wait before retrying.
+	// If 0, DefaultMaxBackoff is used.
+	MaxBackoff time.Duration
+
+	// name of the adaptor, used in logs
+	name string
+	// audit records the batches of events sent, if not nil
+	audit *audit.Log
 }
 
 type senderWorkQueue struct {
-	mainCtx      context.Context
-	lock         sync.Mutex
-	wakeUp       chan int
-	queue        map[string]*openapi.Event
+	mainCtx     context.Context
+	lock        sync.Mutex
+	wakeUp      chan int
+	queue       map[string]*openapi.Event
+	links       map[string]trace.Link
+	syncState   []openapi.Service
+	syncPending bool
+	// pending and pendingState are the batches being sent, or waiting to
+	// be sent again after a failure. They are only written by the worker.
+	pending      *batch
+	pendingState *batch
+	retrying     bool
 	servsHandler services.Handler
+	syncer       services.Syncer
+	// known contains the services that have been enqueued, keyed by their
+	// ID, if the handler is not a Syncer. Such handlers are sent the
+	// differences with the state instead of the state itself.
+	known      map[string]openapi.Service
+	name       string
+	auditLog   *audit.Log
+	minBackoff time.Duration
+	maxBackoff time.Duration
+	// backoff is only used by the worker, so it is not protected by lock
+	backoff time.Duration
+}
+
+// batch is sent to the handler in a single request. If that fails, it is
+// sent again as it is, with the same ID, so the adaptor can recognize it.
+type batch struct {
+	id string
+	// queued contains the events keyed as they were enqueued
+	queued map[string]*openapi.Event
+	events []openapi.Event
+	links  []trace.Link
+	state  []openapi.Service
 }
 
 // New returns a Queue that receives data and sends it in bulk whenever
-// possible
-func New(ctx context.Context, servsHandler services.Handler) Queue {
+// possible.
+// Data that could not be sent is sent again later, waiting more and more
+// after each failure as specified by opts. If opts is nil, the default
+// values are used.
+func New(ctx context.Context, servsHandler services.Handler, opts *Options) Queue {
+	if opts == nil {
+		opts = &Options{}
+	}
+
 	queue := &senderWorkQueue{
-		mainCtx:      ctx,
-		wakeUp:       make(chan int),
+		mainCtx: services.WithAdaptorName(ctx, opts.name),
+		// The channel is buffered, so that waking up a busy worker does
+		// not block the caller.
+		wakeUp:       make(chan int, 1),
 		queue:        map[string]*openapi.Event{},
+		links:        map[string]trace.Link{},
 		servsHandler: servsHandler,
+		name:         opts.name,
+		auditLog:     opts.audit,
+		minBackoff:   opts.MinBackoff,
+		maxBackoff:   opts.MaxBackoff,
+	}
+	// Handlers that don't support sending the current state, e.g. the
+	// stdout sink, get the differences with what they have been sent
+	queue.syncer, _ = servsHandler.(services.Syncer)
+	if queue.syncer == nil {
+		queue.known = map[string]openapi.Service{}
+	}
+	if queue.minBackoff <= 0 {
+		queue.minBackoff = DefaultMinBackoff
+	}
+	if queue.maxBackoff <= 0 {
+		queue.maxBackoff = DefaultMaxBackoff
+	}
+	if queue.maxBackoff < queue.minBackoff {
+		queue.maxBackoff = queue.minBackoff
 	}
 
 	go queue.work()
@@ -56,30 +164,161 @@ func New(ctx context.Context, servsHandler services.Handler) Queue {
 	return queue
 }
 
-// Enqueue intructs the queue that new data must be sent on next request
-func (s *senderWorkQueue) Enqueue(events map[string]*openapi.Event) {
+// Enqueue intructs the queue that new data must be sent on next request.
+// Each event is given a unique ID, the time it was enqueued and the next
+// sequence number.
+func (s *senderWorkQueue) Enqueue(ctx context.Context, events map[string]*openapi.Event) {
+	spanCtx := trace.SpanContextFromContext(ctx)
 	wake := func() bool {
 		s.lock.Lock()
 		defer s.lock.Unlock()
 
-		shouldWakeUp := true
-		if len(s.queue) > 0 {
-			// There was already something in the queue. It means that the
-			// worker is already awake, no need to do it again.
-			shouldWakeUp = false
+		return s.add(spanCtx, events)
+	}()
+
+	if wake {
+		s.wake()
+	}
+}
+
+// add adds the events to the queue and returns true if the worker must be
+// woken up. It must be called with the lock held.
+func (s *senderWorkQueue) add(spanCtx trace.SpanContext, events map[string]*openapi.Event) bool {
+	if len(events) == 0 {
+		return false
+	}
+
+	// If there was already something in the queue, or the worker is
+	// waiting to send data again, the worker will take care of it: no need
+	// to wake it up.
+	shouldWakeUp := len(s.queue) == 0 && !s.syncPending && !s.retrying
+
+	now := time.Now().UTC()
+	for key, event := range events {
+		// Copy the event, so the caller's one is not modified
+		ev := *event
+		ev.Id = uuid.New().String()
+		ev.Timestamp = now
+		ev.Sequence = atomic.AddInt64(&lastSequence, 1)
+		s.queue[key] = &ev
+
+		// Keep the span where the endpoint changed first, so the
+		// batch shows how long changes have waited in the queue
+		if _, exists := s.links[key]; !exists && spanCtx.IsValid() {
+			s.links[key] = trace.Link{SpanContext: spanCtx}
 		}
 
-		for key, event := range events {
-			s.queue[key] = event
+		if s.known != nil {
+			if ev.Event == "delete" {
+				delete(s.known, key)
+			} else {
+				s.known[key] = ev.Service
+			}
 		}
+	}
+	s.setDepth()
+
+	return shouldWakeUp
+}
+
+// Sync instructs the queue that the full current state must be sent on next
+// request. If the handler does not support it, the differences with the
+// services enqueued so far are enqueued instead.
+func (s *senderWorkQueue) Sync(servs []openapi.Service) {
+	if s.syncer == nil {
+		wake := func() bool {
+			s.lock.Lock()
+			defer s.lock.Unlock()
+
+			return s.add(trace.SpanContext{}, s.diff(byID(servs)))
+		}()
+
+		if wake {
+			s.wake()
+		}
+		return
+	}
+
+	wake := func() bool {
+		s.lock.Lock()
+		defer s.lock.Unlock()
+
+		shouldWakeUp := len(s.queue) == 0 && !s.syncPending && !s.retrying
+
+		// The state may have been taken before some of the events were
+		// enqueued, so only the ones it already reflects are discarded
+		state := byID(servs)
+		for key, event := range s.queue {
+			if !includes(state, event) {
+				continue
+			}
+
+			delete(s.queue, key)
+			delete(s.links, key)
+		}
+		s.syncState = servs
+		s.syncPending = true
+		s.setDepth()
 
 		return shouldWakeUp
 	}()
 
 	if wake {
-		// Wake up the consumer
-		// 0 is a dumb value
-		s.wakeUp <- 0
+		s.wake()
+	}
+}
+
+// byID returns the services keyed by their ID.
+func byID(servs []openapi.Service) map[string]*openapi.Service {
+	state := make(map[string]*openapi.Service, len(servs))
+	for i := range servs {
+		state[servs[i].Id] = &servs[i]
+	}
+
+	return state
+}
+
+// diff returns the events that turn the known services into the state,
+// keyed by the ID of each service. It must be called with the lock held.
+func (s *senderWorkQueue) diff(state map[string]*openapi.Service) map[string]*openapi.Event {
+	events := map[string]*openapi.Event{}
+	for id, serv := range state {
+		known, exists := s.known[id]
+		switch {
+		case !exists:
+			events[id] = &openapi.Event{Event: "create", Service: *serv}
+		case !reflect.DeepEqual(known, *serv):
+			events[id] = &openapi.Event{Event: "update", Service: *serv}
+		}
+	}
+
+	for id, known := range s.known {
+		if _, exists := state[id]; !exists {
+			events[id] = &openapi.Event{Event: "delete", Service: known}
+		}
+	}
+
+	return events
+}
+
+// includes returns true if the state, keyed by the ID of each service,
+// already reflects the event.
+func includes(state map[string]*openapi.Service, event *openapi.Event) bool {
+	serv, exists := state[event.Service.Id]
+	if event.Event == "delete" {
+		return !exists
+	}
+
+	return exists && reflect.DeepEqual(*serv, event.Service)
+}
+
+// wake wakes up the worker, without waiting for it to be ready.
+func (s *senderWorkQueue) wake() {
+	select {
+	// 0 is a dumb value
+	case s.wakeUp <- 0:
+	default:
+		// The worker has already been woken up
 	}
 }
 
@@ -100,33 +339,212 @@ func (s *senderWorkQueue) work() {
 }
 
 func (s *senderWorkQueue) sendData() {
-	l := log.With().Str("func", "queue.senderWorkQueue.sendData").Logger()
+	for {
+		s.next()
 
-	data := func() []openapi.Event {
-		s.lock.Lock()
-		defer s.lock.Unlock()
-		events := make([]openapi.Event, 0, len(s.queue))
+		switch {
+		case s.pending != nil:
+			if !s.sendEvents(s.pending) {
+				s.retry()
+				return
+			}
 
-		// We copy the queue to an array so that we can directly send it,
-		// this way we release the lock immediately, so other components
-		// can enqueue new data while we're busy sending.
-		for _, event := range s.queue {
-			events = append(events, *event)
+			s.lock.Lock()
+			s.pending = nil
+			s.setDepth()
+			s.lock.Unlock()
+		case s.pendingState != nil:
+			if !s.sendState(s.pendingState) {
+				s.retry()
+				return
+			}
+
+			s.lock.Lock()
+			s.pendingState = nil
+			s.lock.Unlock()
+		default:
+			return
 		}
 
-		// Empty the queue, so we don't resend these values again
-		s.queue = map[string]*openapi.Event{}
+		s.backoff = 0
+	}
+}
 
-		return events
-	}()
+// next prepares the batches to send. Events that could not be sent are sent
+// again first, as they are, unless a newer state already includes them. New
+// events are put together in a new batch, to be sent after the state.
+func (s *senderWorkQueue) next() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.syncPending {
+		s.pendingState = &batch{id: uuid.New().String(), state: s.syncState}
+		s.syncState, s.syncPending = nil, false
+
+		if s.pending != nil && includesAll(byID(s.pendingState.state), s.pending.queued) {
+			s.pending = nil
+		}
+	}
+
+	if s.pending != nil || s.pendingState != nil || len(s.queue) == 0 {
+		return
+	}
+
+	// We take the queue so that we can directly send it, this way we
+	// release the lock immediately, so other components can enqueue new
+	// data while we're busy sending.
+	b := &batch{
+		id:     uuid.New().String(),
+		queued: s.queue,
+		events: make([]openapi.Event, 0, len(s.queue)),
+		links:  make([]trace.Link, 0, len(s.links)),
+	}
+	for _, event := range s.queue {
+		b.events = append(b.events, *event)
+	}
+	for _, link := range s.links {
+		b.links = append(b.links, link)
+	}
+	s.pending = b
+
+	// Empty the queue, so we don't resend these values again
+	s.queue = map[string]*openapi.Event{}
+	s.links = map[string]trace.Link{}
+}
+
+// includesAll returns true if the state, keyed by the ID of each service,
+// already reflects all the events.
+func includesAll(state map[string]*openapi.Service, events map[string]*openapi.Event) bool {
+	for _, event := range events {
+		if !includes(state, event) {
+			return false
+		}
+	}
+
+	return true
+}
 
-	l = l.With().Int("length", len(data)).Logger()
+// setDepth updates the number of events waiting to be sent. It must be called
+// with the lock held.
+func (s *senderWorkQueue) setDepth() {
+	depth := len(s.queue)
+	if s.pending != nil {
+		depth += len(s.pending.events)
+	}
+	metrics.QueueDepth.WithLabelValues(s.name).Set(float64(depth))
+}
+
+// sendEvents sends a batch of events to the handler and returns true if it
+// was sent successfully.
+func (s *senderWorkQueue) sendEvents(b *batch) bool {
+	l := log.With().Str("func", "queue.senderWorkQueue.sendEvents").Str("adaptor", s.name).
+		Int("length", len(b.events)).Str("batch-id", b.id).Logger()
 	l.Info().Msg("sending data...")
 
-	if err := s.servsHandler.Send((data)); err != nil {
+	metrics.BatchSize.WithLabelValues(s.name, metrics.OperationSend).Observe(float64(len(b.events)))
+	ctx, span := tracing.Tracer().Start(s.mainCtx, "queue.batch", trace.WithLinks(b.links...), trace.WithAttributes(
+		attribute.String("cnwan.adaptor", s.name),
+		attribute.String("cnwan.batch_id", b.id),
+		attribute.Int("cnwan.events", len(b.events)),
+	))
+	sendCtx, sendSpan := tracing.Tracer().Start(ctx, "SendEvents", trace.WithSpanKind(trace.SpanKindClient))
+	start := time.Now()
+	result := &services.Result{}
+	err := s.servsHandler.Send(services.WithResult(services.WithBatchID(sendCtx, b.id), result), b.events)
+	metrics.SendDuration.WithLabelValues(s.name, metrics.OperationSend, metrics.Result(err)).Observe(time.Since(start).Seconds())
+	tracing.End(sendSpan, err)
+	tracing.End(span, err)
+	s.record(start, b.id, b.events, result, err)
+	if err != nil {
 		// The error is logged from the service handler
-		return
+		return false
 	}
 
 	l.Info().Msg("events sent successfully")
+	return true
+}
+
+// record writes the batch to the audit log, if any, along with what the
+// adaptor replied.
+func (s *senderWorkQueue) record(sentAt time.Time, batchID string, events []openapi.Event, result *services.Result, err error) {
+	if s.auditLog == nil {
+		return
+	}
+
+	rec := &audit.Record{
+		Time:           sentAt.UTC(),
+		Adaptor:        s.name,
+		BatchID:        batchID,
+		StatusCode:     result.StatusCode,
+		ResourceErrors: result.Errors,
+		Events:         events,
+	}
+	if err != nil {
+		rec.Error = err.Error()
+	}
+
+	if err := s.auditLog.Write(rec); err != nil {
+		log.Err(err).Str("func", "queue.senderWorkQueue.record").Str("adaptor", s.name).Msg("could not write to the audit log")
+	}
+}
+
+// retry wakes up the worker after some time, to send again the data that
+// could not be sent.
+func (s *senderWorkQueue) retry() {
+	l := log.With().Str("func", "queue.senderWorkQueue.retry").Str("adaptor", s.name).Logger()
+
+	s.lock.Lock()
+	s.retrying = true
+	s.lock.Unlock()
+
+	switch {
+	case s.backoff == 0:
+		s.backoff = s.minBackoff
+	case s.backoff*2 > s.maxBackoff:
+		s.backoff = s.maxBackoff
+	default:
+		s.backoff *= 2
+	}
+
+	// Data received while sending has to wait as well
+	select {
+	case <-s.wakeUp:
+	default:
+	}
+
+	l.Warn().Str("backoff", s.backoff.String()).Msg("could not send data, retrying later...")
+	time.AfterFunc(s.backoff, func() {
+		s.lock.Lock()
+		s.retrying = false
+		s.lock.Unlock()
+		s.wake()
+	})
+}
+
+// sendState sends the current state to the handler and returns true if it
+// was sent successfully.
+func (s *senderWorkQueue) sendState(b *batch) bool {
+	l := log.With().Str("func", "queue.senderWorkQueue.sendState").Str("adaptor", s.name).
+		Int("length", len(b.state)).Str("batch-id", b.id).Logger()
+	l.Info().Msg("sending current state...")
+
+	metrics.BatchSize.WithLabelValues(s.name, metrics.OperationSync).Observe(float64(len(b.state)))
+	ctx, span := tracing.Tracer().Start(s.mainCtx, "queue.sync", trace.WithAttributes(
+		attribute.String("cnwan.adaptor", s.name),
+		attribute.String("cnwan.batch_id", b.id),
+		attribute.Int("cnwan.services", len(b.state)),
+	))
+	syncCtx, syncSpan := tracing.Tracer().Start(ctx, "SyncServices", trace.WithSpanKind(trace.SpanKindClient))
+	start := time.Now()
+	err := s.syncer.Sync(services.WithBatchID(syncCtx, b.id), b.state)
+	metrics.SendDuration.WithLabelValues(s.name, metrics.OperationSync, metrics.Result(err)).Observe(time.Since(start).Seconds())
+	tracing.End(syncSpan, err)
+	tracing.End(span, err)
+	if err != nil {
+		// The error is logged from the service handler
+		return false
+	}
+
+	l.Info().Msg("current state sent successfully")
+	return true
 }
@@ -20,11 +20,24 @@ package queue
 
 import (
 	"context"
+	"fmt"
+	"path"
 	"testing"
 	"time"
 
+	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/audit"
+	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/metrics"
 	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/openapi"
+	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/services"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
 	assert "github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
 )
 
 var (
@@ -35,7 +48,7 @@ type fakeHandler struct {
 	t *testing.T
 }
 
-func (f *fakeHandler) Send(events []openapi.Event) error {
+func (f *fakeHandler) Send(ctx context.Context, events []openapi.Event) error {
 	// Emulate process
 	time.Sleep(5 * time.Second)
 	result <- len(events)
@@ -88,10 +101,10 @@ func TestEnqueue(t *testing.T) {
 	ctx, canc := context.WithCancel(context.Background())
 	defer canc()
 
-	q := New(ctx, f)
-	go q.Enqueue(firstMap)
+	q := New(ctx, f, nil)
+	go q.Enqueue(ctx, firstMap)
 	time.Sleep(2 * time.Second)
-	go q.Enqueue(secondMap)
+	go q.Enqueue(ctx, secondMap)
 
 	// Block here, for the first call
 	firstCall := <-result
@@ -105,3 +118,406 @@ func TestEnqueue(t *testing.T) {
 		assert.Fail(t, "second call had not 3 items but", secondCall)
 	}
 }
+
+type fakeRecorder struct {
+	batchIDs chan string
+	batches  chan []openapi.Event
+}
+
+func (f *fakeRecorder) Send(ctx context.Context, events []openapi.Event) error {
+	f.batchIDs <- services.BatchIDFromContext(ctx)
+	f.batches <- events
+	return nil
+}
+
+func TestEnqueueIdentifiers(t *testing.T) {
+	a := assert.New(t)
+	f := &fakeRecorder{
+		batchIDs: make(chan string, 2),
+		batches:  make(chan []openapi.Event, 2),
+	}
+	event := &openapi.Event{
+		Event:   "create",
+		Service: openapi.Service{Id: "ns/serv/endp", Name: "endp"},
+	}
+
+	ctx, canc := context.WithCancel(context.Background())
+	defer canc()
+
+	q := New(ctx, f, nil)
+	q.Enqueue(ctx, map[string]*openapi.Event{"ns/serv/endp": event})
+	firstBatchID, firstBatch := <-f.batchIDs, <-f.batches
+	q.Enqueue(ctx, map[string]*openapi.Event{"ns/serv/endp": event})
+	secondBatchID, secondBatch := <-f.batchIDs, <-f.batches
+
+	a.Empty(event.Id)
+	a.NotEmpty(firstBatchID)
+	a.NotEqual(firstBatchID, secondBatchID)
+	if !a.Len(firstBatch, 1) || !a.Len(secondBatch, 1) {
+		return
+	}
+
+	first, second := firstBatch[0], secondBatch[0]
+	a.NotEmpty(first.Id)
+	a.NotEqual(first.Id, second.Id)
+	a.False(first.Timestamp.IsZero())
+	a.False(second.Timestamp.Before(first.Timestamp))
+	a.Positive(first.Sequence)
+	a.Greater(second.Sequence, first.Sequence)
+}
+
+func TestSequenceAfterDelete(t *testing.T) {
+	a := assert.New(t)
+	f := &fakeRecorder{
+		batchIDs: make(chan string, 3),
+		batches:  make(chan []openapi.Event, 3),
+	}
+	send := func(q Queue, event string) int64 {
+		q.Enqueue(context.Background(), map[string]*openapi.Event{"ns/serv/endp": {Event: event}})
+		<-f.batchIDs
+		batch := <-f.batches
+		if !a.Len(batch, 1) {
+			a.FailNow("wrong batch")
+		}
+		return batch[0].Sequence
+	}
+
+	ctx, canc := context.WithCancel(context.Background())
+	defer canc()
+
+	// Adaptors that keep the latest sequence of each endpoint must not
+	// discard it when it is created again
+	q := New(ctx, f, nil)
+	created := send(q, "create")
+	deleted := send(q, "delete")
+	a.Greater(deleted, created)
+	a.Greater(send(q, "create"), deleted)
+
+	// The same goes for a queue that replaces another one
+	a.Greater(send(New(ctx, f, nil), "create"), deleted)
+}
+
+type fakeSyncer struct {
+	fakeRecorder
+	states chan []openapi.Service
+}
+
+func (f *fakeSyncer) Sync(ctx context.Context, servs []openapi.Service) error {
+	f.batchIDs <- services.BatchIDFromContext(ctx)
+	f.states <- servs
+	return nil
+}
+
+func TestSync(t *testing.T) {
+	a := assert.New(t)
+	f := &fakeSyncer{
+		fakeRecorder: fakeRecorder{
+			batchIDs: make(chan string, 2),
+			batches:  make(chan []openapi.Event, 2),
+		},
+		states: make(chan []openapi.Service, 2),
+	}
+	state := []openapi.Service{{Id: "ns/serv/endp", Name: "endp"}}
+
+	ctx, canc := context.WithCancel(context.Background())
+	defer canc()
+
+	q := New(ctx, f, nil).(*senderWorkQueue)
+
+	// Pending events are discarded if the state already includes them,
+	// and sent after it otherwise.
+	newer := &openapi.Event{Event: "create", Service: openapi.Service{Id: "ns/serv/endp-1", Name: "endp-1"}}
+	q.lock.Lock()
+	q.queue["ns/serv/endp"] = &openapi.Event{Event: "create", Service: state[0]}
+	q.queue["ns/serv/endp-1"] = newer
+	q.lock.Unlock()
+	q.Sync(state)
+	q.wakeUp <- 0
+
+	a.NotEmpty(<-f.batchIDs)
+	a.Equal(state, <-f.states)
+	a.NotEmpty(<-f.batchIDs)
+	a.Equal([]openapi.Event{*newer}, <-f.batches)
+}
+
+func TestSyncWithoutSyncer(t *testing.T) {
+	a := assert.New(t)
+	f := &fakeRecorder{
+		batchIDs: make(chan string, 1),
+		batches:  make(chan []openapi.Event, 1),
+	}
+	receive := func() map[string]string {
+		<-f.batchIDs
+		received := map[string]string{}
+		for _, ev := range <-f.batches {
+			received[ev.Service.Id] = ev.Event
+		}
+		return received
+	}
+	endp := openapi.Service{Id: "ns/serv/endp", Name: "endp", Port: 80}
+	moved := openapi.Service{Id: "ns/serv/endp", Name: "endp", Port: 8080}
+	other := openapi.Service{Id: "ns/serv/other", Name: "other", Port: 80}
+
+	ctx, canc := context.WithCancel(context.Background())
+	defer canc()
+
+	// Handlers that can't sync are sent the differences with the services
+	// they have been sent so far
+	q := New(ctx, f, nil)
+	q.Sync([]openapi.Service{endp})
+	a.Equal(map[string]string{"ns/serv/endp": "create"}, receive())
+
+	q.Enqueue(ctx, map[string]*openapi.Event{"ns/serv/other": {Event: "create", Service: other}})
+	a.Equal(map[string]string{"ns/serv/other": "create"}, receive())
+
+	q.Sync([]openapi.Service{moved, other})
+	a.Equal(map[string]string{"ns/serv/endp": "update"}, receive())
+
+	q.Sync([]openapi.Service{moved})
+	a.Equal(map[string]string{"ns/serv/other": "delete"}, receive())
+
+	// Nothing is sent if nothing changed
+	q.Sync([]openapi.Service{moved})
+	select {
+	case <-f.batches:
+		a.Fail("nothing should have been sent")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+type fakeFailing struct {
+	fakeRecorder
+	failures int
+}
+
+func (f *fakeFailing) Send(ctx context.Context, events []openapi.Event) error {
+	if f.failures > 0 {
+		f.failures--
+		return fmt.Errorf("adaptor unavailable")
+	}
+
+	return f.fakeRecorder.Send(ctx, events)
+}
+
+func TestRetry(t *testing.T) {
+	a := assert.New(t)
+	f := &fakeFailing{
+		fakeRecorder: fakeRecorder{
+			batchIDs: make(chan string, 2),
+			batches:  make(chan []openapi.Event, 2),
+		},
+		failures: 2,
+	}
+
+	ctx, canc := context.WithCancel(context.Background())
+	defer canc()
+
+	q := New(ctx, f, &Options{MinBackoff: 10 * time.Millisecond, MaxBackoff: 20 * time.Millisecond})
+	q.Enqueue(ctx, map[string]*openapi.Event{"ns/serv/endp": {Event: "create"}})
+
+	select {
+	case batch := <-f.batches:
+		if a.Len(batch, 1) {
+			a.Equal("create", batch[0].Event)
+		}
+	case <-time.After(time.Second):
+		a.FailNow("events should have been sent again")
+	}
+
+	// Newer events are sent after the ones that could not be sent
+	f.failures = 1
+	q.Enqueue(ctx, map[string]*openapi.Event{"ns/serv/endp": {Event: "update"}})
+	q.Enqueue(ctx, map[string]*openapi.Event{"ns/serv/endp": {Event: "delete"}})
+
+	received := []openapi.Event{}
+	for len(received) == 0 || received[len(received)-1].Event != "delete" {
+		select {
+		case batch := <-f.batches:
+			received = append(received, batch...)
+		case <-time.After(time.Second):
+			a.FailNow("events should have been sent again")
+		}
+	}
+
+	for i := 1; i < len(received); i++ {
+		a.Greater(received[i].Sequence, received[i-1].Sequence)
+	}
+}
+
+type fakeAttempts struct {
+	fakeRecorder
+	attempts chan string
+	failures int
+}
+
+func (f *fakeAttempts) Send(ctx context.Context, events []openapi.Event) error {
+	f.attempts <- services.BatchIDFromContext(ctx)
+	if f.failures > 0 {
+		f.failures--
+		return fmt.Errorf("adaptor unavailable")
+	}
+
+	return f.fakeRecorder.Send(ctx, events)
+}
+
+func TestRetrySameBatch(t *testing.T) {
+	a := assert.New(t)
+	f := &fakeAttempts{
+		fakeRecorder: fakeRecorder{
+			batchIDs: make(chan string, 2),
+			batches:  make(chan []openapi.Event, 2),
+		},
+		attempts: make(chan string, 3),
+		failures: 1,
+	}
+
+	ctx, canc := context.WithCancel(context.Background())
+	defer canc()
+
+	q := New(ctx, f, &Options{MinBackoff: 50 * time.Millisecond})
+	q.Enqueue(ctx, map[string]*openapi.Event{"ns/serv/endp": {Event: "create", Service: openapi.Service{Id: "ns/serv/endp"}}})
+	failedID := <-f.attempts
+	q.Enqueue(ctx, map[string]*openapi.Event{"ns/serv/endp-1": {Event: "create", Service: openapi.Service{Id: "ns/serv/endp-1"}}})
+
+	// The batch that failed is sent again as it is, and the new event
+	// comes in the next one
+	for i, expKey := range []string{"ns/serv/endp", "ns/serv/endp-1"} {
+		select {
+		case batchID := <-f.batchIDs:
+			batch := <-f.batches
+			a.Equal(i == 0, batchID == failedID)
+			if a.Len(batch, 1) {
+				a.Equal(expKey, batch[0].Service.Id)
+			}
+		case <-time.After(time.Second):
+			a.FailNow("events should have been sent")
+		}
+	}
+}
+
+func TestQueueMetrics(t *testing.T) {
+	a := assert.New(t)
+	f := &fakeFailing{
+		fakeRecorder: fakeRecorder{
+			batchIDs: make(chan string, 1),
+			batches:  make(chan []openapi.Event, 1),
+		},
+		failures: 1,
+	}
+	sent := func(result string) uint64 {
+		var m dto.Metric
+		metrics.SendDuration.WithLabelValues("metrics-test", metrics.OperationSend, result).(prometheus.Metric).Write(&m)
+		return m.GetHistogram().GetSampleCount()
+	}
+	failures, successes := sent(metrics.ResultFailure), sent(metrics.ResultSuccess)
+
+	ctx, canc := context.WithCancel(context.Background())
+	defer canc()
+
+	q := New(ctx, f, &Options{MinBackoff: 10 * time.Millisecond, name: "metrics-test"})
+	q.Enqueue(ctx, map[string]*openapi.Event{"ns/serv/endp": {Event: "create"}})
+
+	select {
+	case <-f.batches:
+	case <-time.After(time.Second):
+		a.FailNow("events should have been sent again")
+	}
+
+	// Metrics are recorded after the handler returns: one attempt failed
+	// and one succeeded
+	time.Sleep(10 * time.Millisecond)
+	a.Equal(float64(0), testutil.ToFloat64(metrics.QueueDepth.WithLabelValues("metrics-test")))
+	a.Equal(failures+1, sent(metrics.ResultFailure))
+	a.Equal(successes+1, sent(metrics.ResultSuccess))
+}
+
+func TestQueueTracing(t *testing.T) {
+	a := assert.New(t)
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	otel.SetTracerProvider(provider)
+	defer otel.SetTracerProvider(trace.NewNoopTracerProvider())
+
+	f := &fakeRecorder{
+		batchIDs: make(chan string, 1),
+		batches:  make(chan []openapi.Event, 1),
+	}
+
+	ctx, canc := context.WithCancel(context.Background())
+	defer canc()
+
+	pollCtx, pollSpan := provider.Tracer("test").Start(ctx, "poll")
+	q := New(ctx, f, &Options{name: "tracing-test"})
+	q.Enqueue(pollCtx, map[string]*openapi.Event{"ns/serv/endp": {Event: "create"}})
+	pollSpan.End()
+	batchID := <-f.batchIDs
+	<-f.batches
+
+	// Spans are ended after the handler returns
+	time.Sleep(10 * time.Millisecond)
+	spans := map[string]*sdktrace.SpanSnapshot{}
+	for _, span := range exporter.GetSpans() {
+		spans[span.Name] = span
+	}
+	if !a.Len(spans, 3) {
+		return
+	}
+
+	batch, send := spans["queue.batch"], spans["SendEvents"]
+	if a.Len(batch.Links, 1) {
+		a.Equal(pollSpan.SpanContext(), batch.Links[0].SpanContext)
+	}
+	a.Contains(batch.Attributes, attribute.String("cnwan.batch_id", batchID))
+	a.Contains(batch.Attributes, attribute.String("cnwan.adaptor", "tracing-test"))
+	a.Equal(batch.SpanContext.SpanID(), send.Parent.SpanID())
+	a.Equal(trace.SpanKindClient, send.SpanKind)
+}
+
+func TestQueueAudit(t *testing.T) {
+	a := assert.New(t)
+	f := &fakeFailing{
+		fakeRecorder: fakeRecorder{
+			batchIDs: make(chan string, 1),
+			batches:  make(chan []openapi.Event, 1),
+		},
+		failures: 1,
+	}
+
+	logPath := path.Join(t.TempDir(), "audit.log")
+	auditLog, err := audit.Open(&audit.Options{Path: logPath})
+	if !a.NoError(err) {
+		return
+	}
+	defer auditLog.Close()
+
+	ctx, canc := context.WithCancel(context.Background())
+	defer canc()
+
+	q := New(ctx, f, &Options{MinBackoff: 10 * time.Millisecond, name: "audit-test", audit: auditLog})
+	q.Enqueue(ctx, map[string]*openapi.Event{"ns/serv/endp": {Event: "create"}})
+
+	var batchID string
+	select {
+	case batchID = <-f.batchIDs:
+		<-f.batches
+	case <-time.After(time.Second):
+		a.FailNow("events should have been sent again")
+	}
+
+	// Batches are recorded after the handler returns
+	time.Sleep(10 * time.Millisecond)
+	records, err := audit.Read(logPath, nil)
+	if !a.NoError(err) || !a.Len(records, 2) {
+		return
+	}
+
+	a.Equal("audit-test", records[0].Adaptor)
+	a.Equal("adaptor unavailable", records[0].Error)
+	a.Empty(records[1].Error)
+	a.Equal(batchID, records[1].BatchID)
+	for _, rec := range records {
+		if a.Len(rec.Events, 1) {
+			a.Equal("create", rec.Events[0].Event)
+		}
+	}
+}
@@ -0,0 +1,42 @@
+// Copyright © 2021 Cisco
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// All rights reserved.
+
+// Package reader runs the pipeline of the CN-WAN Reader: it observes a
+// service registry, detects the changes to its services and sends them to
+// sinks, e.g. adaptors.
+//
+// It is meant to embed the reader in other programs, e.g. controllers, that
+// need to observe a service registry with the same semantics as the
+// commands of the CN-WAN Reader:
+//
+//	p := reader.New(source, &reader.Options{PollInterval: 5})
+//	if err := p.AddSink("my-adaptor", handler, nil); err != nil {
+//		// ...
+//	}
+//
+//	sub := p.Subscribe()
+//	go func() {
+//		for ev := range sub.Events {
+//			// ...
+//		}
+//	}()
+//
+//	if err := p.Run(ctx); err != nil {
+//		// ...
+//	}
+package reader
@@ -0,0 +1,95 @@
+// Copyright © 2021 Cisco
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// All rights reserved.
+
+package reader
+
+import (
+	"net"
+	"path"
+	"strconv"
+
+	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/openapi"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// ConflictPriority only keeps the endpoints of the source with the
+	// highest priority among the ones that have the same address and port.
+	ConflictPriority string = "priority"
+	// ConflictAll keeps the endpoints of all the sources, even if they
+	// have the same address and port.
+	ConflictAll string = "all"
+	// ConflictDrop drops the endpoints that have the same address and port
+	// in more than one source, until only one of them has it.
+	ConflictDrop string = "drop"
+)
+
+// merge returns the services of all the sources, which are in order of
+// priority, resolving the conflicts among them according to policy.
+//
+// When there is more than one source, the IDs of the services are prefixed
+// with the names of their sources, so that they don't clash. Services
+// without a source are tagged with the name of the one they come from.
+func merge(sources []*sourceState, policy string) map[string]*openapi.Service {
+	// owners contains the source with the highest priority for each
+	// address and port, and conflicts the ones found in more than one.
+	owners := map[string]int{}
+	conflicts := map[string]bool{}
+	if len(sources) > 1 && policy != ConflictAll {
+		for i, src := range sources {
+			for _, serv := range src.state {
+				addr := address(serv)
+				if owner, exists := owners[addr]; !exists {
+					owners[addr] = i
+				} else if owner != i {
+					conflicts[addr] = true
+				}
+			}
+		}
+	}
+
+	merged := map[string]*openapi.Service{}
+	for i, src := range sources {
+		name := src.source.Name()
+		for id, serv := range src.state {
+			if addr := address(serv); conflicts[addr] {
+				if policy == ConflictDrop || owners[addr] != i {
+					log.Debug().Str("source", name).Str("id", id).Str("address", addr).
+						Str("policy", policy).Msg("address is in more than one source: skipping...")
+					continue
+				}
+			}
+
+			merServ := *serv
+			if len(merServ.Source) == 0 {
+				merServ.Source = name
+			}
+			if len(sources) > 1 {
+				id = path.Join(name, id)
+				merServ.Id = id
+			}
+			merged[id] = &merServ
+		}
+	}
+
+	return merged
+}
+
+func address(serv *openapi.Service) string {
+	return net.JoinHostPort(serv.Address, strconv.Itoa(int(serv.Port)))
+}
@@ -0,0 +1,115 @@
+// Copyright © 2021 Cisco
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// All rights reserved.
+
+package reader
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/openapi"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMerge(t *testing.T) {
+	a := assert.New(t)
+	newSource := func(name string, servs ...openapi.Service) *sourceState {
+		src := &fakeSource{name: name}
+		src.set(servs...)
+		return &sourceState{source: src, state: src.state}
+	}
+	withSource := func(serv openapi.Service, id, source string) *openapi.Service {
+		serv.Id = id
+		serv.Source = source
+		return &serv
+	}
+	untagged := newService("one", "10.10.10.10")
+	untagged.Source = ""
+
+	cases := []struct {
+		sources []*sourceState
+		policy  string
+		expRes  map[string]*openapi.Service
+	}{
+		{
+			sources: []*sourceState{newSource("sd", untagged)},
+			policy:  ConflictPriority,
+			expRes: map[string]*openapi.Service{
+				"one": withSource(untagged, "one", "sd"),
+			},
+		},
+		{
+			sources: []*sourceState{
+				newSource("sd", newService("one", "10.10.10.10"), newService("two", "10.10.10.11")),
+				newSource("cloudmap", newService("one", "10.10.10.10"), newService("three", "10.10.10.12")),
+			},
+			policy: ConflictPriority,
+			expRes: map[string]*openapi.Service{
+				"sd/one":         withSource(newService("one", "10.10.10.10"), "sd/one", "fake"),
+				"sd/two":         withSource(newService("two", "10.10.10.11"), "sd/two", "fake"),
+				"cloudmap/three": withSource(newService("three", "10.10.10.12"), "cloudmap/three", "fake"),
+			},
+		},
+		{
+			sources: []*sourceState{
+				newSource("sd", newService("one", "10.10.10.10"), newService("two", "10.10.10.11")),
+				newSource("cloudmap", newService("one", "10.10.10.10"), newService("three", "10.10.10.12")),
+			},
+			policy: ConflictAll,
+			expRes: map[string]*openapi.Service{
+				"sd/one":         withSource(newService("one", "10.10.10.10"), "sd/one", "fake"),
+				"sd/two":         withSource(newService("two", "10.10.10.11"), "sd/two", "fake"),
+				"cloudmap/one":   withSource(newService("one", "10.10.10.10"), "cloudmap/one", "fake"),
+				"cloudmap/three": withSource(newService("three", "10.10.10.12"), "cloudmap/three", "fake"),
+			},
+		},
+		{
+			sources: []*sourceState{
+				newSource("sd", newService("one", "10.10.10.10"), newService("two", "10.10.10.11")),
+				newSource("cloudmap", newService("one", "10.10.10.10"), newService("three", "10.10.10.12")),
+			},
+			policy: ConflictDrop,
+			expRes: map[string]*openapi.Service{
+				"sd/two":         withSource(newService("two", "10.10.10.11"), "sd/two", "fake"),
+				"cloudmap/three": withSource(newService("three", "10.10.10.12"), "cloudmap/three", "fake"),
+			},
+		},
+		{
+			// Endpoints of the same source are not in conflict
+			sources: []*sourceState{
+				newSource("sd", newService("one", "10.10.10.10"), newService("two", "10.10.10.10")),
+				newSource("cloudmap"),
+			},
+			policy: ConflictDrop,
+			expRes: map[string]*openapi.Service{
+				"sd/one": withSource(newService("one", "10.10.10.10"), "sd/one", "fake"),
+				"sd/two": withSource(newService("two", "10.10.10.10"), "sd/two", "fake"),
+			},
+		},
+	}
+
+	failed := func(i int) {
+		a.FailNow("case failed", fmt.Sprintf("case %d", i))
+	}
+	for i, currCase := range cases {
+		res := merge(currCase.sources, currCase.policy)
+		if !a.Equal(currCase.expRes, res) {
+			failed(i)
+		}
+	}
+}
@@ -0,0 +1,522 @@
+// Copyright © 2021 Cisco
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// All rights reserved.
+
+package reader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/audit"
+	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/election"
+	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/health"
+	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/metrics"
+	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/openapi"
+	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/poller"
+	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/queue"
+	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/services"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// DefaultPollInterval is the number of seconds between two
+	// consecutive polls, unless another one is specified.
+	DefaultPollInterval int = 5
+
+	// subscriptionBuffer is the number of events that a subscriber can
+	// fall behind before being dropped.
+	subscriptionBuffer int = 256
+)
+
+var (
+	// ErrAlreadyRunning is returned when the pipeline is modified or run
+	// after Run has been called.
+	ErrAlreadyRunning = errors.New("the pipeline is already running")
+)
+
+// Options contains settings about the pipeline.
+type Options struct {
+	// PollInterval is the number of seconds between two consecutive
+	// polls of the sources that don't have their own. It is ignored for
+	// Watchers. If 0, DefaultPollInterval is used.
+	PollInterval int
+	// ResyncInterval is the number of seconds between two consecutive
+	// deliveries of the full current state to the sinks. If 0, the state
+	// is not sent periodically.
+	ResyncInterval int
+	// Conflict is the policy used when endpoints with the same address and
+	// port are found in more than one source. If empty, ConflictPriority
+	// is used.
+	Conflict string
+	// Checker records the health of the pipeline, if not nil.
+	Checker *health.Checker
+	// Elector elects the instance that sends events to the sinks, if not
+	// nil. The others keep observing the sources, so that they are ready
+	// to take over.
+	Elector election.Elector
+}
+
+// SinkOptions contains settings about how events are sent to a sink.
+type SinkOptions struct {
+	// Selector contains the metadata that an endpoint must have in order
+	// to be sent to the sink. A key with an empty value only requires the
+	// key to be there. If empty, all endpoints are sent.
+	Selector map[string]string
+	// Retry contains options about how to retry sending events.
+	Retry *queue.Options
+	// Audit is where to record the batches of events sent to the sink.
+	// If nil, they are not recorded.
+	Audit *audit.Log
+	// Local is true if the sink only serves this instance, e.g. the server
+	// that adaptors query. Local sinks receive events even when this
+	// instance is not the leader, so that standbys serve a warm state.
+	Local bool
+}
+
+// Pipeline observes one or more sources and sends the changes to their
+// services to the sinks. Each sink has its own queue, so a slow or failing
+// one does not hold up the others.
+type Pipeline struct {
+	opts      Options
+	datastore services.Datastore
+
+	lock         sync.Mutex
+	running      bool
+	sources      []*sourceState
+	targets      []*queue.Target
+	localTargets []*queue.Target
+	subscribers  map[*Subscription]bool
+
+	// stateLock protects the states of the sources and makes sure that
+	// changes are applied to the datastore and enqueued in the same order.
+	stateLock sync.Mutex
+}
+
+// sourceState contains the services currently registered in a source.
+type sourceState struct {
+	source   Source
+	interval int
+	state    map[string]*openapi.Service
+}
+
+// Subscription receives the events detected by the pipeline.
+type Subscription struct {
+	// Events receives the events as soon as they are detected, even if
+	// this instance is not the leader. It is closed when the subscription
+	// is canceled or when the subscriber falls too far behind.
+	Events <-chan openapi.Event
+
+	events chan openapi.Event
+}
+
+// New returns a pipeline that observes source, polled every
+// opts.PollInterval seconds unless it is a Watcher. More sources can be
+// added with AddSource.
+func New(source Source, opts *Options) *Pipeline {
+	p := &Pipeline{
+		datastore:   services.NewDatastore(),
+		subscribers: map[*Subscription]bool{},
+	}
+	if opts != nil {
+		p.opts = *opts
+	}
+	if p.opts.PollInterval <= 0 {
+		p.opts.PollInterval = DefaultPollInterval
+	}
+	if len(p.opts.Conflict) == 0 {
+		p.opts.Conflict = ConflictPriority
+	}
+	if p.opts.Checker == nil {
+		p.opts.Checker = health.New()
+	}
+	p.sources = []*sourceState{{source: source, interval: p.opts.PollInterval}}
+
+	return p
+}
+
+// AddSource adds another source, polled every interval seconds unless it is
+// a Watcher. If interval is 0, the PollInterval of the options is used.
+//
+// Sources are in order of priority, starting from the one passed to New,
+// and the IDs of the services are prefixed with the names of their sources
+// so that they don't clash, e.g. cloudmap/ns/serv/endp.
+// It returns ErrAlreadyRunning if Run has already been called.
+func (p *Pipeline) AddSource(source Source, interval int) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.running {
+		return ErrAlreadyRunning
+	}
+
+	if interval <= 0 {
+		interval = p.opts.PollInterval
+	}
+	p.sources = append(p.sources, &sourceState{source: source, interval: interval})
+
+	return nil
+}
+
+// AddSink adds a sink identified by name, which is used in logs and
+// metrics. It returns ErrAlreadyRunning if Run has already been called.
+func (p *Pipeline) AddSink(name string, sink Sink, opts *SinkOptions) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.running {
+		return ErrAlreadyRunning
+	}
+
+	if opts == nil {
+		opts = &SinkOptions{}
+	}
+	target := &queue.Target{
+		Name:     name,
+		Handler:  sink,
+		Selector: opts.Selector,
+		Options:  opts.Retry,
+		Audit:    opts.Audit,
+	}
+	if opts.Local {
+		p.localTargets = append(p.localTargets, target)
+	} else {
+		p.targets = append(p.targets, target)
+	}
+
+	return nil
+}
+
+// Run gets the current state of the sources and then observes them, until
+// ctx is canceled. It returns an error if the initial state cannot be
+// loaded or if a source stops being watched while ctx is still valid.
+func (p *Pipeline) Run(ctx context.Context) error {
+	p.lock.Lock()
+	if p.running {
+		p.lock.Unlock()
+		return ErrAlreadyRunning
+	}
+	p.running = true
+	targets, localTargets := p.targets, p.localTargets
+	p.lock.Unlock()
+
+	switch p.opts.Conflict {
+	case ConflictPriority, ConflictAll, ConflictDrop:
+	default:
+		return fmt.Errorf("unsupported conflict policy: %s", p.opts.Conflict)
+	}
+
+	// Everything stops when a watcher does
+	runCtx, runCanc := context.WithCancel(ctx)
+	defer runCanc()
+
+	for _, src := range p.sources {
+		l := log.With().Str("source", src.source.Name()).Logger()
+		l.Info().Msg("getting initial state...")
+		state, err := src.source.State(runCtx)
+		if err != nil {
+			return fmt.Errorf("could not get initial state of %s: %w", src.source.Name(), err)
+		}
+		if state == nil {
+			state = map[string]*openapi.Service{}
+		}
+		src.state = state
+		l.Info().Msg("done")
+	}
+	p.opts.Checker.SetReady()
+
+	var (
+		sendQueue   queue.Queue
+		leaderQueue *election.LeaderQueue
+	)
+	if p.opts.Elector != nil {
+		// Each term has its own queues, so that nothing is sent anymore
+		// as soon as this is not the leader
+		leaderQueue = election.NewLeaderQueue(func(leadCtx context.Context) queue.Queue {
+			return queue.NewFanOut(leadCtx, targets)
+		})
+		sendQueue = queues{leaderQueue, queue.NewFanOut(runCtx, localTargets)}
+	} else {
+		allTargets := append(append([]*queue.Target{}, targets...), localTargets...)
+		sendQueue = queue.NewFanOut(runCtx, allTargets)
+	}
+
+	p.apply(runCtx, sendQueue, nil, nil)
+	if leaderQueue != nil {
+		// Only now the datastore has the current state to send when this
+		// becomes the leader
+		log.Info().Msg("campaigning to become the leader...")
+		go leaderQueue.Campaign(runCtx, p.opts.Elector, func(leadCtx context.Context) {
+			// Local sinks are already up to date
+			p.resync(leadCtx, leaderQueue, false)
+		})
+	}
+
+	if p.opts.ResyncInterval > 0 {
+		resync := poller.New(runCtx, p.opts.ResyncInterval)
+		resync.SetPollFunction(func(resyncCtx context.Context) {
+			p.resync(resyncCtx, sendQueue, true)
+		})
+		resync.Start()
+	}
+
+	var wg sync.WaitGroup
+	stopped := make(chan error, len(p.sources))
+	for _, src := range p.sources {
+		if watcher, isWatcher := src.source.(Watcher); isWatcher {
+			wg.Add(1)
+			go func(src *sourceState, watcher Watcher) {
+				defer wg.Done()
+				stopped <- p.watch(runCtx, sendQueue, src, watcher)
+			}(src, watcher)
+			continue
+		}
+
+		p.poll(runCtx, sendQueue, src)
+	}
+
+	var err error
+	select {
+	case <-ctx.Done():
+	case err = <-stopped:
+	}
+	runCanc()
+	wg.Wait()
+
+	if ctx.Err() != nil {
+		return nil
+	}
+
+	log.Err(err).Msg("stopped watching for changes")
+	p.opts.Checker.Stopped(err)
+	return err
+}
+
+// watch applies the changes reported by the watcher until ctx is canceled,
+// and then returns nil, or until it stops watching.
+func (p *Pipeline) watch(ctx context.Context, sendQueue queue.Queue, src *sourceState, watcher Watcher) error {
+	log.Info().Str("source", src.source.Name()).Msg("watching for changes...")
+	err := watcher.Watch(ctx, func(evCtx context.Context, events map[string]*openapi.Event) {
+		p.applyEvents(evCtx, sendQueue, src, events)
+	})
+	if ctx.Err() != nil {
+		return nil
+	}
+
+	if err == nil {
+		err = errors.New("watch has been closed")
+	}
+	return fmt.Errorf("stopped watching %s: %w", src.source.Name(), err)
+}
+
+// poll starts polling the source in background, until ctx is canceled.
+func (p *Pipeline) poll(ctx context.Context, sendQueue queue.Queue, src *sourceState) {
+	l := log.With().Str("source", src.source.Name()).Logger()
+	p.opts.Checker.PollSucceeded(src.source.Name())
+
+	l.Info().Msg("observing changes...")
+	poll := poller.New(ctx, src.interval)
+	poll.SetSource(src.source.Name())
+	poll.SetPollFunction(func(pollCtx context.Context) {
+		state, err := src.source.State(pollCtx)
+		if err != nil {
+			p.opts.Checker.PollFailed(src.source.Name(), err)
+			l.Err(err).Msg("error while polling, skipping...")
+			return
+		}
+		p.opts.Checker.PollSucceeded(src.source.Name())
+
+		if events := p.apply(pollCtx, sendQueue, src, state); len(events) > 0 {
+			l.Info().Int("events", len(events)).Msg("changes detected")
+		}
+	})
+	poll.Start()
+}
+
+// Snapshot returns the services that currently exist, sorted by their IDs.
+func (p *Pipeline) Snapshot() []openapi.Service {
+	return p.datastore.Snapshot()
+}
+
+// Subscribe returns a subscription that receives the events detected from
+// now on.
+func (p *Pipeline) Subscribe() *Subscription {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	events := make(chan openapi.Event, subscriptionBuffer)
+	sub := &Subscription{Events: events, events: events}
+	p.subscribers[sub] = true
+	return sub
+}
+
+// Unsubscribe cancels the subscription and closes its channel.
+func (p *Pipeline) Unsubscribe(sub *Subscription) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.unsubscribe(sub)
+}
+
+// unsubscribe must be called with the lock held.
+func (p *Pipeline) unsubscribe(sub *Subscription) {
+	if !p.subscribers[sub] {
+		return
+	}
+
+	delete(p.subscribers, sub)
+	close(sub.events)
+}
+
+// apply replaces the state of src, if not nil, and enqueues the
+// differences with the previous state of all the sources.
+func (p *Pipeline) apply(ctx context.Context, sendQueue queue.Queue, src *sourceState, state map[string]*openapi.Service) map[string]*openapi.Event {
+	p.stateLock.Lock()
+	defer p.stateLock.Unlock()
+
+	if src != nil {
+		src.state = state
+	}
+
+	events := p.update(ctx)
+	if len(events) > 0 {
+		sendQueue.Enqueue(ctx, events)
+	}
+
+	return events
+}
+
+// applyEvents applies the events to the state of src and enqueues the ones
+// that actually change the state of all the sources.
+func (p *Pipeline) applyEvents(ctx context.Context, sendQueue queue.Queue, src *sourceState, events map[string]*openapi.Event) {
+	p.stateLock.Lock()
+	defer p.stateLock.Unlock()
+
+	for _, ev := range events {
+		if ev.Event == "delete" {
+			delete(src.state, ev.Service.Id)
+		} else {
+			serv := ev.Service
+			src.state[serv.Id] = &serv
+		}
+	}
+
+	if changes := p.update(ctx); len(changes) > 0 {
+		sendQueue.Enqueue(ctx, changes)
+	}
+}
+
+// resync sends the current state to the queue. The states of watchers are
+// loaded again first, since changes may have been missed while watching.
+func (p *Pipeline) resync(ctx context.Context, sendQueue queue.Queue, reload bool) {
+	p.stateLock.Lock()
+	defer p.stateLock.Unlock()
+
+	if reload {
+		states := map[*sourceState]map[string]*openapi.Service{}
+		for _, src := range p.sources {
+			if _, isWatcher := src.source.(Watcher); !isWatcher {
+				continue
+			}
+
+			state, err := src.source.State(ctx)
+			if err != nil {
+				log.Err(err).Str("source", src.source.Name()).Msg("error while retrieving current state, skipping resync...")
+				return
+			}
+			states[src] = state
+		}
+
+		for src, state := range states {
+			src.state = state
+		}
+
+		// The changes are part of the state that is about to be sent, but
+		// they are enqueued as well, as not all the sinks can receive it.
+		// Syncers discard them, since the state already includes them.
+		if events := p.update(ctx); len(events) > 0 {
+			sendQueue.Enqueue(ctx, events)
+		}
+	}
+
+	sendQueue.Sync(p.datastore.Snapshot())
+}
+
+// update replaces the state in the datastore with the one of all the
+// sources and notifies the subscribers of the differences with the
+// previous one, which are returned.
+// It must be called with stateLock held.
+func (p *Pipeline) update(ctx context.Context) map[string]*openapi.Event {
+	events := p.datastore.GetEvents(ctx, merge(p.sources, p.opts.Conflict))
+	if len(events) == 0 {
+		return events
+	}
+
+	ids := make([]string, 0, len(events))
+	for id, event := range events {
+		ids = append(ids, id)
+		metrics.Events.WithLabelValues(event.Event).Inc()
+	}
+	sort.Strings(ids)
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	for sub := range p.subscribers {
+		if !sub.send(ids, events) {
+			// The subscriber is too slow: rather than blocking everyone
+			// else, it is dropped.
+			p.unsubscribe(sub)
+		}
+	}
+
+	return events
+}
+
+// send sends the events with the given IDs to the subscriber, in order, and
+// returns false if its buffer is full.
+func (s *Subscription) send(ids []string, events map[string]*openapi.Event) bool {
+	for _, id := range ids {
+		select {
+		case s.events <- *events[id]:
+		default:
+			return false
+		}
+	}
+
+	return true
+}
+
+// queues sends data to all of its queues.
+type queues []queue.Queue
+
+// Enqueue sends the events to all the queues.
+func (q queues) Enqueue(ctx context.Context, events map[string]*openapi.Event) {
+	for _, sendQueue := range q {
+		sendQueue.Enqueue(ctx, events)
+	}
+}
+
+// Sync sends the current state to all the queues.
+func (q queues) Sync(servs []openapi.Service) {
+	for _, sendQueue := range q {
+		sendQueue.Sync(servs)
+	}
+}
@@ -0,0 +1,380 @@
+// Copyright © 2021 Cisco
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// All rights reserved.
+
+package reader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/health"
+	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/openapi"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeSource struct {
+	name  string
+	lock  sync.Mutex
+	state map[string]*openapi.Service
+	err   error
+}
+
+func (f *fakeSource) Name() string {
+	if len(f.name) == 0 {
+		return "fake"
+	}
+	return f.name
+}
+
+func (f *fakeSource) State(ctx context.Context) (map[string]*openapi.Service, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if f.err != nil {
+		return nil, f.err
+	}
+
+	state := map[string]*openapi.Service{}
+	for id, serv := range f.state {
+		serv := *serv
+		state[id] = &serv
+	}
+	return state, nil
+}
+
+func (f *fakeSource) set(servs ...openapi.Service) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	f.state = map[string]*openapi.Service{}
+	for _, serv := range servs {
+		serv := serv
+		f.state[serv.Id] = &serv
+	}
+}
+
+type fakeWatcher struct {
+	fakeSource
+	changes chan map[string]*openapi.Event
+}
+
+func (f *fakeWatcher) Watch(ctx context.Context, notify func(context.Context, map[string]*openapi.Event)) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case events, ok := <-f.changes:
+			if !ok {
+				return errors.New("closed")
+			}
+			notify(ctx, events)
+		}
+	}
+}
+
+type fakeSink struct {
+	events chan openapi.Event
+}
+
+func (f *fakeSink) Send(ctx context.Context, events []openapi.Event) error {
+	for _, ev := range events {
+		f.events <- ev
+	}
+	return nil
+}
+
+type fakeSyncSink struct {
+	fakeSink
+	syncs chan []openapi.Service
+}
+
+func (f *fakeSyncSink) Sync(ctx context.Context, servs []openapi.Service) error {
+	f.syncs <- servs
+	return nil
+}
+
+type fakeElector struct {
+	leading chan bool
+}
+
+func (f *fakeElector) Run(ctx context.Context, lead func(context.Context)) {
+	select {
+	case <-ctx.Done():
+	case <-f.leading:
+		lead(ctx)
+	}
+}
+
+func newService(id, address string) openapi.Service {
+	return openapi.Service{Id: id, Name: id, Address: address, Port: 80, Source: "fake"}
+}
+
+func receive(t *testing.T, events <-chan openapi.Event, n int) map[string]string {
+	received := map[string]string{}
+	for i := 0; i < n; i++ {
+		select {
+		case ev := <-events:
+			received[ev.Service.Id] = ev.Event
+		case <-time.After(5 * time.Second):
+			assert.FailNow(t, "timeout while waiting for events")
+		}
+	}
+
+	return received
+}
+
+func TestAddSink(t *testing.T) {
+	a := assert.New(t)
+	p := New(&fakeSource{err: errors.New("unreachable")}, nil)
+
+	a.NoError(p.AddSink("first", &fakeSink{}, nil))
+	a.Equal(fmt.Errorf("could not get initial state of fake: %w", errors.New("unreachable")), p.Run(context.Background()))
+	a.Equal(ErrAlreadyRunning, p.AddSink("second", &fakeSink{}, nil))
+	a.Equal(ErrAlreadyRunning, p.Run(context.Background()))
+
+	p = New(&fakeSource{}, &Options{Conflict: "newest"})
+	a.Equal(fmt.Errorf("unsupported conflict policy: newest"), p.Run(context.Background()))
+}
+
+func TestRunPolled(t *testing.T) {
+	a := assert.New(t)
+	source := &fakeSource{}
+	source.set(newService("one", "10.10.10.10"))
+	sink := &fakeSink{events: make(chan openapi.Event, 10)}
+	checker := health.New()
+
+	p := New(source, &Options{PollInterval: 1, Checker: checker})
+	a.NoError(p.AddSink("sink", sink, nil))
+	a.NoError(p.AddSink("selected", &fakeSink{}, &SinkOptions{Selector: map[string]string{"key": "value"}}))
+	sub := p.Subscribe()
+
+	ctx, canc := context.WithCancel(context.Background())
+	exited := make(chan error)
+	go func() {
+		exited <- p.Run(ctx)
+	}()
+
+	a.Equal(map[string]string{"one": "create"}, receive(t, sink.events, 1))
+	a.Equal(map[string]string{"one": "create"}, receive(t, sub.Events, 1))
+	a.NoError(checker.Ready())
+
+	source.set(newService("one", "10.10.10.11"), newService("two", "10.10.10.12"))
+	a.Equal(map[string]string{"one": "update", "two": "create"}, receive(t, sink.events, 2))
+	a.Equal(map[string]string{"one": "update", "two": "create"}, receive(t, sub.Events, 2))
+	a.Equal([]openapi.Service{newService("one", "10.10.10.11"), newService("two", "10.10.10.12")}, p.Snapshot())
+
+	p.Unsubscribe(sub)
+	_, open := <-sub.Events
+	a.False(open)
+
+	canc()
+	a.NoError(<-exited)
+}
+
+func TestRunWatcher(t *testing.T) {
+	a := assert.New(t)
+	source := &fakeWatcher{changes: make(chan map[string]*openapi.Event)}
+	source.set(newService("one", "10.10.10.10"))
+	sink := &fakeSink{events: make(chan openapi.Event, 10)}
+	checker := health.New()
+
+	p := New(source, &Options{Checker: checker})
+	a.NoError(p.AddSink("sink", sink, nil))
+
+	exited := make(chan error)
+	go func() {
+		exited <- p.Run(context.Background())
+	}()
+	a.Equal(map[string]string{"one": "create"}, receive(t, sink.events, 1))
+
+	// Events that don't change the state are not sent
+	one, two := newService("one", "10.10.10.10"), newService("two", "10.10.10.11")
+	source.changes <- map[string]*openapi.Event{
+		"one": {Event: "update", Service: one},
+		"two": {Event: "create", Service: two},
+	}
+	a.Equal(map[string]string{"two": "create"}, receive(t, sink.events, 1))
+
+	source.changes <- map[string]*openapi.Event{"one": {Event: "delete", Service: one}}
+	a.Equal(map[string]string{"one": "delete"}, receive(t, sink.events, 1))
+	a.Equal([]openapi.Service{two}, p.Snapshot())
+
+	close(source.changes)
+	a.Equal(fmt.Errorf("stopped watching fake: %w", errors.New("closed")), <-exited)
+	a.Error(checker.Live(0))
+}
+
+func TestRunElector(t *testing.T) {
+	a := assert.New(t)
+	source := &fakeSource{}
+	source.set(newService("one", "10.10.10.10"))
+	sink := &fakeSyncSink{
+		fakeSink: fakeSink{events: make(chan openapi.Event, 10)},
+		syncs:    make(chan []openapi.Service, 1),
+	}
+	plain := &fakeSink{events: make(chan openapi.Event, 10)}
+	local := &fakeSink{events: make(chan openapi.Event, 10)}
+	elector := &fakeElector{leading: make(chan bool)}
+
+	p := New(source, &Options{PollInterval: 1, Elector: elector})
+	a.NoError(p.AddSink("sink", sink, nil))
+	a.NoError(p.AddSink("plain", plain, nil))
+	a.NoError(p.AddSink("local", local, &SinkOptions{Local: true}))
+	sub := p.Subscribe()
+
+	ctx, canc := context.WithCancel(context.Background())
+	defer canc()
+	go p.Run(ctx)
+
+	// Standbys keep observing the source, but only send to local sinks
+	a.Equal(map[string]string{"one": "create"}, receive(t, sub.Events, 1))
+	a.Equal(map[string]string{"one": "create"}, receive(t, local.events, 1))
+	source.set(newService("one", "10.10.10.10"), newService("two", "10.10.10.11"))
+	a.Equal(map[string]string{"two": "create"}, receive(t, sub.Events, 1))
+	a.Equal(map[string]string{"two": "create"}, receive(t, local.events, 1))
+	a.Empty(sink.events)
+	a.Empty(plain.events)
+
+	elector.leading <- true
+	select {
+	case servs := <-sink.syncs:
+		a.Equal([]openapi.Service{newService("one", "10.10.10.10"), newService("two", "10.10.10.11")}, servs)
+	case <-time.After(5 * time.Second):
+		a.FailNow("timeout while waiting for the current state")
+	}
+
+	// Sinks that can't sync get the current state as events
+	a.Equal(map[string]string{"one": "create", "two": "create"}, receive(t, plain.events, 2))
+
+	source.set(newService("two", "10.10.10.11"))
+	a.Equal(map[string]string{"one": "delete"}, receive(t, sink.events, 1))
+	a.Equal(map[string]string{"one": "delete"}, receive(t, plain.events, 1))
+	a.Equal(map[string]string{"one": "delete"}, receive(t, local.events, 1))
+	a.Empty(local.events)
+}
+
+func TestRunResync(t *testing.T) {
+	a := assert.New(t)
+	source := &fakeWatcher{changes: make(chan map[string]*openapi.Event)}
+	source.set(newService("one", "10.10.10.10"))
+	sink := &fakeSink{events: make(chan openapi.Event, 10)}
+
+	p := New(source, &Options{ResyncInterval: 1})
+	a.NoError(p.AddSink("sink", sink, nil))
+	sub := p.Subscribe()
+
+	ctx, canc := context.WithCancel(context.Background())
+	defer canc()
+	go p.Run(ctx)
+	a.Equal(map[string]string{"one": "create"}, receive(t, sink.events, 1))
+	a.Equal(map[string]string{"one": "create"}, receive(t, sub.Events, 1))
+
+	// Changes missed by the watcher are found on resync, and sent to sinks
+	// that can't sync as well
+	source.set(newService("two", "10.10.10.11"))
+	a.Equal(map[string]string{"one": "delete", "two": "create"}, receive(t, sink.events, 2))
+	a.Equal(map[string]string{"one": "delete", "two": "create"}, receive(t, sub.Events, 2))
+	a.Equal([]openapi.Service{newService("two", "10.10.10.11")}, p.Snapshot())
+}
+
+func TestRunMultipleSources(t *testing.T) {
+	a := assert.New(t)
+	first := &fakeSource{name: "first"}
+	first.set(newService("one", "10.10.10.10"))
+	second := &fakeWatcher{fakeSource: fakeSource{name: "second"}, changes: make(chan map[string]*openapi.Event)}
+	second.set(newService("one", "10.10.10.11"), newService("two", "10.10.10.10"))
+	sink := &fakeSink{events: make(chan openapi.Event, 10)}
+
+	p := New(first, &Options{PollInterval: 1})
+	a.NoError(p.AddSource(second, 0))
+	a.NoError(p.AddSink("sink", sink, nil))
+
+	ctx, canc := context.WithCancel(context.Background())
+	exited := make(chan error)
+	go func() {
+		exited <- p.Run(ctx)
+	}()
+
+	// The same address is only taken from the first source
+	a.Equal(map[string]string{"first/one": "create", "second/one": "create"}, receive(t, sink.events, 2))
+
+	second.changes <- map[string]*openapi.Event{"two": {Event: "update", Service: newService("two", "10.10.10.12")}}
+	a.Equal(map[string]string{"second/two": "create"}, receive(t, sink.events, 1))
+
+	first.set()
+	a.Equal(map[string]string{"first/one": "delete"}, receive(t, sink.events, 1))
+
+	canc()
+	a.NoError(<-exited)
+}
+
+func TestRunPollHealth(t *testing.T) {
+	a := assert.New(t)
+	first, second := &fakeSource{name: "first"}, &fakeSource{name: "second"}
+	checker := health.New()
+
+	p := New(first, &Options{PollInterval: 1, Checker: checker})
+	a.NoError(p.AddSource(second, 0))
+	a.NoError(p.AddSink("sink", &fakeSink{events: make(chan openapi.Event, 10)}, nil))
+
+	ctx, canc := context.WithCancel(context.Background())
+	exited := make(chan error)
+	go func() {
+		exited <- p.Run(ctx)
+	}()
+
+	a.Eventually(func() bool {
+		return checker.Ready() == nil
+	}, time.Second, 10*time.Millisecond)
+
+	// A source that can't be polled is not hidden by the others
+	second.lock.Lock()
+	second.err = errors.New("unreachable")
+	second.lock.Unlock()
+	a.Eventually(func() bool {
+		return checker.Ready() != nil
+	}, 3*time.Second, 50*time.Millisecond)
+	a.Equal(fmt.Errorf("service registry second is not reachable: %w", errors.New("unreachable")), checker.Ready())
+
+	canc()
+	a.NoError(<-exited)
+}
+
+func TestSlowSubscriber(t *testing.T) {
+	a := assert.New(t)
+	p := New(&fakeSource{}, nil)
+	sub := p.Subscribe()
+
+	state := map[string]*openapi.Service{}
+	for i := 0; i <= subscriptionBuffer; i++ {
+		serv := newService(fmt.Sprintf("serv-%03d", i), "10.10.10.10")
+		state[serv.Id] = &serv
+	}
+	p.sources[0].state = state
+	p.update(context.Background())
+
+	received := 0
+	for range sub.Events {
+		received++
+	}
+	a.Equal(subscriptionBuffer, received)
+}
@@ -0,0 +1,53 @@
+// Copyright © 2021 Cisco
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// All rights reserved.
+
+package reader
+
+import (
+	"context"
+
+	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/openapi"
+)
+
+// Source is a service registry observed by the pipeline.
+type Source interface {
+	// Name of the service registry, e.g. cloudmap, used in logs, metrics
+	// and traces.
+	Name() string
+	// State returns the services that are currently registered, keyed by
+	// their IDs.
+	State(ctx context.Context) (map[string]*openapi.Service, error)
+}
+
+// Watcher is a Source that reports changes as soon as they happen, rather
+// than being polled.
+type Watcher interface {
+	Source
+	// Watch calls notify with the events of each change, keyed by the IDs
+	// of their services, until ctx is canceled. It returns an error if it
+	// stops watching for any other reason.
+	Watch(ctx context.Context, notify func(ctx context.Context, events map[string]*openapi.Event)) error
+}
+
+// Sink is where events are sent to, e.g. an adaptor.
+// Sinks that also implement services.Syncer receive the full current state
+// on resync, while the others skip it.
+type Sink interface {
+	// Send sends the events to the sink.
+	Send(ctx context.Context, events []openapi.Event) error
+}
@@ -18,10 +18,20 @@
 
 package sdhandler
 
-import "github.com/CloudNativeSDWAN/cnwan-reader/pkg/openapi"
+import (
+	"context"
 
-// Handler is in charge of getting data from service directory
+	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/openapi"
+)
+
+// Handler is in charge of getting data from service directory.
+// It can be polled by a reader.Pipeline.
 type Handler interface {
-	// GetServices loads services from service directory
-	GetServices() map[string]*openapi.Service
+	// GetServices loads services from service directory. An error is
+	// returned if service directory could not be reached at all
+	GetServices() (map[string]*openapi.Service, error)
+	// Name returns the name of the service registry
+	Name() string
+	// State loads services from service directory, like GetServices
+	State(ctx context.Context) (map[string]*openapi.Service, error)
 }
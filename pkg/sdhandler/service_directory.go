@@ -20,11 +20,12 @@ package sdhandler
 
 import (
 	"context"
-	"fmt"
 	"io/ioutil"
 	"path"
 
 	sd "cloud.google.com/go/servicedirectory/apiv1beta1"
+	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/internal/utils"
+	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/metrics"
 	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/openapi"
 	"github.com/rs/zerolog/log"
 	"google.golang.org/api/iterator"
@@ -32,6 +33,10 @@ import (
 	sdpb "google.golang.org/genproto/googleapis/cloud/servicedirectory/v1beta1"
 )
 
+const (
+	sourceName string = "servicedirectory"
+)
+
 type gcloudServDir struct {
 	metadataKey string
 	region      string
@@ -64,13 +69,15 @@ func New(ctx context.Context, region, metadataKey, project, credsPath string) (H
 }
 
 // GetServices loads data from the service
-func (g *gcloudServDir) GetServices() map[string]*openapi.Service {
+func (g *gcloudServDir) GetServices() (map[string]*openapi.Service, error) {
 	l := log.With().Str("func", "Handler.GetServices").Logger()
 	maps := map[string]*openapi.Service{}
 
 	nsList, err := g.getNamespacesList()
 	if err != nil {
+		metrics.RegistryErrors.WithLabelValues(sourceName).Inc()
 		l.Error().Err(err).Msg("error while getting namespaces list")
+		return nil, err
 	}
 
 	for _, ns := range nsList {
@@ -78,6 +85,7 @@ func (g *gcloudServDir) GetServices() map[string]*openapi.Service {
 
 		servList, err := g.getServicesList(ns.Name)
 		if err != nil {
+			metrics.RegistryErrors.WithLabelValues(sourceName).Inc()
 			l.Warn().Err(err).Msg("error while getting services")
 			continue
 		}
@@ -87,6 +95,7 @@ func (g *gcloudServDir) GetServices() map[string]*openapi.Service {
 
 			epList, err := g.getEndpointsList(serv.Name)
 			if err != nil {
+				metrics.RegistryErrors.WithLabelValues(sourceName).Inc()
 				l.Warn().Err(err).Msg("error while getting endpoints")
 				continue
 			}
@@ -99,14 +108,23 @@ func (g *gcloudServDir) GetServices() map[string]*openapi.Service {
 
 				if data != nil {
 					l.Debug().Msg("endpoint has the required metadata key")
-					mapKey := fmt.Sprintf("%s_%d", data.Address, data.Port)
-					maps[mapKey] = data
+					maps[data.Id] = data
 				}
 			}
 		}
 	}
 
-	return maps
+	return maps, nil
+}
+
+// Name returns the name of the service registry
+func (g *gcloudServDir) Name() string {
+	return sourceName
+}
+
+// State loads data from the service, like GetServices
+func (g *gcloudServDir) State(ctx context.Context) (map[string]*openapi.Service, error) {
+	return g.GetServices()
 }
 
 func (g *gcloudServDir) getNamespacesList() ([]*sdpb.Namespace, error) {
@@ -196,10 +214,19 @@ func (g *gcloudServDir) formatData(endpoint *sdpb.Endpoint, serviceMetadata map[
 		return nil
 	}
 
+	// The endpoint name is in the form of
+	// projects/<project>/locations/<region>/namespaces/<ns>/services/<serv>/endpoints/<endp>
+	servName := path.Dir(path.Dir(endpoint.Name))
+	nsName := path.Dir(path.Dir(servName))
+
 	return &openapi.Service{
-		Address:  endpoint.Address,
-		Name:     endpoint.Name,
-		Metadata: []openapi.Metadata{{Key: g.metadataKey, Value: metadataValue}},
-		Port:     endpoint.Port,
+		Id:        utils.EndpointID(path.Base(nsName), path.Base(servName), path.Base(endpoint.Name)),
+		Address:   endpoint.Address,
+		Name:      endpoint.Name,
+		Metadata:  []openapi.Metadata{{Key: g.metadataKey, Value: metadataValue}},
+		Port:      endpoint.Port,
+		Namespace: path.Base(nsName),
+		Service:   path.Base(servName),
+		Source:    sourceName,
 	}
 }
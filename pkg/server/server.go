@@ -0,0 +1,208 @@
+// Copyright © 2021 Cisco
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// All rights reserved.
+
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/metrics"
+	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/openapi"
+	"github.com/rs/zerolog/log"
+)
+
+// Server serves the current state and the history of events over HTTP, as
+// defined by the endpoints with the pull tag in api/openapi.yaml, and the
+// metrics of the CN-WAN Reader on /metrics.
+type Server struct {
+	store *Store
+	mux   *http.ServeMux
+	// closing is closed when the server is shutting down, so that streams
+	// are terminated.
+	closing chan struct{}
+}
+
+// New returns a server that serves the data in store.
+func New(store *Store) *Server {
+	s := &Server{store: store, mux: http.NewServeMux(), closing: make(chan struct{})}
+	s.mux.HandleFunc("/v1/services", s.listServices)
+	s.mux.HandleFunc("/v1/services/", s.getService)
+	s.mux.HandleFunc("/v1/events", s.listEvents)
+	s.mux.HandleFunc("/v1/events/stream", s.streamEvents)
+	s.mux.Handle("/metrics", metrics.Handler())
+
+	return s
+}
+
+// Handle registers handler for pattern, so that it is served along with
+// the other endpoints.
+func (s *Server) Handle(pattern string, handler http.Handler) {
+	s.mux.Handle(pattern, handler)
+}
+
+// ServeHTTP implements http.Handler.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// Serve serves requests on lis until ctx is canceled.
+func (s *Server) Serve(ctx context.Context, lis net.Listener) error {
+	l := log.With().Str("func", "server.Server.Serve").Str("address", lis.Addr().String()).Logger()
+	srv := &http.Server{Handler: s}
+
+	go func() {
+		<-ctx.Done()
+		close(s.closing)
+		shutdownCtx, canc := context.WithTimeout(context.Background(), 5*time.Second)
+		defer canc()
+
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			l.Err(err).Msg("error while shutting down server")
+		}
+	}()
+
+	l.Info().Msg("serving requests...")
+	if err := srv.Serve(lis); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	return nil
+}
+
+func (s *Server) listServices(w http.ResponseWriter, r *http.Request) {
+	if !allowGet(w, r) {
+		return
+	}
+
+	filter, err := parseFilter(r.URL.Query())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, &openapi.ServiceList{Services: s.store.Services(filter)})
+}
+
+func (s *Server) getService(w http.ResponseWriter, r *http.Request) {
+	if !allowGet(w, r) {
+		return
+	}
+
+	// IDs contain slashes, which may also be encoded as %2F: r.URL.Path
+	// is already decoded in both cases.
+	id := strings.TrimPrefix(r.URL.Path, "/v1/services/")
+	serv, exists := s.store.Service(id)
+	if !exists {
+		writeError(w, http.StatusNotFound, "No endpoint with this ID has been found.")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, &serv)
+}
+
+func (s *Server) listEvents(w http.ResponseWriter, r *http.Request) {
+	if !allowGet(w, r) {
+		return
+	}
+
+	val := r.URL.Query().Get("since")
+	if len(val) == 0 {
+		writeJSON(w, http.StatusOK, s.store.Events())
+		return
+	}
+
+	since, err := strconv.ParseInt(val, 10, 64)
+	if err != nil || since < 0 {
+		writeError(w, http.StatusBadRequest, "since must be a non-negative integer.")
+		return
+	}
+
+	history, err := s.store.EventsSince(since)
+	if err != nil {
+		if errors.Is(err, ErrEventsGone) {
+			writeError(w, http.StatusGone, "Some of the events after since are not in the history anymore.")
+			return
+		}
+
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, history)
+}
+
+// parseFilter returns the filter defined by the namespace, address and
+// metadata query parameters.
+func parseFilter(query url.Values) (*Filter, error) {
+	filter := &Filter{
+		Namespace: query.Get("namespace"),
+		Address:   query.Get("address"),
+		Metadata:  map[string]string{},
+	}
+
+	for _, mtd := range query["metadata"] {
+		keyVal := strings.SplitN(mtd, "=", 2)
+		if len(keyVal[0]) == 0 {
+			return nil, fmt.Errorf("invalid metadata filter: %s", mtd)
+		}
+
+		filter.Metadata[keyVal[0]] = ""
+		if len(keyVal) == 2 {
+			filter.Metadata[keyVal[0]] = keyVal[1]
+		}
+	}
+
+	return filter, nil
+}
+
+// allowGet returns false, after writing the response, if the request is
+// neither a GET nor a HEAD.
+func allowGet(w http.ResponseWriter, r *http.Request) bool {
+	if r.Method == http.MethodGet || r.Method == http.MethodHead {
+		return true
+	}
+
+	w.Header().Set("Allow", "GET, HEAD")
+	writeError(w, http.StatusMethodNotAllowed, fmt.Sprintf("Method %s is not allowed.", r.Method))
+	return false
+}
+
+func writeError(w http.ResponseWriter, status int, description string) {
+	writeJSON(w, status, &openapi.Response{
+		Status:      int32(status),
+		Title:       strings.ToUpper(http.StatusText(status)),
+		Description: description,
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		log.Err(err).Str("func", "server.writeJSON").Msg("error while writing response")
+	}
+}
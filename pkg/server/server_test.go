@@ -0,0 +1,160 @@
+// Copyright © 2021 Cisco
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// All rights reserved.
+
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/openapi"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServer(t *testing.T) {
+	a := assert.New(t)
+	store := NewStore(2)
+	store.Send(context.Background(), []openapi.Event{
+		{Event: "create", Service: newTestService("ns-1/serv/one", "ns-1", "10.10.10.10", map[string]string{"env": "prod"})},
+		{Event: "create", Service: newTestService("ns-2/serv/two", "ns-2", "10.10.10.11", map[string]string{"env": "dev"})},
+		{Event: "update", Service: newTestService("ns-2/serv/two", "ns-2", "10.10.10.12", map[string]string{"env": "dev"})},
+	})
+	srv := New(store)
+
+	cases := []struct {
+		method    string
+		path      string
+		expStatus int
+		expBody   string
+	}{
+		{
+			method:    http.MethodGet,
+			path:      "/v1/services",
+			expStatus: http.StatusOK,
+			expBody:   `{"services":[{"id":"ns-1/serv/one","name":"ns-1/serv/one","address":"10.10.10.10","port":80,"namespace":"ns-1","metadata":{"env":"prod"}},{"id":"ns-2/serv/two","name":"ns-2/serv/two","address":"10.10.10.12","port":80,"namespace":"ns-2","metadata":{"env":"dev"}}]}`,
+		},
+		{
+			method:    http.MethodGet,
+			path:      "/v1/services?namespace=ns-1&metadata=env",
+			expStatus: http.StatusOK,
+			expBody:   `{"services":[{"id":"ns-1/serv/one","name":"ns-1/serv/one","address":"10.10.10.10","port":80,"namespace":"ns-1","metadata":{"env":"prod"}}]}`,
+		},
+		{
+			method:    http.MethodGet,
+			path:      "/v1/services?metadata=env=staging",
+			expStatus: http.StatusOK,
+			expBody:   `{"services":[]}`,
+		},
+		{
+			method:    http.MethodGet,
+			path:      "/v1/services?metadata==prod",
+			expStatus: http.StatusBadRequest,
+			expBody:   `{"status":400,"title":"BAD REQUEST","description":"invalid metadata filter: =prod"}`,
+		},
+		{
+			method:    http.MethodPost,
+			path:      "/v1/services",
+			expStatus: http.StatusMethodNotAllowed,
+			expBody:   `{"status":405,"title":"METHOD NOT ALLOWED","description":"Method POST is not allowed."}`,
+		},
+		{
+			method:    http.MethodGet,
+			path:      "/v1/services/ns-2/serv/two",
+			expStatus: http.StatusOK,
+			expBody:   `{"id":"ns-2/serv/two","name":"ns-2/serv/two","address":"10.10.10.12","port":80,"namespace":"ns-2","metadata":{"env":"dev"}}`,
+		},
+		{
+			method:    http.MethodGet,
+			path:      "/v1/services/ns-1%2Fserv%2Fone",
+			expStatus: http.StatusOK,
+			expBody:   `{"id":"ns-1/serv/one","name":"ns-1/serv/one","address":"10.10.10.10","port":80,"namespace":"ns-1","metadata":{"env":"prod"}}`,
+		},
+		{
+			method:    http.MethodGet,
+			path:      "/v1/services/ns-1/serv/three",
+			expStatus: http.StatusNotFound,
+			expBody:   `{"status":404,"title":"NOT FOUND","description":"No endpoint with this ID has been found."}`,
+		},
+		{
+			method:    http.MethodGet,
+			path:      "/v1/events?since=-1",
+			expStatus: http.StatusBadRequest,
+			expBody:   `{"status":400,"title":"BAD REQUEST","description":"since must be a non-negative integer."}`,
+		},
+		{
+			method:    http.MethodGet,
+			path:      "/v1/events",
+			expStatus: http.StatusOK,
+			expBody:   `{"events":[{"seq":2,"event":{"timestamp":"0001-01-01T00:00:00Z","event":"create","service":{"id":"ns-2/serv/two","name":"ns-2/serv/two","address":"10.10.10.11","port":80,"namespace":"ns-2","metadata":{"env":"dev"}}}},{"seq":3,"event":{"timestamp":"0001-01-01T00:00:00Z","event":"update","service":{"id":"ns-2/serv/two","name":"ns-2/serv/two","address":"10.10.10.12","port":80,"namespace":"ns-2","metadata":{"env":"dev"}}}}],"last":3}`,
+		},
+		{
+			method:    http.MethodGet,
+			path:      "/v1/events?since=0",
+			expStatus: http.StatusGone,
+			expBody:   `{"status":410,"title":"GONE","description":"Some of the events after since are not in the history anymore."}`,
+		},
+		{
+			method:    http.MethodGet,
+			path:      "/v1/events?since=3",
+			expStatus: http.StatusOK,
+			expBody:   `{"events":[],"last":3}`,
+		},
+	}
+
+	failed := func(i int) {
+		a.FailNow("case failed", fmt.Sprintf("case %d", i))
+	}
+	for i, currCase := range cases {
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, httptest.NewRequest(currCase.method, currCase.path, nil))
+		if !a.Equal(currCase.expStatus, rec.Code) || !a.JSONEq(currCase.expBody, rec.Body.String()) {
+			failed(i)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	srv.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/events?since=1", nil))
+	a.Equal(http.StatusOK, rec.Code)
+
+	var history openapi.EventHistory
+	if !a.NoError(json.Unmarshal(rec.Body.Bytes(), &history)) {
+		return
+	}
+	a.Equal(int64(3), history.Last)
+	if a.Len(history.Events, 2) {
+		a.Equal(int64(2), history.Events[0].Seq)
+		a.Equal("create", history.Events[0].Event.Event)
+		a.Equal(int64(3), history.Events[1].Seq)
+		a.Equal("update", history.Events[1].Event.Event)
+		a.Equal("10.10.10.12", history.Events[1].Event.Service.Address)
+	}
+}
+
+func TestServeMetrics(t *testing.T) {
+	a := assert.New(t)
+	srv := New(NewStore(1))
+
+	rec := httptest.NewRecorder()
+	srv.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	a.Equal(http.StatusOK, rec.Code)
+	a.Contains(rec.Body.String(), "go_goroutines")
+}
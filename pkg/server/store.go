@@ -0,0 +1,345 @@
+// Copyright © 2021 Cisco
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// All rights reserved.
+
+package server
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/openapi"
+	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/services"
+	"github.com/google/uuid"
+)
+
+const (
+	// DefaultHistorySize is the number of events kept in the history,
+	// unless another one is specified.
+	DefaultHistorySize int = 1000
+
+	// subscriptionBuffer is the number of events that a subscriber can
+	// fall behind before being dropped.
+	subscriptionBuffer int = 256
+)
+
+var (
+	// ErrEventsGone is returned when some of the requested events are
+	// not in the history anymore.
+	ErrEventsGone = errors.New("some of the events after since are not in the history anymore")
+)
+
+// Filter contains the values that services must have in order to be
+// returned. Empty values match all services.
+type Filter struct {
+	Namespace string
+	Address   string
+	// Metadata that services must have. A key with an empty value only
+	// requires the key to be there.
+	Metadata map[string]string
+}
+
+// Store keeps the current state of the services and a history of the latest
+// events.
+//
+// It implements services.Handler and services.Syncer, so it is fed by a
+// queue like any other adaptor.
+type Store struct {
+	lock        sync.RWMutex
+	services    map[string]openapi.ServiceV2
+	history     []openapi.HistoryEvent
+	size        int
+	last        int64
+	subscribers map[*Subscription]bool
+}
+
+// Subscription receives events as soon as they are recorded by the store.
+type Subscription struct {
+	// Events receives the events, and it is closed when the subscription
+	// is canceled or when the subscriber falls too far behind. In the
+	// latter case, the subscriber can subscribe again from the last event
+	// it received.
+	Events <-chan openapi.HistoryEvent
+
+	events chan openapi.HistoryEvent
+	filter *Filter
+}
+
+// NewStore returns a store that keeps at most size events in the history.
+// If size is 0 or less, DefaultHistorySize is used.
+func NewStore(size int) *Store {
+	if size <= 0 {
+		size = DefaultHistorySize
+	}
+
+	return &Store{
+		services:    map[string]openapi.ServiceV2{},
+		history:     []openapi.HistoryEvent{},
+		size:        size,
+		subscribers: map[*Subscription]bool{},
+	}
+}
+
+// Send updates the state with the events and adds them to the history.
+func (s *Store) Send(ctx context.Context, events []openapi.Event) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for _, ev := range services.ToEventsV2(events) {
+		if ev.Event == "delete" {
+			delete(s.services, ev.Service.Id)
+		} else {
+			s.services[ev.Service.Id] = ev.Service
+		}
+
+		s.record(ev)
+	}
+
+	return nil
+}
+
+// Sync replaces the state with servs.
+//
+// Since the queue discards events that were not sent yet when the full
+// state is sent, the differences with the previous state are added to the
+// history as new events.
+func (s *Store) Sync(ctx context.Context, servs []openapi.Service) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	now := time.Now().UTC()
+	newEvent := func(event string, serv openapi.ServiceV2) openapi.EventV2 {
+		return openapi.EventV2{
+			Id:        uuid.New().String(),
+			Timestamp: now,
+			Event:     event,
+			Service:   serv,
+		}
+	}
+
+	state := make(map[string]openapi.ServiceV2, len(servs))
+	for _, serv := range servs {
+		state[serv.Id] = services.ToServiceV2(serv)
+	}
+
+	for _, id := range sortedKeys(state) {
+		prev, exists := s.services[id]
+		switch {
+		case !exists:
+			s.record(newEvent("create", state[id]))
+		case !reflect.DeepEqual(prev, state[id]):
+			s.record(newEvent("update", state[id]))
+		}
+	}
+
+	for _, id := range sortedKeys(s.services) {
+		if _, exists := state[id]; !exists {
+			s.record(newEvent("delete", s.services[id]))
+		}
+	}
+
+	s.services = state
+	return nil
+}
+
+// record adds the event to the history, removing the oldest one if the
+// history is full. It must be called with the lock held.
+func (s *Store) record(ev openapi.EventV2) {
+	s.last++
+	if len(s.history) == s.size {
+		copy(s.history, s.history[1:])
+		s.history = s.history[:s.size-1]
+	}
+
+	histEv := openapi.HistoryEvent{Seq: s.last, Event: ev}
+	s.history = append(s.history, histEv)
+
+	for sub := range s.subscribers {
+		if !sub.filter.matches(ev.Service) {
+			continue
+		}
+
+		select {
+		case sub.events <- histEv:
+		default:
+			// The subscriber is too slow: rather than blocking everyone
+			// else, it is dropped.
+			s.unsubscribe(sub)
+		}
+	}
+}
+
+// Services returns the services that match the filter, sorted by their
+// IDs.
+func (s *Store) Services(filter *Filter) []openapi.ServiceV2 {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	servs := []openapi.ServiceV2{}
+	for _, id := range sortedKeys(s.services) {
+		if serv := s.services[id]; filter.matches(serv) {
+			servs = append(servs, serv)
+		}
+	}
+
+	return servs
+}
+
+// Service returns the service with the provided ID, and false if it does
+// not exist.
+func (s *Store) Service(id string) (openapi.ServiceV2, bool) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	serv, exists := s.services[id]
+	return serv, exists
+}
+
+// Events returns all the events in the history, along with the seq of the
+// latest event.
+func (s *Store) Events() *openapi.EventHistory {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	return &openapi.EventHistory{
+		Events: append([]openapi.HistoryEvent{}, s.history...),
+		Last:   s.last,
+	}
+}
+
+// EventsSince returns the events that came after the one with seq since,
+// along with the seq of the latest event.
+//
+// ErrEventsGone is returned if some of these events are not in the history
+// anymore, or if since is greater than the seq of the latest event, which
+// means that the history has been reset since then, e.g. because the
+// program has been restarted.
+func (s *Store) EventsSince(since int64) (*openapi.EventHistory, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	return s.eventsSince(since)
+}
+
+// eventsSince is the same as EventsSince, but it must be called with the
+// lock held.
+func (s *Store) eventsSince(since int64) (*openapi.EventHistory, error) {
+	if since > s.last {
+		return nil, ErrEventsGone
+	}
+
+	first := s.last - int64(len(s.history)) + 1
+	if since < first-1 {
+		return nil, ErrEventsGone
+	}
+
+	// The history has no gaps, so the position of an event can be found
+	// from its seq.
+	events := s.history[since-first+1:]
+	return &openapi.EventHistory{
+		Events: append([]openapi.HistoryEvent{}, events...),
+		Last:   s.last,
+	}, nil
+}
+
+// Subscribe returns a subscription that receives the events that match the
+// filter. If since is not nil, the events in the history that came after
+// the one with seq since are received first, and ErrEventsGone is returned
+// if any of them is not in the history anymore.
+func (s *Store) Subscribe(since *int64, filter *Filter) (*Subscription, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	backlog := []openapi.HistoryEvent{}
+	if since != nil {
+		history, err := s.eventsSince(*since)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, ev := range history.Events {
+			if filter.matches(ev.Event.Service) {
+				backlog = append(backlog, ev)
+			}
+		}
+	}
+
+	events := make(chan openapi.HistoryEvent, len(backlog)+subscriptionBuffer)
+	for _, ev := range backlog {
+		events <- ev
+	}
+
+	sub := &Subscription{Events: events, events: events, filter: filter}
+	s.subscribers[sub] = true
+	return sub, nil
+}
+
+// Unsubscribe cancels the subscription and closes its channel.
+func (s *Store) Unsubscribe(sub *Subscription) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.unsubscribe(sub)
+}
+
+// unsubscribe must be called with the lock held.
+func (s *Store) unsubscribe(sub *Subscription) {
+	if !s.subscribers[sub] {
+		return
+	}
+
+	delete(s.subscribers, sub)
+	close(sub.events)
+}
+
+// matches returns true if serv has all the values of the filter.
+func (f *Filter) matches(serv openapi.ServiceV2) bool {
+	if f == nil {
+		return true
+	}
+
+	if len(f.Namespace) > 0 && f.Namespace != serv.Namespace {
+		return false
+	}
+
+	if len(f.Address) > 0 && f.Address != serv.Address {
+		return false
+	}
+
+	for key, val := range f.Metadata {
+		servVal, exists := serv.Metadata[key]
+		if !exists || (len(val) > 0 && val != servVal) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func sortedKeys(servs map[string]openapi.ServiceV2) []string {
+	keys := make([]string, 0, len(servs))
+	for key := range servs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
@@ -0,0 +1,228 @@
+// Copyright © 2021 Cisco
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// All rights reserved.
+
+package server
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/openapi"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestService(id, ns, address string, metadata map[string]string) openapi.Service {
+	serv := openapi.Service{Id: id, Name: id, Namespace: ns, Address: address, Port: 80}
+	for key, val := range metadata {
+		serv.Metadata = append(serv.Metadata, openapi.Metadata{Key: key, Value: val})
+	}
+
+	return serv
+}
+
+func TestStoreServices(t *testing.T) {
+	a := assert.New(t)
+	store := NewStore(0)
+	store.Send(context.Background(), []openapi.Event{
+		{Event: "create", Service: newTestService("ns-1/serv/one", "ns-1", "10.10.10.10", map[string]string{"env": "prod"})},
+		{Event: "create", Service: newTestService("ns-1/serv/two", "ns-1", "10.10.10.11", map[string]string{"env": "dev"})},
+		{Event: "create", Service: newTestService("ns-2/serv/three", "ns-2", "10.10.10.10", map[string]string{"env": "prod", "tier": "gold"})},
+		{Event: "create", Service: newTestService("ns-2/serv/four", "ns-2", "10.10.10.12", nil)},
+	})
+	store.Send(context.Background(), []openapi.Event{
+		{Event: "delete", Service: newTestService("ns-2/serv/four", "ns-2", "10.10.10.12", nil)},
+	})
+
+	ids := func(servs []openapi.ServiceV2) []string {
+		res := []string{}
+		for _, serv := range servs {
+			res = append(res, serv.Id)
+		}
+		return res
+	}
+
+	cases := []struct {
+		filter *Filter
+		expRes []string
+	}{
+		{
+			expRes: []string{"ns-1/serv/one", "ns-1/serv/two", "ns-2/serv/three"},
+		},
+		{
+			filter: &Filter{Namespace: "ns-2"},
+			expRes: []string{"ns-2/serv/three"},
+		},
+		{
+			filter: &Filter{Address: "10.10.10.10"},
+			expRes: []string{"ns-1/serv/one", "ns-2/serv/three"},
+		},
+		{
+			filter: &Filter{Metadata: map[string]string{"env": "prod"}},
+			expRes: []string{"ns-1/serv/one", "ns-2/serv/three"},
+		},
+		{
+			filter: &Filter{Metadata: map[string]string{"env": "", "tier": ""}},
+			expRes: []string{"ns-2/serv/three"},
+		},
+		{
+			filter: &Filter{Namespace: "ns-1", Metadata: map[string]string{"tier": ""}},
+			expRes: []string{},
+		},
+	}
+
+	failed := func(i int) {
+		a.FailNow("case failed", fmt.Sprintf("case %d", i))
+	}
+	for i, currCase := range cases {
+		if !a.Equal(currCase.expRes, ids(store.Services(currCase.filter))) {
+			failed(i)
+		}
+	}
+
+	serv, exists := store.Service("ns-1/serv/one")
+	a.True(exists)
+	a.Equal(map[string]string{"env": "prod"}, serv.Metadata)
+	_, exists = store.Service("ns-2/serv/four")
+	a.False(exists)
+}
+
+func TestStoreEventsSince(t *testing.T) {
+	a := assert.New(t)
+	store := NewStore(3)
+
+	history, err := store.EventsSince(0)
+	a.NoError(err)
+	a.Equal(&openapi.EventHistory{Events: []openapi.HistoryEvent{}, Last: 0}, history)
+
+	for i := 1; i <= 5; i++ {
+		store.Send(context.Background(), []openapi.Event{
+			{Id: fmt.Sprintf("event-%d", i), Event: "update", Service: newTestService("ns/serv/endp", "ns", "10.10.10.10", nil)},
+		})
+	}
+
+	cases := []struct {
+		since  int64
+		expRes []int64
+		expErr error
+	}{
+		{since: 0, expErr: ErrEventsGone},
+		{since: 1, expErr: ErrEventsGone},
+		{since: 2, expRes: []int64{3, 4, 5}},
+		{since: 4, expRes: []int64{5}},
+		{since: 5, expRes: []int64{}},
+		{since: 6, expErr: ErrEventsGone},
+	}
+
+	// Without since, the whole history is returned even if it has wrapped
+	all := store.Events()
+	if a.Len(all.Events, 3) {
+		a.Equal(int64(3), all.Events[0].Seq)
+		a.Equal(int64(5), all.Last)
+	}
+
+	failed := func(i int) {
+		a.FailNow("case failed", fmt.Sprintf("case %d", i))
+	}
+	for i, currCase := range cases {
+		history, err := store.EventsSince(currCase.since)
+		if !a.Equal(currCase.expErr, err) {
+			failed(i)
+		}
+		if err != nil {
+			continue
+		}
+
+		seqs := []int64{}
+		for _, ev := range history.Events {
+			seqs = append(seqs, ev.Seq)
+			a.Equal(fmt.Sprintf("event-%d", ev.Seq), ev.Event.Id)
+		}
+		if !a.Equal(currCase.expRes, seqs) || !a.Equal(int64(5), history.Last) {
+			failed(i)
+		}
+	}
+}
+
+func TestStoreSync(t *testing.T) {
+	a := assert.New(t)
+	store := NewStore(0)
+	store.Send(context.Background(), []openapi.Event{
+		{Event: "create", Service: newTestService("ns/serv/one", "ns", "10.10.10.10", nil)},
+		{Event: "create", Service: newTestService("ns/serv/two", "ns", "10.10.10.11", nil)},
+	})
+
+	store.Sync(context.Background(), []openapi.Service{
+		newTestService("ns/serv/one", "ns", "10.10.10.10", nil),
+		newTestService("ns/serv/three", "ns", "10.10.10.13", nil),
+		newTestService("ns/serv/two", "ns", "10.10.10.12", nil),
+	})
+
+	history, err := store.EventsSince(2)
+	if !a.NoError(err) {
+		return
+	}
+
+	events := []string{}
+	for _, ev := range history.Events {
+		events = append(events, ev.Event.Event+" "+ev.Event.Service.Id)
+		a.NotEmpty(ev.Event.Id)
+	}
+	a.Equal([]string{"create ns/serv/three", "update ns/serv/two"}, events)
+
+	store.Sync(context.Background(), []openapi.Service{})
+	history, _ = store.EventsSince(4)
+	a.Len(history.Events, 3)
+	a.Empty(store.Services(nil))
+}
+
+func TestStoreSubscribe(t *testing.T) {
+	a := assert.New(t)
+	store := NewStore(0)
+	serv := newTestService("ns/serv/endp", "ns", "10.10.10.10", nil)
+
+	sub, err := store.Subscribe(nil, &Filter{Namespace: "ns"})
+	if !a.NoError(err) {
+		return
+	}
+
+	store.Send(context.Background(), []openapi.Event{
+		{Event: "create", Service: serv},
+		{Event: "create", Service: newTestService("other/serv/endp", "other", "10.10.10.11", nil)},
+	})
+	a.Equal(int64(1), (<-sub.Events).Seq)
+
+	store.Unsubscribe(sub)
+	_, open := <-sub.Events
+	a.False(open)
+
+	// Subscribers that fall too far behind are dropped
+	slow, _ := store.Subscribe(nil, nil)
+	for i := 0; i <= subscriptionBuffer; i++ {
+		store.Send(context.Background(), []openapi.Event{{Event: "update", Service: serv}})
+	}
+
+	received := 0
+	for range slow.Events {
+		received++
+	}
+	a.Equal(subscriptionBuffer, received)
+
+	_, err = store.Subscribe(func() *int64 { since := int64(1000); return &since }(), nil)
+	a.Equal(ErrEventsGone, err)
+}
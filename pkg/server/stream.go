@@ -0,0 +1,213 @@
+// Copyright © 2021 Cisco
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// All rights reserved.
+
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// keepAliveInterval is the time after which a message is sent to
+	// keep streams open, if there are no events.
+	keepAliveInterval time.Duration = 30 * time.Second
+	// writeTimeout is the time to wait for a message to be written to a
+	// WebSocket.
+	writeTimeout time.Duration = 10 * time.Second
+)
+
+var (
+	upgrader = websocket.Upgrader{
+		// Dashboards may be served from another origin, and the server
+		// doesn't use cookies or any other credentials anyway.
+		CheckOrigin: func(*http.Request) bool { return true },
+	}
+)
+
+// streamEvents sends the events as soon as they are observed, via
+// WebSocket if the request is a WebSocket handshake, or as Server-Sent
+// Events otherwise.
+func (s *Server) streamEvents(w http.ResponseWriter, r *http.Request) {
+	if !allowGet(w, r) {
+		return
+	}
+
+	filter, err := parseFilter(r.URL.Query())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	since, err := parseResumePoint(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	sub, err := s.store.Subscribe(since, filter)
+	if err != nil {
+		if errors.Is(err, ErrEventsGone) {
+			writeError(w, http.StatusGone, "Some of the events after since are not in the history anymore.")
+			return
+		}
+
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer s.store.Unsubscribe(sub)
+
+	if websocket.IsWebSocketUpgrade(r) {
+		s.streamWebSocket(w, r, sub)
+		return
+	}
+
+	s.streamSSE(w, r, sub)
+}
+
+// parseResumePoint returns the seq of the last event received by the
+// client, from the Last-Event-ID header or, since browsers can't set it
+// for WebSockets, from the since query parameter. nil is returned if none
+// of them is provided.
+func parseResumePoint(r *http.Request) (*int64, error) {
+	val := r.Header.Get("Last-Event-ID")
+	if len(val) == 0 {
+		val = r.URL.Query().Get("since")
+	}
+	if len(val) == 0 {
+		return nil, nil
+	}
+
+	since, err := strconv.ParseInt(val, 10, 64)
+	if err != nil || since < 0 {
+		return nil, fmt.Errorf("invalid last event ID: %s", val)
+	}
+
+	return &since, nil
+}
+
+func (s *Server) streamSSE(w http.ResponseWriter, r *http.Request, sub *Subscription) {
+	l := log.With().Str("func", "server.Server.streamSSE").Str("remote-address", r.RemoteAddr).Logger()
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "Streaming is not supported.")
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	l.Debug().Msg("client subscribed")
+	keepAlive := time.NewTicker(keepAliveInterval)
+	defer keepAlive.Stop()
+
+	for {
+		var err error
+		select {
+		case ev, ok := <-sub.Events:
+			if !ok {
+				// The client fell behind: it will reconnect with the ID
+				// of the last event it received.
+				l.Warn().Msg("client is too slow, closing stream")
+				return
+			}
+
+			data, _ := json.Marshal(ev.Event)
+			_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", ev.Seq, ev.Event.Event, data)
+		case <-keepAlive.C:
+			_, err = fmt.Fprint(w, ": keep-alive\n\n")
+		case <-r.Context().Done():
+			l.Debug().Msg("client unsubscribed")
+			return
+		case <-s.closing:
+			return
+		}
+
+		if err != nil {
+			l.Err(err).Msg("error while writing event, closing stream")
+			return
+		}
+		flusher.Flush()
+	}
+}
+
+func (s *Server) streamWebSocket(w http.ResponseWriter, r *http.Request, sub *Subscription) {
+	l := log.With().Str("func", "server.Server.streamWebSocket").Str("remote-address", r.RemoteAddr).Logger()
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// The upgrader already replied to the client
+		l.Err(err).Msg("could not upgrade connection")
+		return
+	}
+	defer conn.Close()
+
+	// Clients are not expected to send messages, but they must be read
+	// anyway in order to handle pings and close messages.
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+
+	l.Debug().Msg("client subscribed")
+	keepAlive := time.NewTicker(keepAliveInterval)
+	defer keepAlive.Stop()
+
+	for {
+		var err error
+		select {
+		case ev, ok := <-sub.Events:
+			if !ok {
+				l.Warn().Msg("client is too slow, closing stream")
+				conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "too slow"), time.Now().Add(writeTimeout))
+				return
+			}
+
+			conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+			err = conn.WriteJSON(ev)
+		case <-keepAlive.C:
+			err = conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeTimeout))
+		case <-closed:
+			l.Debug().Msg("client unsubscribed")
+			return
+		case <-s.closing:
+			conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, ""), time.Now().Add(writeTimeout))
+			return
+		}
+
+		if err != nil {
+			l.Err(err).Msg("error while writing event, closing stream")
+			return
+		}
+	}
+}
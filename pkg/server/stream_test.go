@@ -0,0 +1,140 @@
+// Copyright © 2021 Cisco
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// All rights reserved.
+
+package server
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/openapi"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStreamSSE(t *testing.T) {
+	a := assert.New(t)
+	store := NewStore(2)
+	store.Send(context.Background(), []openapi.Event{
+		{Event: "create", Service: newTestService("ns/serv/one", "ns", "10.10.10.10", map[string]string{"env": "prod"})},
+		{Event: "create", Service: newTestService("ns/serv/two", "ns", "10.10.10.11", map[string]string{"env": "dev"})},
+		{Event: "create", Service: newTestService("ns/serv/three", "ns", "10.10.10.12", map[string]string{"env": "prod"})},
+	})
+	srv := httptest.NewServer(New(store))
+	defer srv.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"/v1/events/stream", nil)
+	req.Header.Set("Last-Event-ID", "0")
+	resp, err := http.DefaultClient.Do(req)
+	if a.NoError(err) {
+		a.Equal(http.StatusGone, resp.StatusCode)
+		resp.Body.Close()
+	}
+
+	req, _ = http.NewRequest(http.MethodGet, srv.URL+"/v1/events/stream?metadata=env=prod", nil)
+	req.Header.Set("Last-Event-ID", "1")
+	resp, err = http.DefaultClient.Do(req)
+	if !a.NoError(err) {
+		return
+	}
+	defer resp.Body.Close()
+	a.Equal(http.StatusOK, resp.StatusCode)
+	a.Equal("text/event-stream", resp.Header.Get("Content-Type"))
+
+	store.Send(context.Background(), []openapi.Event{
+		{Event: "update", Service: newTestService("ns/serv/two", "ns", "10.10.10.13", map[string]string{"env": "dev"})},
+		{Event: "delete", Service: newTestService("ns/serv/one", "ns", "10.10.10.10", map[string]string{"env": "prod"})},
+	})
+
+	// Only the events in the history after 1 and the live ones that
+	// match the filter are received
+	reader := bufio.NewReader(resp.Body)
+	for _, exp := range []struct {
+		id    string
+		event string
+		serv  string
+	}{
+		{id: "3", event: "create", serv: "ns/serv/three"},
+		{id: "5", event: "delete", serv: "ns/serv/one"},
+	} {
+		lines := []string{}
+		for {
+			line, err := reader.ReadString('\n')
+			if !a.NoError(err) {
+				return
+			}
+			if line == "\n" {
+				break
+			}
+			lines = append(lines, strings.TrimSuffix(line, "\n"))
+		}
+
+		if a.Len(lines, 3) {
+			a.Equal("id: "+exp.id, lines[0])
+			a.Equal("event: "+exp.event, lines[1])
+			a.Contains(lines[2], `"id":"`+exp.serv+`"`)
+		}
+	}
+}
+
+func TestStreamWebSocket(t *testing.T) {
+	a := assert.New(t)
+	store := NewStore(0)
+	store.Send(context.Background(), []openapi.Event{
+		{Event: "create", Service: newTestService("ns-1/serv/one", "ns-1", "10.10.10.10", nil)},
+	})
+	srv := httptest.NewServer(New(store))
+	defer srv.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(srv.URL, "http") + "/v1/events/stream"
+	_, resp, err := websocket.DefaultDialer.Dial(wsURL+"?since=abc", nil)
+	if a.Error(err) && a.NotNil(resp) {
+		a.Equal(http.StatusBadRequest, resp.StatusCode)
+	}
+
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL+"?since=0&namespace=ns-1", nil)
+	if !a.NoError(err) {
+		return
+	}
+	defer conn.Close()
+
+	store.Send(context.Background(), []openapi.Event{
+		{Event: "create", Service: newTestService("ns-2/serv/two", "ns-2", "10.10.10.11", nil)},
+		{Event: "update", Service: newTestService("ns-1/serv/one", "ns-1", "10.10.10.12", nil)},
+	})
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for _, exp := range []openapi.HistoryEvent{
+		{Seq: 1, Event: openapi.EventV2{Event: "create", Service: openapi.ServiceV2{Id: "ns-1/serv/one", Address: "10.10.10.10"}}},
+		{Seq: 3, Event: openapi.EventV2{Event: "update", Service: openapi.ServiceV2{Id: "ns-1/serv/one", Address: "10.10.10.12"}}},
+	} {
+		var ev openapi.HistoryEvent
+		if !a.NoError(conn.ReadJSON(&ev)) {
+			return
+		}
+		a.Equal(exp.Seq, ev.Seq)
+		a.Equal(exp.Event.Event, ev.Event.Event)
+		a.Equal(exp.Event.Service.Id, ev.Event.Service.Id)
+		a.Equal(exp.Event.Service.Address, ev.Event.Service.Address)
+	}
+}
@@ -0,0 +1,222 @@
+// Copyright © 2021 Cisco
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// All rights reserved.
+
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/openapi"
+)
+
+const (
+	// DefaultAPIKeyHeader is the header where the API key is sent, unless
+	// another one is specified.
+	DefaultAPIKeyHeader string = "X-API-Key"
+)
+
+// AuthOptions contains the credentials to authenticate to the adaptor with.
+// Only one between a bearer token and basic auth can be used, while an API
+// key can be used with any of them.
+type AuthOptions struct {
+	// BearerTokenFile is the path of a file containing a bearer token.
+	// The file is read again when it changes, so the token can be rotated
+	// without restarting the program.
+	BearerTokenFile string
+	// Username for basic auth.
+	Username string
+	// Password for basic auth.
+	Password string
+	// APIKey to send in the APIKeyHeader header.
+	APIKey string
+	// APIKeyHeader is the header where to send the API key.
+	// If empty, DefaultAPIKeyHeader is used.
+	APIKeyHeader string
+}
+
+// authenticator provides the credentials to include in each request.
+type authenticator struct {
+	opts  *AuthOptions
+	token *secretFile
+}
+
+func newAuthenticator(opts *AuthOptions) (*authenticator, error) {
+	if opts == nil {
+		return nil, nil
+	}
+
+	if len(opts.BearerTokenFile) > 0 && (len(opts.Username) > 0 || len(opts.Password) > 0) {
+		return nil, errors.New("only one between bearer token and basic auth can be used")
+	}
+
+	if len(opts.Password) > 0 && len(opts.Username) == 0 {
+		return nil, errors.New("password set but no username provided")
+	}
+
+	auth := &authenticator{opts: opts}
+	if len(opts.BearerTokenFile) > 0 {
+		token, err := newSecretFile(opts.BearerTokenFile, "bearer token")
+		if err != nil {
+			return nil, err
+		}
+		auth.token = token
+	}
+
+	return auth, nil
+}
+
+// secretFile is a file containing a secret, which is read again in case it
+// changes since the last time it was read.
+type secretFile struct {
+	path string
+	name string
+
+	lock   sync.Mutex
+	secret string
+	mod    time.Time
+	size   int64
+}
+
+// newSecretFile returns the secret in path. name is used in errors.
+// The file is read immediately, so that errors are found on start.
+func newSecretFile(path, name string) (*secretFile, error) {
+	s := &secretFile{path: path, name: name}
+	if _, err := s.get(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// get returns the secret, reading it again from its file in case it has
+// changed since the last time it was read.
+func (s *secretFile) get() (string, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return "", fmt.Errorf("could not read %s: %w", s.name, err)
+	}
+
+	if len(s.secret) > 0 && info.ModTime().Equal(s.mod) && info.Size() == s.size {
+		return s.secret, nil
+	}
+
+	b, err := ioutil.ReadFile(s.path)
+	if err != nil {
+		return "", fmt.Errorf("could not read %s: %w", s.name, err)
+	}
+
+	secret := strings.TrimSpace(string(b))
+	if len(secret) == 0 {
+		return "", fmt.Errorf("%s file is empty", s.name)
+	}
+
+	s.secret, s.mod, s.size = secret, info.ModTime(), info.Size()
+	return s.secret, nil
+}
+
+func (a *authenticator) apiKeyHeader() string {
+	if len(a.opts.APIKeyHeader) == 0 {
+		return DefaultAPIKeyHeader
+	}
+
+	return a.opts.APIKeyHeader
+}
+
+// withContext returns a copy of ctx with the credentials stored in the
+// context keys used by the openapi client.
+//
+// Since the openapi client only sends the API key in DefaultAPIKeyHeader,
+// an API key that must be sent in another header is not included here.
+func (a *authenticator) withContext(ctx context.Context) (context.Context, error) {
+	if a == nil {
+		return ctx, nil
+	}
+
+	if a.token != nil {
+		token, err := a.token.get()
+		if err != nil {
+			return nil, err
+		}
+		ctx = context.WithValue(ctx, openapi.ContextAccessToken, token)
+	}
+
+	if len(a.opts.Username) > 0 {
+		ctx = context.WithValue(ctx, openapi.ContextBasicAuth, openapi.BasicAuth{
+			UserName: a.opts.Username,
+			Password: a.opts.Password,
+		})
+	}
+
+	if len(a.opts.APIKey) > 0 && http.CanonicalHeaderKey(a.apiKeyHeader()) == http.CanonicalHeaderKey(DefaultAPIKeyHeader) {
+		ctx = context.WithValue(ctx, openapi.ContextAPIKey, openapi.APIKey{Key: a.opts.APIKey})
+	}
+
+	return ctx, nil
+}
+
+// staticHeaders returns the headers with credentials that never change.
+//
+// These are the ones that can't be passed with withContext.
+func (a *authenticator) staticHeaders() map[string]string {
+	if a == nil {
+		return map[string]string{}
+	}
+
+	headers := map[string]string{}
+	if len(a.opts.APIKey) > 0 && http.CanonicalHeaderKey(a.apiKeyHeader()) != http.CanonicalHeaderKey(DefaultAPIKeyHeader) {
+		headers[a.apiKeyHeader()] = a.opts.APIKey
+	}
+
+	return headers
+}
+
+// apply sets the credentials on the request.
+func (a *authenticator) apply(req *http.Request) error {
+	if a == nil {
+		return nil
+	}
+
+	if a.token != nil {
+		token, err := a.token.get()
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	if len(a.opts.Username) > 0 {
+		req.SetBasicAuth(a.opts.Username, a.opts.Password)
+	}
+
+	if len(a.opts.APIKey) > 0 {
+		req.Header.Set(a.apiKeyHeader(), a.opts.APIKey)
+	}
+
+	return nil
+}
@@ -0,0 +1,188 @@
+// Copyright © 2021 Cisco
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// All rights reserved.
+
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/openapi"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewAuthenticator(t *testing.T) {
+	a := assert.New(t)
+	dir, err := ioutil.TempDir("", "cnwan-auth")
+	if !a.NoError(err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	emptyFile := path.Join(dir, "empty")
+	ioutil.WriteFile(emptyFile, []byte("\n"), 0600)
+
+	cases := []struct {
+		opts   *AuthOptions
+		expErr error
+	}{
+		{},
+		{
+			opts:   &AuthOptions{BearerTokenFile: "token", Username: "user"},
+			expErr: errors.New("only one between bearer token and basic auth can be used"),
+		},
+		{
+			opts:   &AuthOptions{Password: "pass"},
+			expErr: errors.New("password set but no username provided"),
+		},
+		{
+			opts:   &AuthOptions{BearerTokenFile: emptyFile},
+			expErr: errors.New("bearer token file is empty"),
+		},
+		{
+			opts: &AuthOptions{Username: "user", APIKey: "key"},
+		},
+	}
+
+	failed := func(i int) {
+		a.FailNow("case failed", fmt.Sprintf("case %d", i))
+	}
+	for i, currCase := range cases {
+		_, err := newAuthenticator(currCase.opts)
+		if !a.Equal(currCase.expErr, err) {
+			failed(i)
+		}
+	}
+
+	_, err = newAuthenticator(&AuthOptions{BearerTokenFile: path.Join(dir, "does-not-exist")})
+	a.Error(err)
+}
+
+func TestAuthenticatedRequests(t *testing.T) {
+	a := assert.New(t)
+	dir, err := ioutil.TempDir("", "cnwan-auth")
+	if !a.NoError(err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	tokenFile := path.Join(dir, "token")
+	if !a.NoError(ioutil.WriteFile(tokenFile, []byte("first-token\n"), 0600)) {
+		return
+	}
+
+	var header http.Header
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+	endpoint := strings.TrimPrefix(srv.URL, "http://")
+	events := []openapi.Event{{Event: "create"}}
+
+	cases := []struct {
+		format string
+		opts   *AuthOptions
+		check  func(h http.Header) bool
+	}{
+		{
+			opts: &AuthOptions{Username: "user", Password: "pass", APIKey: "key"},
+			check: func(h http.Header) bool {
+				return a.Equal("Basic dXNlcjpwYXNz", h.Get("Authorization")) &&
+					a.Equal("key", h.Get(DefaultAPIKeyHeader)) &&
+					a.Equal("static", h.Get("X-Static"))
+			},
+		},
+		{
+			opts: &AuthOptions{APIKey: "key", APIKeyHeader: "X-Custom-Key"},
+			check: func(h http.Header) bool {
+				return a.Equal("key", h.Get("X-Custom-Key")) &&
+					a.Empty(h.Get(DefaultAPIKeyHeader)) &&
+					a.Equal("static", h.Get("X-Static"))
+			},
+		},
+		{
+			format: FormatCloudEventsBatch,
+			opts:   &AuthOptions{APIKey: "key", APIKeyHeader: "X-Custom-Key"},
+			check: func(h http.Header) bool {
+				return a.Equal("key", h.Get("X-Custom-Key")) &&
+					a.Equal("static", h.Get("X-Static"))
+			},
+		},
+		{
+			format: FormatCloudEventsBinary,
+			opts:   &AuthOptions{Username: "user", Password: "pass"},
+			check: func(h http.Header) bool {
+				return a.Equal("Basic dXNlcjpwYXNz", h.Get("Authorization"))
+			},
+		},
+	}
+
+	failed := func(i int) {
+		a.FailNow("case failed", fmt.Sprintf("case %d", i))
+	}
+	for i, currCase := range cases {
+		h, err := NewHandler(endpoint, &HandlerOptions{
+			Format:  currCase.format,
+			Auth:    currCase.opts,
+			Headers: map[string]string{"X-Static": "static"},
+		})
+		if !a.NoError(err) {
+			failed(i)
+		}
+
+		if !a.NoError(h.Send(context.Background(), events)) || !currCase.check(header) {
+			failed(i)
+		}
+	}
+
+	// The token is read again when it changes
+	for _, format := range []string{FormatOpenAPI, FormatCloudEventsStructured} {
+		if !a.NoError(ioutil.WriteFile(tokenFile, []byte("first-token\n"), 0600)) {
+			return
+		}
+
+		h, err := NewHandler(endpoint, &HandlerOptions{
+			Format: format,
+			Auth:   &AuthOptions{BearerTokenFile: tokenFile},
+		})
+		if !a.NoError(err) {
+			return
+		}
+
+		a.NoError(h.Send(context.Background(), events))
+		a.Equal("Bearer first-token", header.Get("Authorization"))
+
+		a.NoError(ioutil.WriteFile(tokenFile, []byte("second-token-rotated"), 0600))
+		// Make sure the modification time changes even on coarse filesystems
+		later := time.Now().Add(time.Minute)
+		a.NoError(os.Chtimes(tokenFile, later, later))
+
+		a.NoError(h.Send(context.Background(), events))
+		a.Equal("Bearer second-token-rotated", header.Get("Authorization"))
+	}
+}
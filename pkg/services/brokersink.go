@@ -0,0 +1,250 @@
+// Copyright © 2021 Cisco
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// All rights reserved.
+
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/openapi"
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel"
+)
+
+const (
+	// EndpointIDHeader is the header of messages published to brokers that
+	// contains the ID of the endpoint the event is about.
+	EndpointIDHeader string = "Cnwan-Endpoint-Id"
+	// EventTypeHeader is the header of messages published to brokers that
+	// contains the type of the event, i.e. create, update or delete.
+	EventTypeHeader string = "Cnwan-Event-Type"
+)
+
+// brokerMessage is an event to publish to a message broker.
+type brokerMessage struct {
+	// subject is the NATS subject or the Kafka topic
+	subject string
+	// key is the ID of the endpoint, used by Kafka to choose the partition
+	key     string
+	headers map[string]string
+	data    []byte
+}
+
+// publisher publishes messages to a message broker.
+type publisher interface {
+	// publish returns only after the broker acknowledged all messages,
+	// or an error if any of them was not acknowledged.
+	publish(ctx context.Context, msgs []*brokerMessage) error
+}
+
+// brokerHandler publishes each event as a message to a message broker, on a
+// subject that is chosen for each event with a template.
+type brokerHandler struct {
+	name    string
+	pub     publisher
+	subject *template.Template
+	headers map[string]string
+	enc     *eventEncoder
+}
+
+// subjectData contains the values that can be used in subject and topic
+// templates, e.g. cnwan.{{.Namespace}}.{{.Metadata.env}}
+type subjectData struct {
+	// Event is create, update or delete
+	Event     string
+	ID        string
+	Name      string
+	Address   string
+	Port      int32
+	Namespace string
+	Service   string
+	Source    string
+	Metadata  map[string]string
+}
+
+// brokerURL contains the parts of the url of a message broker, e.g.
+// nats://host-1:4222,host-2:4222?subject=cnwan.events
+type brokerURL struct {
+	scheme string
+	hosts  []string
+	query  url.Values
+}
+
+// parseBrokerURL parses endpoint, which, unlike urls parsed by url.Parse,
+// can contain more than one host separated by commas.
+func parseBrokerURL(endpoint string) (*brokerURL, error) {
+	i := strings.Index(endpoint, "://")
+	if i < 0 {
+		return nil, errors.New("no scheme provided")
+	}
+	u := &brokerURL{scheme: endpoint[:i]}
+	rest := endpoint[i+3:]
+
+	rawQuery := ""
+	if q := strings.Index(rest, "?"); q >= 0 {
+		rest, rawQuery = rest[:q], rest[q+1:]
+	}
+
+	query, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return nil, err
+	}
+	u.query = query
+
+	for _, host := range strings.Split(strings.TrimSuffix(rest, "/"), ",") {
+		if len(host) == 0 {
+			return nil, errors.New("no host provided")
+		}
+		if strings.Contains(host, "/") {
+			return nil, fmt.Errorf("invalid host: %s", host)
+		}
+		u.hosts = append(u.hosts, host)
+	}
+
+	return u, nil
+}
+
+// newBrokerHandler returns a handler that publishes events with pub on the
+// subject returned by the subject template.
+func newBrokerHandler(name, subject string, pub publisher, opts *HandlerOptions) (*brokerHandler, error) {
+	if len(subject) == 0 {
+		return nil, errors.New("no subject provided")
+	}
+
+	tmpl, err := template.New("subject").Option("missingkey=zero").Parse(subject)
+	if err != nil {
+		return nil, fmt.Errorf("invalid subject template: %w", err)
+	}
+
+	enc, err := newEventEncoder(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	headers := map[string]string{}
+	for key, val := range opts.Headers {
+		headers[key] = val
+	}
+
+	return &brokerHandler{
+		name:    name,
+		pub:     pub,
+		subject: tmpl,
+		headers: headers,
+		enc:     enc,
+	}, nil
+}
+
+// checkBrokerOptions returns an error if opts contain settings that can't
+// be used with message brokers.
+func checkBrokerOptions(opts *HandlerOptions) error {
+	if opts.Signing != nil {
+		return errors.New("signing is not supported with message brokers")
+	}
+
+	if opts.Auth != nil && len(opts.Auth.APIKey) > 0 {
+		return errors.New("api keys are not supported with message brokers")
+	}
+
+	return nil
+}
+
+// Send publishes the events and waits for the broker to acknowledge them.
+// If any of them is not acknowledged, an error is returned, so that the
+// events are published again later.
+func (b *brokerHandler) Send(ctx context.Context, events []openapi.Event) error {
+	batchID := BatchIDFromContext(ctx)
+	l := log.With().Str("func", "services.brokerHandler.Send").Str("sink", b.name).Str("batch-id", batchID).Logger()
+	now := time.Now().UTC()
+
+	msgs := make([]*brokerMessage, len(events))
+	for i, ev := range events {
+		msg, err := b.toMessage(ev, now)
+		if err != nil {
+			l.Err(err).Str("event-id", ev.Id).Msg("could not create message from event")
+			return err
+		}
+		otel.GetTextMapPropagator().Inject(ctx, mapCarrier(msg.headers))
+		msgs[i] = msg
+	}
+
+	l.Debug().Int("length", len(msgs)).Msg("publishing events....")
+	if err := b.pub.publish(ctx, msgs); err != nil {
+		l.Err(err).Msg("error while publishing events")
+		return err
+	}
+
+	l.Info().Msg("events acknowledged by the broker")
+	return nil
+}
+
+func (b *brokerHandler) toMessage(ev openapi.Event, now time.Time) (*brokerMessage, error) {
+	serv := ToServiceV2(ev.Service)
+	if serv.Metadata == nil {
+		serv.Metadata = map[string]string{}
+	}
+
+	var subject strings.Builder
+	if err := b.subject.Execute(&subject, &subjectData{
+		Event:     ev.Event,
+		ID:        serv.Id,
+		Name:      serv.Name,
+		Address:   serv.Address,
+		Port:      serv.Port,
+		Namespace: serv.Namespace,
+		Service:   serv.Service,
+		Source:    serv.Source,
+		Metadata:  serv.Metadata,
+	}); err != nil {
+		return nil, fmt.Errorf("could not execute subject template: %w", err)
+	}
+	if subject.Len() == 0 {
+		return nil, errors.New("subject template returned an empty subject")
+	}
+
+	body, err := b.enc.encode(ev, now)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+
+	headers := map[string]string{}
+	for key, val := range b.headers {
+		headers[key] = val
+	}
+	headers[EndpointIDHeader] = serv.Id
+	headers[EventTypeHeader] = ev.Event
+
+	return &brokerMessage{
+		subject: subject.String(),
+		key:     serv.Id,
+		headers: headers,
+		data:    data,
+	}, nil
+}
@@ -0,0 +1,252 @@
+// Copyright © 2021 Cisco
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// All rights reserved.
+
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"testing"
+
+	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/openapi"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakePublisher struct {
+	msgs []*brokerMessage
+	err  error
+}
+
+func (f *fakePublisher) publish(ctx context.Context, msgs []*brokerMessage) error {
+	if f.err != nil {
+		return f.err
+	}
+
+	f.msgs = append(f.msgs, msgs...)
+	return nil
+}
+
+func TestParseBrokerURL(t *testing.T) {
+	a := assert.New(t)
+	cases := []struct {
+		endpoint string
+		expRes   *brokerURL
+		expErr   error
+	}{
+		{
+			endpoint: "localhost:4222",
+			expErr:   errors.New("no scheme provided"),
+		},
+		{
+			endpoint: "nats://",
+			expErr:   errors.New("no host provided"),
+		},
+		{
+			endpoint: "nats://host-1:4222,",
+			expErr:   errors.New("no host provided"),
+		},
+		{
+			endpoint: "nats://host-1:4222/path",
+			expErr:   errors.New("invalid host: host-1:4222/path"),
+		},
+		{
+			endpoint: "nats://host-1:4222",
+			expRes:   &brokerURL{scheme: "nats", hosts: []string{"host-1:4222"}, query: url.Values{}},
+		},
+		{
+			endpoint: "kafka://host-1:9092,host-2:9092/?topic=cnwan-{{.Namespace}}",
+			expRes: &brokerURL{
+				scheme: "kafka",
+				hosts:  []string{"host-1:9092", "host-2:9092"},
+				query:  url.Values{"topic": []string{"cnwan-{{.Namespace}}"}},
+			},
+		},
+	}
+
+	failed := func(i int) {
+		a.FailNow("case failed", fmt.Sprintf("case %d", i))
+	}
+	for i, currCase := range cases {
+		res, err := parseBrokerURL(currCase.endpoint)
+		if !a.Equal(currCase.expRes, res) || !a.Equal(currCase.expErr, err) {
+			failed(i)
+		}
+	}
+}
+
+func TestBrokerHandler(t *testing.T) {
+	a := assert.New(t)
+	events := []openapi.Event{
+		{
+			Id:       "first-id",
+			Event:    "create",
+			Sequence: 1,
+			Service: openapi.Service{
+				Id:        "ns/serv/first",
+				Name:      "first",
+				Address:   "10.10.10.10",
+				Port:      8080,
+				Namespace: "ns",
+				Service:   "serv",
+				Source:    "etcd",
+				Metadata:  []openapi.Metadata{{Key: "env", Value: "prod"}},
+			},
+		},
+		{
+			Id:       "second-id",
+			Event:    "delete",
+			Sequence: 2,
+			Service: openapi.Service{
+				Id:        "ns/serv/second",
+				Name:      "second",
+				Namespace: "ns",
+				Service:   "serv",
+			},
+		},
+	}
+
+	cases := []struct {
+		subject    string
+		opts       *HandlerOptions
+		pubErr     error
+		expErr     error
+		expSubject []string
+	}{
+		{
+			subject: "",
+			opts:    &HandlerOptions{},
+			expErr:  errors.New("no subject provided"),
+		},
+		{
+			subject: "cnwan.{{.Namespace",
+			opts:    &HandlerOptions{},
+			expErr:  fmt.Errorf("invalid subject template: %w", errors.New("template: subject:1: unclosed action")),
+		},
+		{
+			subject: "cnwan",
+			opts:    &HandlerOptions{Format: "whatever"},
+			expErr:  errors.New("unsupported event format: whatever"),
+		},
+		{
+			subject:    "cnwan.{{.Namespace}}.{{.Service}}.{{.Event}}",
+			opts:       &HandlerOptions{APIVersion: APIVersionV1},
+			expSubject: []string{"cnwan.ns.serv.create", "cnwan.ns.serv.delete"},
+		},
+		{
+			subject:    "cnwan.{{.Metadata.env}}.{{.Name}}",
+			opts:       &HandlerOptions{APIVersion: APIVersionV2, Headers: map[string]string{"X-Tenant": "acme"}},
+			expSubject: []string{"cnwan.prod.first", "cnwan..second"},
+		},
+		{
+			subject: "{{.Metadata.env}}",
+			opts:    &HandlerOptions{APIVersion: APIVersionV1},
+			expErr:  errors.New("subject template returned an empty subject"),
+		},
+		{
+			subject: "cnwan",
+			opts:    &HandlerOptions{APIVersion: APIVersionV1},
+			pubErr:  errors.New("not acknowledged"),
+			expErr:  errors.New("not acknowledged"),
+		},
+	}
+
+	failed := func(i int) {
+		a.FailNow("case failed", fmt.Sprintf("case %d", i))
+	}
+	for i, currCase := range cases {
+		pub := &fakePublisher{err: currCase.pubErr}
+		h, err := newBrokerHandler("test", currCase.subject, pub, currCase.opts)
+		if err == nil {
+			err = h.Send(context.Background(), events)
+		}
+		if !a.Equal(currCase.expErr, err) {
+			failed(i)
+		}
+		if currCase.expErr != nil {
+			continue
+		}
+
+		if !a.Len(pub.msgs, len(events)) {
+			failed(i)
+		}
+		for j, msg := range pub.msgs {
+			a.Equal(currCase.expSubject[j], msg.subject)
+			a.Equal(events[j].Service.Id, msg.key)
+			a.Equal(events[j].Service.Id, msg.headers[EndpointIDHeader])
+			a.Equal(events[j].Event, msg.headers[EventTypeHeader])
+			for key, val := range currCase.opts.Headers {
+				a.Equal(val, msg.headers[key])
+			}
+
+			var expData []byte
+			if currCase.opts.APIVersion == APIVersionV2 {
+				expData, _ = json.Marshal(ToEventsV2(events[j : j+1])[0])
+			} else {
+				expData, _ = json.Marshal(events[j])
+			}
+			a.JSONEq(string(expData), string(msg.data))
+		}
+	}
+}
+
+func TestNewKafkaSink(t *testing.T) {
+	a := assert.New(t)
+	cases := []struct {
+		endpoint string
+		opts     *HandlerOptions
+		expErr   error
+	}{
+		{
+			endpoint: "kafka://localhost:9092",
+			opts:     &HandlerOptions{Signing: &SigningOptions{}},
+			expErr:   errors.New("signing is not supported with message brokers"),
+		},
+		{
+			endpoint: "kafka://localhost:9092",
+			opts:     &HandlerOptions{Auth: &AuthOptions{APIKey: "key"}},
+			expErr:   errors.New("api keys are not supported with message brokers"),
+		},
+		{
+			endpoint: "kafka://localhost:9092",
+			opts:     &HandlerOptions{Auth: &AuthOptions{BearerTokenFile: "token"}},
+			expErr:   errors.New("bearer tokens are not supported with kafka"),
+		},
+		{
+			endpoint: "kafka://localhost:9092?topic={{.Namespace",
+			opts:     &HandlerOptions{},
+			expErr:   fmt.Errorf("invalid subject template: %w", errors.New("template: subject:1: unclosed action")),
+		},
+		{
+			endpoint: "kafka://localhost:9092,localhost:9093",
+			opts:     &HandlerOptions{Auth: &AuthOptions{Username: "user", Password: "pass"}},
+		},
+	}
+
+	failed := func(i int) {
+		a.FailNow("case failed", fmt.Sprintf("case %d", i))
+	}
+	for i, currCase := range cases {
+		_, err := newKafkaSink(currCase.endpoint, currCase.opts)
+		if !a.Equal(currCase.expErr, err) {
+			failed(i)
+		}
+	}
+}
@@ -0,0 +1,304 @@
+// Copyright © 2021 Cisco
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// All rights reserved.
+
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/metrics"
+	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/openapi"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// FormatOpenAPI sends events as defined in the OpenAPI specification.
+	FormatOpenAPI string = "openapi"
+	// FormatCloudEventsStructured sends each event as a CloudEvent in
+	// structured content mode, one request per event.
+	FormatCloudEventsStructured string = "cloudevents-structured"
+	// FormatCloudEventsBatch sends all events as CloudEvents in batched
+	// content mode, in a single request.
+	FormatCloudEventsBatch string = "cloudevents-batch"
+	// FormatCloudEventsBinary sends each event as a CloudEvent in binary
+	// content mode, one request per event.
+	FormatCloudEventsBinary string = "cloudevents-binary"
+
+	cloudEventsSpecVersion   string = "1.0"
+	cloudEventsTypePrefix    string = "io.cnwan.service."
+	cloudEventsSyncType      string = "io.cnwan.services.synced"
+	cloudEventsDefaultSource string = "cnwan-reader"
+	cloudEventsContentType   string = "application/cloudevents+json"
+	cloudEventsBatchType     string = "application/cloudevents-batch+json"
+)
+
+// cloudEvent is an event formatted according to the CloudEvents 1.0
+// specification.
+type cloudEvent struct {
+	SpecVersion     string      `json:"specversion"`
+	Type            string      `json:"type"`
+	Source          string      `json:"source"`
+	ID              string      `json:"id"`
+	Time            string      `json:"time,omitempty"`
+	Subject         string      `json:"subject,omitempty"`
+	Sequence        string      `json:"sequence,omitempty"`
+	DataContentType string      `json:"datacontenttype,omitempty"`
+	Data            interface{} `json:"data,omitempty"`
+}
+
+type cloudEventsHandler struct {
+	auth       *authenticator
+	headers    map[string]string
+	client     *http.Client
+	url        string
+	mode       string
+	apiVersion string
+}
+
+func newCloudEventsHandler(endpoint, mode, apiVersion string) *cloudEventsHandler {
+	return &cloudEventsHandler{
+		client:     &http.Client{},
+		url:        adaptorURL(endpoint),
+		mode:       mode,
+		apiVersion: apiVersion,
+	}
+}
+
+// Send these events to an external handler.
+func (c *cloudEventsHandler) Send(ctx context.Context, events []openapi.Event) error {
+	batchID := BatchIDFromContext(ctx)
+	l := log.With().Str("func", "services.cloudEventsHandler.Send").Str("batch-id", batchID).Logger()
+	timeOut := time.Duration(20 * time.Second)
+	ctx, canc := context.WithTimeout(ctx, timeOut)
+	defer canc()
+
+	now := time.Now().UTC()
+	ces := make([]*cloudEvent, len(events))
+	for i, ev := range events {
+		ce, err := c.toCloudEvent(ev, now)
+		if err != nil {
+			return err
+		}
+		ces[i] = ce
+	}
+
+	l.Debug().Str("mode", c.mode).Msg("sending events....")
+	var err error
+	switch c.mode {
+	case FormatCloudEventsBatch:
+		err = c.sendStructured(ctx, ces, cloudEventsBatchType, batchID)
+	default:
+		for _, ce := range ces {
+			if c.mode == FormatCloudEventsBinary {
+				err = c.sendBinary(ctx, ce)
+			} else {
+				err = c.sendStructured(ctx, ce, cloudEventsContentType, ce.ID)
+			}
+
+			if err != nil {
+				break
+			}
+		}
+	}
+
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("%v seconds timeout expired", timeOut.Seconds())
+	}
+
+	return err
+}
+
+// Sync sends the full current state as a single CloudEvent, whose data is
+// the list of all services.
+func (c *cloudEventsHandler) Sync(ctx context.Context, servs []openapi.Service) error {
+	batchID := BatchIDFromContext(ctx)
+	l := log.With().Str("func", "services.cloudEventsHandler.Sync").Str("batch-id", batchID).Logger()
+	timeOut := time.Duration(20 * time.Second)
+	ctx, canc := context.WithTimeout(ctx, timeOut)
+	defer canc()
+
+	var data interface{} = servs
+	if c.apiVersion == APIVersionV2 {
+		data = toServicesV2(servs)
+	}
+
+	ce := &cloudEvent{
+		SpecVersion:     cloudEventsSpecVersion,
+		Type:            cloudEventsSyncType,
+		Source:          cloudEventsDefaultSource,
+		ID:              batchID,
+		Time:            time.Now().UTC().Format(time.RFC3339Nano),
+		DataContentType: "application/json",
+		Data:            data,
+	}
+
+	l.Debug().Str("mode", c.mode).Int("length", len(servs)).Msg("sending current state....")
+	var err error
+	if c.mode == FormatCloudEventsBinary {
+		err = c.sendBinary(ctx, ce)
+	} else {
+		err = c.sendStructured(ctx, ce, cloudEventsContentType, ce.ID)
+	}
+
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("%v seconds timeout expired", timeOut.Seconds())
+	}
+
+	return err
+}
+
+func (c *cloudEventsHandler) toCloudEvent(ev openapi.Event, now time.Time) (*cloudEvent, error) {
+	var data interface{} = ev.Service
+	if c.apiVersion == APIVersionV2 {
+		data = ToServiceV2(ev.Service)
+	}
+
+	source := ev.Service.Source
+	if len(source) == 0 {
+		source = cloudEventsDefaultSource
+	}
+
+	// Events that have no ID get a unique one: deriving it from the
+	// content would make receivers drop identical events that happen more
+	// than once, e.g. a service that is created, deleted and created again.
+	id := ev.Id
+	if len(id) == 0 {
+		id = uuid.New().String()
+	}
+
+	evTime := now
+	if !ev.Timestamp.IsZero() {
+		evTime = ev.Timestamp
+	}
+
+	var sequence string
+	if ev.Sequence > 0 {
+		sequence = strconv.FormatInt(ev.Sequence, 10)
+	}
+
+	return &cloudEvent{
+		SpecVersion:     cloudEventsSpecVersion,
+		Type:            cloudEventType(ev.Event),
+		Source:          source,
+		ID:              id,
+		Time:            evTime.Format(time.RFC3339Nano),
+		Subject:         ev.Service.Id,
+		Sequence:        sequence,
+		DataContentType: "application/json",
+		Data:            data,
+	}, nil
+}
+
+func (c *cloudEventsHandler) sendStructured(ctx context.Context, body interface{}, contentType, idempotencyKey string) error {
+	b, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	for key, val := range c.headers {
+		req.Header.Set(key, val)
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("Idempotency-Key", idempotencyKey)
+
+	return c.do(req)
+}
+
+func (c *cloudEventsHandler) sendBinary(ctx context.Context, ce *cloudEvent) error {
+	b, err := json.Marshal(ce.Data)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	for key, val := range c.headers {
+		req.Header.Set(key, val)
+	}
+	req.Header.Set("Content-Type", ce.DataContentType)
+	req.Header.Set("Idempotency-Key", ce.ID)
+	req.Header.Set("ce-specversion", ce.SpecVersion)
+	req.Header.Set("ce-type", ce.Type)
+	req.Header.Set("ce-source", ce.Source)
+	req.Header.Set("ce-id", ce.ID)
+	req.Header.Set("ce-time", ce.Time)
+	if len(ce.Subject) > 0 {
+		req.Header.Set("ce-subject", ce.Subject)
+	}
+	if len(ce.Sequence) > 0 {
+		req.Header.Set("ce-sequence", ce.Sequence)
+	}
+
+	return c.do(req)
+}
+
+func (c *cloudEventsHandler) do(req *http.Request) error {
+	l := log.With().Str("func", "services.cloudEventsHandler.do").Logger()
+
+	if err := c.auth.apply(req); err != nil {
+		l.Err(err).Msg("error while getting credentials")
+		return err
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		l.Err(err).Msg("error while getting response")
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, _ := ioutil.ReadAll(resp.Body)
+	metrics.AdaptorResponses.WithLabelValues(AdaptorNameFromContext(req.Context()), strconv.Itoa(resp.StatusCode)).Inc()
+	setResult(req.Context(), resp.StatusCode, nil)
+	l = l.With().Int("status-code", resp.StatusCode).Logger()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		err := fmt.Errorf("%s", resp.Status)
+		l.Error().Err(err).Str("response", string(body)).Msg("received response from the receiver")
+		return err
+	}
+
+	l.Info().Msg("received response from the receiver")
+	return nil
+}
+
+func cloudEventType(event string) string {
+	switch event {
+	case "create":
+		return cloudEventsTypePrefix + "created"
+	case "update":
+		return cloudEventsTypePrefix + "updated"
+	case "delete":
+		return cloudEventsTypePrefix + "deleted"
+	default:
+		return cloudEventsTypePrefix + event
+	}
+}
@@ -0,0 +1,218 @@
+// Copyright © 2021 Cisco
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// All rights reserved.
+
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/openapi"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCloudEventsSend(t *testing.T) {
+	a := assert.New(t)
+	events := []openapi.Event{
+		{
+			Event: "create",
+			Service: openapi.Service{
+				Id:       "ns/serv/endp",
+				Name:     "endp",
+				Address:  "10.10.10.10",
+				Port:     80,
+				Source:   "etcd",
+				Metadata: []openapi.Metadata{{Key: "key", Value: "val"}},
+			},
+		},
+		{
+			Event: "delete",
+			Service: openapi.Service{
+				Id:      "ns/serv/endp-1",
+				Name:    "endp-1",
+				Address: "10.10.10.11",
+				Port:    80,
+			},
+		},
+	}
+
+	type request struct {
+		header http.Header
+		body   string
+	}
+
+	cases := []struct {
+		format   string
+		expCheck func(reqs []request) bool
+	}{
+		{
+			format: FormatCloudEventsStructured,
+			expCheck: func(reqs []request) bool {
+				if !a.Len(reqs, 2) {
+					return false
+				}
+
+				ces := make([]cloudEvent, len(reqs))
+				for i, req := range reqs {
+					if !a.Equal(cloudEventsContentType, req.header.Get("Content-Type")) ||
+						!a.NoError(json.Unmarshal([]byte(req.body), &ces[i])) {
+						return false
+					}
+				}
+
+				return a.Equal("1.0", ces[0].SpecVersion) &&
+					a.Equal("io.cnwan.service.created", ces[0].Type) &&
+					a.Equal("etcd", ces[0].Source) &&
+					a.Equal("ns/serv/endp", ces[0].Subject) &&
+					a.NotEmpty(ces[0].ID) &&
+					a.NotEmpty(ces[0].Time) &&
+					a.Equal("io.cnwan.service.deleted", ces[1].Type) &&
+					a.Equal(cloudEventsDefaultSource, ces[1].Source) &&
+					a.NotEqual(ces[0].ID, ces[1].ID)
+			},
+		},
+		{
+			format: FormatCloudEventsBatch,
+			expCheck: func(reqs []request) bool {
+				if !a.Len(reqs, 1) || !a.Equal(cloudEventsBatchType, reqs[0].header.Get("Content-Type")) {
+					return false
+				}
+
+				ces := []cloudEvent{}
+				if !a.NoError(json.Unmarshal([]byte(reqs[0].body), &ces)) {
+					return false
+				}
+
+				return a.Len(ces, 2) &&
+					a.Equal("io.cnwan.service.created", ces[0].Type) &&
+					a.Equal("io.cnwan.service.deleted", ces[1].Type)
+			},
+		},
+		{
+			format: FormatCloudEventsBinary,
+			expCheck: func(reqs []request) bool {
+				if !a.Len(reqs, 2) {
+					return false
+				}
+
+				h := reqs[0].header
+				return a.Equal("application/json", h.Get("Content-Type")) &&
+					a.Equal("1.0", h.Get("ce-specversion")) &&
+					a.Equal("io.cnwan.service.created", h.Get("ce-type")) &&
+					a.Equal("etcd", h.Get("ce-source")) &&
+					a.Equal("ns/serv/endp", h.Get("ce-subject")) &&
+					a.NotEmpty(h.Get("ce-id")) &&
+					a.NotEmpty(h.Get("ce-time")) &&
+					a.JSONEq(`{"id":"ns/serv/endp","name":"endp","address":"10.10.10.10","port":80,"source":"etcd","metadata":[{"key":"key","value":"val"}]}`, reqs[0].body)
+			},
+		},
+	}
+
+	failed := func(i int) {
+		a.FailNow("case failed", fmt.Sprintf("case %d", i))
+	}
+	for i, currCase := range cases {
+		var lock sync.Mutex
+		reqs := []request{}
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			b, _ := ioutil.ReadAll(r.Body)
+			lock.Lock()
+			reqs = append(reqs, request{header: r.Header, body: string(b)})
+			lock.Unlock()
+			w.WriteHeader(http.StatusAccepted)
+		}))
+
+		h, err := NewHandler(strings.TrimPrefix(srv.URL, "http://"), &HandlerOptions{Format: currCase.format})
+		if !a.NoError(err) {
+			srv.Close()
+			failed(i)
+		}
+
+		err = h.Send(context.Background(), events)
+		srv.Close()
+		if !a.NoError(err) || !currCase.expCheck(reqs) {
+			failed(i)
+		}
+	}
+}
+
+func TestCloudEventsSendError(t *testing.T) {
+	a := assert.New(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer srv.Close()
+
+	h, _ := NewHandler(strings.TrimPrefix(srv.URL, "http://"), &HandlerOptions{Format: FormatCloudEventsBatch})
+	err := h.Send(context.Background(), []openapi.Event{{Event: "create"}})
+	a.Equal(fmt.Errorf("400 Bad Request"), err)
+}
+
+func TestCloudEventID(t *testing.T) {
+	a := assert.New(t)
+	c := newCloudEventsHandler("localhost", FormatCloudEventsStructured, APIVersionV1)
+	ev := openapi.Event{Event: "create", Service: openapi.Service{Id: "ns/serv/endp"}}
+
+	first, err := c.toCloudEvent(ev, time.Now())
+	a.NoError(err)
+	a.NotEmpty(first.ID)
+
+	// The same event happening again must not be deduplicated by receivers
+	second, err := c.toCloudEvent(ev, time.Now())
+	a.NoError(err)
+	a.NotEqual(first.ID, second.ID)
+
+	detected := time.Date(2021, 6, 10, 9, 30, 15, 0, time.UTC)
+	ev.Id, ev.Timestamp, ev.Sequence = "event-id", detected, 4
+	fourth, err := c.toCloudEvent(ev, time.Now())
+	a.NoError(err)
+	a.Equal("event-id", fourth.ID)
+	a.Equal(detected.Format(time.RFC3339Nano), fourth.Time)
+	a.Equal("4", fourth.Sequence)
+}
+
+func TestCloudEventsSync(t *testing.T) {
+	a := assert.New(t)
+	var header http.Header
+	var body []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header
+		body, _ = ioutil.ReadAll(r.Body)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer srv.Close()
+
+	h, _ := NewHandler(strings.TrimPrefix(srv.URL, "http://"), &HandlerOptions{Format: FormatCloudEventsStructured})
+	err := h.(Syncer).Sync(WithBatchID(context.Background(), "state-id"), []openapi.Service{{Id: "ns/serv/endp"}})
+	a.NoError(err)
+
+	ce := map[string]interface{}{}
+	a.NoError(json.Unmarshal(body, &ce))
+	a.Equal(cloudEventsContentType, header.Get("Content-Type"))
+	a.Equal("io.cnwan.services.synced", ce["type"])
+	a.Equal("state-id", ce["id"])
+	a.Equal([]interface{}{map[string]interface{}{"id": "ns/serv/endp", "name": "", "address": "", "port": float64(0)}}, ce["data"])
+}
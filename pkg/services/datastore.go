@@ -19,10 +19,14 @@
 package services
 
 import (
+	"context"
 	"reflect"
+	"sort"
 	"sync"
 
 	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/openapi"
+	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // Datastore holds services in their current state
@@ -30,7 +34,11 @@ type Datastore interface {
 	// GetEvents receives the current services and runs a difference between
 	// them and their previous state (the one already existing in memory).
 	// It returns the differences in form of events.
-	GetEvents(services map[string]*openapi.Service) map[string]*openapi.Event
+	// The difference is traced as a child of the span in ctx, if any.
+	GetEvents(ctx context.Context, services map[string]*openapi.Service) map[string]*openapi.Event
+	// Snapshot returns all the services currently stored, sorted by their
+	// keys.
+	Snapshot() []openapi.Service
 }
 
 type servicesDatastore struct {
@@ -48,7 +56,10 @@ func NewDatastore() Datastore {
 // GetEvents receives the current services and runs a difference between
 // them and their previous state (the one already existing in memory).
 // It returns the differences in form of events.
-func (m *servicesDatastore) GetEvents(currServices map[string]*openapi.Service) map[string]*openapi.Event {
+func (m *servicesDatastore) GetEvents(ctx context.Context, currServices map[string]*openapi.Service) map[string]*openapi.Event {
+	_, span := tracing.Tracer().Start(ctx, "datastore.GetEvents")
+	defer span.End()
+
 	m.lock.Lock()
 	defer m.lock.Unlock()
 
@@ -70,10 +81,30 @@ func (m *servicesDatastore) GetEvents(currServices map[string]*openapi.Service)
 			m.services[key] = &change.Service
 		}
 	}
+	span.SetAttributes(attribute.Int("cnwan.services", len(currServices)), attribute.Int("cnwan.events", len(changes)))
 
 	return changes
 }
 
+// Snapshot returns all the services currently stored, sorted by their keys.
+func (m *servicesDatastore) Snapshot() []openapi.Service {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	keys := make([]string, 0, len(m.services))
+	for key := range m.services {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	servs := make([]openapi.Service, len(keys))
+	for i, key := range keys {
+		servs[i] = *m.services[key]
+	}
+
+	return servs
+}
+
 func getChanges(storedState, currentState map[string]*openapi.Service) map[string]*openapi.Event {
 	changes := map[string]*openapi.Event{}
 
@@ -19,6 +19,7 @@
 package services
 
 import (
+	"context"
 	"testing"
 
 	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/openapi"
@@ -137,3 +138,24 @@ func TestGetChanges(t *testing.T) {
 	res = getChanges(stored, pulled)
 	Equal(t, expectedRes, res)
 }
+
+func TestSnapshot(t *testing.T) {
+	d := NewDatastore()
+	Empty(t, d.Snapshot())
+
+	d.GetEvents(context.Background(), map[string]*openapi.Service{
+		"second": {Name: "second-name", Address: "11.11.11.11", Port: 8080},
+		"first":  {Name: "first-name", Address: "10.10.10.10", Port: 80},
+	})
+	Equal(t, []openapi.Service{
+		{Name: "first-name", Address: "10.10.10.10", Port: 80},
+		{Name: "second-name", Address: "11.11.11.11", Port: 8080},
+	}, d.Snapshot())
+
+	d.GetEvents(context.Background(), map[string]*openapi.Service{
+		"second": {Name: "second-name", Address: "11.11.11.11", Port: 8080},
+	})
+	Equal(t, []openapi.Service{
+		{Name: "second-name", Address: "11.11.11.11", Port: 8080},
+	}, d.Snapshot())
+}
@@ -0,0 +1,86 @@
+// Copyright © 2021 Cisco
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// All rights reserved.
+
+package services
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+const (
+	// defaultFileMaxSize is the size in megabytes after which a file is
+	// rotated, if not set.
+	defaultFileMaxSize int = 100
+)
+
+// newFileSink returns a handler that writes events to a file, one JSON per
+// line, e.g. file:///var/log/cnwan.jsonl.
+// The file is rotated according to these query parameters:
+//   - maxSize: the size in megabytes after which the file is rotated
+//   - maxBackups: the number of rotated files to keep
+//   - maxAge: the number of days to keep rotated files for
+//   - compress: whether to compress rotated files with gzip
+func newFileSink(endpoint string, opts *HandlerOptions) (Handler, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	// Host is not empty with relative paths, e.g. file://./events.jsonl
+	filePath := u.Host + u.Path
+	if len(filePath) == 0 {
+		return nil, fmt.Errorf("no file path provided")
+	}
+
+	query := u.Query()
+	getInt := func(param string, defaultVal int) (int, error) {
+		val := query.Get(param)
+		if len(val) == 0 {
+			return defaultVal, nil
+		}
+
+		intVal, err := strconv.Atoi(val)
+		if err != nil || intVal < 0 {
+			return 0, fmt.Errorf("invalid %s: %s", param, val)
+		}
+
+		return intVal, nil
+	}
+
+	w := &lumberjack.Logger{Filename: filePath}
+	if w.MaxSize, err = getInt("maxSize", defaultFileMaxSize); err != nil {
+		return nil, err
+	}
+	if w.MaxBackups, err = getInt("maxBackups", 0); err != nil {
+		return nil, err
+	}
+	if w.MaxAge, err = getInt("maxAge", 0); err != nil {
+		return nil, err
+	}
+	if compress := query.Get("compress"); len(compress) > 0 {
+		if w.Compress, err = strconv.ParseBool(compress); err != nil {
+			return nil, fmt.Errorf("invalid compress: %s", compress)
+		}
+	}
+
+	return newJSONLinesHandler(w, opts)
+}
@@ -0,0 +1,247 @@
+// Copyright © 2021 Cisco
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// All rights reserved.
+
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/cnwanpb"
+	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/metrics"
+	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/openapi"
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+type grpcHandler struct {
+	auth    *authenticator
+	headers map[string]string
+	client  cnwanpb.EventsClient
+}
+
+// newGRPCSink returns a handler that sends events via gRPC, as defined in
+// api/proto, e.g. grpc://adaptor.example.com:9090.
+// The connection is secured with TLS only if TLS options are provided.
+func newGRPCSink(endpoint string, opts *HandlerOptions) (Handler, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(u.Host) == 0 {
+		return nil, errors.New("no host provided")
+	}
+
+	switch opts.Format {
+	case "", FormatOpenAPI:
+	default:
+		return nil, fmt.Errorf("unsupported event format for grpc: %s", opts.Format)
+	}
+
+	if opts.Signing != nil {
+		return nil, errors.New("signing is not supported with grpc")
+	}
+
+	creds := insecure.NewCredentials()
+	if opts.TLS != nil {
+		tlsConfig, err := newTLSConfig(opts.TLS)
+		if err != nil {
+			return nil, err
+		}
+		creds = credentials.NewTLS(tlsConfig)
+	}
+
+	auth, err := newAuthenticator(opts.Auth)
+	if err != nil {
+		return nil, err
+	}
+
+	headers := auth.staticHeaders()
+	for key, val := range opts.Headers {
+		headers[key] = val
+	}
+
+	// This doesn't wait for the connection to be established, which is
+	// done in background and retried when needed.
+	conn, err := grpc.Dial(u.Host, grpc.WithTransportCredentials(creds))
+	if err != nil {
+		return nil, err
+	}
+
+	return &grpcHandler{
+		auth:    auth,
+		headers: headers,
+		client:  cnwanpb.NewEventsClient(conn),
+	}, nil
+}
+
+// Send these events to an external handler.
+func (g *grpcHandler) Send(ctx context.Context, events []openapi.Event) error {
+	batchID := BatchIDFromContext(ctx)
+	l := log.With().Str("func", "services.grpcHandler.Send").Str("batch-id", batchID).Logger()
+	ctx, canc := context.WithTimeout(ctx, 20*time.Second)
+	defer canc()
+
+	ctx, err := g.outgoingContext(ctx)
+	if err != nil {
+		l.Err(err).Msg("error while getting credentials")
+		return err
+	}
+
+	req := &cnwanpb.SendEventsRequest{
+		BatchId: batchID,
+		Events:  make([]*cnwanpb.Event, len(events)),
+	}
+	for i, ev := range events {
+		req.Events[i] = toProtoEvent(ev)
+	}
+
+	l.Debug().Msg("sending events....")
+	resp, err := g.client.SendEvents(ctx, req)
+	if err != nil {
+		l.Err(err).Msg("error while sending events")
+		return err
+	}
+
+	// As with 207 responses, events that could not be processed are
+	// reported but they don't fail the whole batch.
+	var resErrors []openapi.ResourceResponse
+	for _, res := range resp.Results {
+		if res.Status >= 200 && res.Status < 300 {
+			continue
+		}
+
+		resErrors = append(resErrors, openapi.ResourceResponse{
+			Status:      res.Status,
+			Resource:    res.EventId,
+			Title:       res.Title,
+			Description: res.Description,
+		})
+		metrics.AdaptorResourceErrors.WithLabelValues(AdaptorNameFromContext(ctx), strconv.Itoa(int(res.Status))).Inc()
+		e := fmt.Errorf("Event '%s': %d %s  %s", res.EventId, res.Status, res.Title, res.Description)
+		l.Warn().AnErr("error", e).Msg("adaptor error occurred on event")
+	}
+
+	setResult(ctx, 0, resErrors)
+
+	l.Info().Msg("events processed by the adaptor")
+	return nil
+}
+
+// Sync sends the full current state to the adaptor.
+func (g *grpcHandler) Sync(ctx context.Context, servs []openapi.Service) error {
+	batchID := BatchIDFromContext(ctx)
+	l := log.With().Str("func", "services.grpcHandler.Sync").Str("batch-id", batchID).Logger()
+	ctx, canc := context.WithTimeout(ctx, 20*time.Second)
+	defer canc()
+
+	ctx, err := g.outgoingContext(ctx)
+	if err != nil {
+		l.Err(err).Msg("error while getting credentials")
+		return err
+	}
+
+	req := &cnwanpb.SyncServicesRequest{
+		BatchId:  batchID,
+		Services: make([]*cnwanpb.Service, len(servs)),
+	}
+	for i, serv := range servs {
+		req.Services[i] = toProtoService(serv)
+	}
+
+	l.Debug().Int("length", len(servs)).Msg("sending current state....")
+	if _, err := g.client.SyncServices(ctx, req); err != nil {
+		l.Err(err).Msg("error while sending current state")
+		return err
+	}
+
+	return nil
+}
+
+// outgoingContext returns a copy of ctx with the credentials and headers in
+// the gRPC metadata.
+func (g *grpcHandler) outgoingContext(ctx context.Context) (context.Context, error) {
+	// The authenticator sets credentials on http requests, so they are
+	// taken from there.
+	req := &http.Request{Header: http.Header{}}
+	if err := g.auth.apply(req); err != nil {
+		return nil, err
+	}
+
+	md := metadata.MD{}
+	for key, val := range g.headers {
+		md.Set(strings.ToLower(key), val)
+	}
+	for key, vals := range req.Header {
+		md.Set(strings.ToLower(key), vals...)
+	}
+	otel.GetTextMapPropagator().Inject(ctx, metadataCarrier(md))
+
+	return metadata.NewOutgoingContext(ctx, md), nil
+}
+
+func toProtoEvent(ev openapi.Event) *cnwanpb.Event {
+	protoEv := &cnwanpb.Event{
+		Id:       ev.Id,
+		Sequence: ev.Sequence,
+		Service:  toProtoService(ev.Service),
+	}
+
+	if !ev.Timestamp.IsZero() {
+		protoEv.Timestamp = timestamppb.New(ev.Timestamp)
+	}
+
+	switch ev.Event {
+	case "create":
+		protoEv.Type = cnwanpb.EventType_EVENT_TYPE_CREATE
+	case "update":
+		protoEv.Type = cnwanpb.EventType_EVENT_TYPE_UPDATE
+	case "delete":
+		protoEv.Type = cnwanpb.EventType_EVENT_TYPE_DELETE
+	}
+
+	return protoEv
+}
+
+func toProtoService(serv openapi.Service) *cnwanpb.Service {
+	// Same as version 2 of the API, metadata is a map
+	servV2 := ToServiceV2(serv)
+
+	return &cnwanpb.Service{
+		Id:        servV2.Id,
+		Name:      servV2.Name,
+		Address:   servV2.Address,
+		Port:      servV2.Port,
+		Metadata:  servV2.Metadata,
+		Namespace: servV2.Namespace,
+		Service:   servV2.Service,
+		Source:    servV2.Source,
+	}
+}
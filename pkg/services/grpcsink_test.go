@@ -0,0 +1,167 @@
+// Copyright © 2021 Cisco
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// All rights reserved.
+
+package services
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/cnwanpb"
+	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/openapi"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+type fakeEventsServer struct {
+	cnwanpb.UnimplementedEventsServer
+	events   *cnwanpb.SendEventsRequest
+	sync     *cnwanpb.SyncServicesRequest
+	md       metadata.MD
+	response *cnwanpb.SendEventsResponse
+}
+
+func (f *fakeEventsServer) SendEvents(ctx context.Context, req *cnwanpb.SendEventsRequest) (*cnwanpb.SendEventsResponse, error) {
+	f.events = req
+	f.md, _ = metadata.FromIncomingContext(ctx)
+	return f.response, nil
+}
+
+func (f *fakeEventsServer) SyncServices(ctx context.Context, req *cnwanpb.SyncServicesRequest) (*cnwanpb.SyncServicesResponse, error) {
+	f.sync = req
+	return &cnwanpb.SyncServicesResponse{}, nil
+}
+
+func TestNewGRPCSink(t *testing.T) {
+	a := assert.New(t)
+	cases := []struct {
+		endpoint string
+		opts     *HandlerOptions
+		expErr   error
+	}{
+		{
+			endpoint: "grpc:///no-host",
+			opts:     &HandlerOptions{},
+			expErr:   errors.New("no host provided"),
+		},
+		{
+			endpoint: "grpc://localhost:9090",
+			opts:     &HandlerOptions{Format: FormatCloudEventsStructured},
+			expErr:   errors.New("unsupported event format for grpc: " + FormatCloudEventsStructured),
+		},
+		{
+			endpoint: "grpc://localhost:9090",
+			opts:     &HandlerOptions{Signing: &SigningOptions{}},
+			expErr:   errors.New("signing is not supported with grpc"),
+		},
+		{
+			endpoint: "grpc://localhost:9090",
+			opts:     &HandlerOptions{Format: FormatOpenAPI},
+		},
+	}
+
+	failed := func(i int) {
+		a.FailNow("case failed", "case %d", i)
+	}
+	for i, currCase := range cases {
+		_, err := newGRPCSink(currCase.endpoint, currCase.opts)
+		if !a.Equal(currCase.expErr, err) {
+			failed(i)
+		}
+	}
+}
+
+func TestGRPCHandler(t *testing.T) {
+	a := assert.New(t)
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if !a.NoError(err) {
+		return
+	}
+
+	fake := &fakeEventsServer{
+		response: &cnwanpb.SendEventsResponse{
+			Results: []*cnwanpb.EventResult{
+				{EventId: "first-id", Status: 200},
+				{EventId: "second-id", Status: 422, Title: "Unprocessable Entity"},
+			},
+		},
+	}
+	srv := grpc.NewServer()
+	cnwanpb.RegisterEventsServer(srv, fake)
+	go srv.Serve(lis)
+	defer srv.Stop()
+
+	h, err := NewHandler("grpc://"+lis.Addr().String(), &HandlerOptions{
+		Auth:    &AuthOptions{Username: "user", Password: "pass"},
+		Headers: map[string]string{"X-Custom": "value"},
+	})
+	if !a.NoError(err) {
+		return
+	}
+
+	now := time.Now()
+	serv := openapi.Service{
+		Id:       "ns/serv/first",
+		Name:     "first",
+		Address:  "10.10.10.10",
+		Port:     8080,
+		Metadata: []openapi.Metadata{{Key: "key", Value: "val"}},
+	}
+	events := []openapi.Event{
+		{Id: "first-id", Event: "create", Sequence: 1, Timestamp: now, Service: serv},
+		{Id: "second-id", Event: "delete", Sequence: 2, Service: serv},
+	}
+	expServ := &cnwanpb.Service{
+		Id:       "ns/serv/first",
+		Name:     "first",
+		Address:  "10.10.10.10",
+		Port:     8080,
+		Metadata: map[string]string{"key": "val"},
+	}
+
+	ctx := WithBatchID(context.Background(), "batch")
+	a.NoError(h.Send(ctx, events))
+	a.True(proto.Equal(&cnwanpb.SendEventsRequest{
+		BatchId: "batch",
+		Events: []*cnwanpb.Event{
+			{Id: "first-id", Type: cnwanpb.EventType_EVENT_TYPE_CREATE, Sequence: 1, Timestamp: timestamppb.New(now), Service: expServ},
+			{Id: "second-id", Type: cnwanpb.EventType_EVENT_TYPE_DELETE, Sequence: 2, Service: expServ},
+		},
+	}, fake.events))
+	a.Equal([]string{"Basic dXNlcjpwYXNz"}, fake.md.Get("authorization"))
+	a.Equal([]string{"value"}, fake.md.Get("x-custom"))
+
+	syncer, ok := h.(Syncer)
+	if !a.True(ok) {
+		return
+	}
+	a.NoError(syncer.Sync(ctx, []openapi.Service{serv}))
+	a.True(proto.Equal(&cnwanpb.SyncServicesRequest{
+		BatchId:  "batch",
+		Services: []*cnwanpb.Service{expServ},
+	}, fake.sync))
+
+	srv.Stop()
+	a.Error(h.Send(ctx, events))
+}
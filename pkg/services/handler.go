@@ -23,10 +23,14 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/metrics"
 	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/openapi"
+	"github.com/google/uuid"
 	"github.com/rs/zerolog/log"
 )
 
@@ -34,47 +38,268 @@ import (
 // specified by CN-WAN Reader OpenAPI's specification.
 type Handler interface {
 	// Send these events to an external handler.
-	Send(services []openapi.Event) error
+	// The ID of the batch, if any, is taken from ctx: look at WithBatchID.
+	Send(ctx context.Context, events []openapi.Event) error
+}
+
+// Syncer is implemented by handlers that can send the full current state
+// to the adaptor, so that it can reconcile its own state with it.
+type Syncer interface {
+	// Sync sends all the services that currently exist.
+	// The ID of the state, if any, is taken from ctx: look at WithBatchID.
+	Sync(ctx context.Context, services []openapi.Service) error
+}
+
+type batchIDKey struct{}
+
+// WithBatchID returns a copy of ctx that carries the ID of the batch of
+// events to send. Handlers send it to the adaptor so that it can recognize
+// a batch that is sent more than once.
+func WithBatchID(ctx context.Context, batchID string) context.Context {
+	return context.WithValue(ctx, batchIDKey{}, batchID)
+}
+
+// BatchIDFromContext returns the ID of the batch carried by ctx.
+// If ctx doesn't carry any, a new one is returned.
+func BatchIDFromContext(ctx context.Context) string {
+	if batchID, ok := ctx.Value(batchIDKey{}).(string); ok && len(batchID) > 0 {
+		return batchID
+	}
+
+	return uuid.New().String()
+}
+
+type adaptorNameKey struct{}
+
+// WithAdaptorName returns a copy of ctx that carries the name of the adaptor
+// that data is sent to, so that handlers can use it in metrics.
+func WithAdaptorName(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, adaptorNameKey{}, name)
+}
+
+// AdaptorNameFromContext returns the name of the adaptor carried by ctx, or
+// an empty string if ctx doesn't carry any.
+func AdaptorNameFromContext(ctx context.Context) string {
+	name, _ := ctx.Value(adaptorNameKey{}).(string)
+	return name
+}
+
+// Result contains what the adaptor replied to a request.
+type Result struct {
+	// StatusCode of the HTTP response. It is 0 if no response was received
+	// or if the adaptor is not reached over HTTP, e.g. with gRPC
+	StatusCode int
+	// Errors occurred on single resources, e.g. with a 207 response
+	Errors []openapi.ResourceResponse
+}
+
+type resultKey struct{}
+
+// WithResult returns a copy of ctx where handlers store what the adaptor
+// replied to the request in result, so that the caller can inspect it.
+func WithResult(ctx context.Context, result *Result) context.Context {
+	return context.WithValue(ctx, resultKey{}, result)
+}
+
+// setResult stores the reply of the adaptor in the result carried by ctx,
+// if any.
+func setResult(ctx context.Context, statusCode int, errors []openapi.ResourceResponse) {
+	if result, ok := ctx.Value(resultKey{}).(*Result); ok && result != nil {
+		result.StatusCode = statusCode
+		result.Errors = errors
+	}
+}
+
+const (
+	// APIVersionV1 is the version of the API where events are sent to
+	// /events and metadata is a list of key-value objects.
+	APIVersionV1 string = "v1"
+	// APIVersionV2 is the version of the API where events are sent to
+	// /v2/events and metadata is a map.
+	APIVersionV2 string = "v2"
+)
+
+// HandlerOptions contains options about how the handler should send events.
+type HandlerOptions struct {
+	// APIVersion is the version of the API implemented by the adaptor.
+	// If empty, APIVersionV1 is used.
+	APIVersion string
+	// Format is the format of the events sent to the adaptor, i.e.
+	// FormatOpenAPI or one of the CloudEvents formats.
+	// If empty, FormatOpenAPI is used.
+	Format string
+	// Auth contains the credentials to authenticate to the adaptor with.
+	Auth *AuthOptions
+	// Headers to include in every request.
+	Headers map[string]string
+	// TLS contains settings about how to connect to https:// endpoints.
+	TLS *TLSOptions
+	// Signing contains the secrets to sign requests with, if any.
+	Signing *SigningOptions
 }
 
 type servicesHandler struct {
-	mainCtx context.Context
-	client  *openapi.APIClient
+	auth       *authenticator
+	client     *openapi.APIClient
+	apiVersion string
 }
 
-// NewHandler returns a services handler that uses the endpoints defined in
-// the openAPI specification to send service events.
-func NewHandler(ctx context.Context, endpoint string) (Handler, error) {
+// NewHandler returns a services handler that sends service events to the
+// sink at endpoint. The sink is chosen by the scheme of endpoint, e.g.
+// stdout:// or file:///path/to/file.jsonl: look at RegisterSink.
+// If endpoint has no scheme, events are sent over http to the endpoints
+// defined in the openAPI specification.
+func NewHandler(endpoint string, opts *HandlerOptions) (Handler, error) {
 	if len(endpoint) == 0 {
 		return nil, errors.New("endpoint is empty")
 	}
 
+	_opts := HandlerOptions{}
+	if opts != nil {
+		_opts = *opts
+	}
+
+	switch _opts.APIVersion {
+	case "":
+		_opts.APIVersion = APIVersionV1
+	case APIVersionV1, APIVersionV2:
+	default:
+		return nil, fmt.Errorf("unsupported api version: %s", _opts.APIVersion)
+	}
+
+	scheme := "http"
+	if i := strings.Index(endpoint, "://"); i >= 0 {
+		scheme = endpoint[:i]
+	}
+
+	factory, exists := getSink(scheme)
+	if !exists {
+		return nil, fmt.Errorf("unsupported sink: %s", scheme)
+	}
+
+	return factory(endpoint, &_opts)
+}
+
+// newHTTPHandler returns a handler that sends events to endpoint via http,
+// using the provided client. If client is nil, one is created from the TLS
+// options.
+func newHTTPHandler(endpoint string, opts *HandlerOptions, httpClient *http.Client) (Handler, error) {
+	auth, err := newAuthenticator(opts.Auth)
+	if err != nil {
+		return nil, err
+	}
+
+	if httpClient == nil {
+		httpClient, err = newHTTPClient(opts.TLS)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if opts.Signing != nil {
+		httpClient, err = newSigningClient(httpClient, opts.Signing)
+		if err != nil {
+			return nil, err
+		}
+	}
+	httpClient = newTracingClient(httpClient)
+
+	headers := auth.staticHeaders()
+	for key, val := range opts.Headers {
+		headers[key] = val
+	}
+
+	switch opts.Format {
+	case "", FormatOpenAPI:
+	case FormatCloudEventsStructured, FormatCloudEventsBatch, FormatCloudEventsBinary:
+		ceHandler := newCloudEventsHandler(endpoint, opts.Format, opts.APIVersion)
+		ceHandler.auth, ceHandler.headers, ceHandler.client = auth, headers, httpClient
+		return ceHandler, nil
+	default:
+		return nil, fmt.Errorf("unsupported event format: %s", opts.Format)
+	}
+
 	// Get the client
 	cfg := openapi.NewConfiguration()
-	apiClient := openapi.NewAPIClient(cfg)
-	if endpoint != "localhost/cnwan" {
-		apiClient.ChangeBasePath(strings.Replace(cfg.BasePath, "localhost/cnwan", endpoint, 1))
+	cfg.HTTPClient = httpClient
+	for key, val := range headers {
+		cfg.AddDefaultHeader(key, val)
 	}
+	apiClient := openapi.NewAPIClient(cfg)
+	apiClient.ChangeBasePath(adaptorURL(endpoint))
 
 	return &servicesHandler{
-		client:  apiClient,
-		mainCtx: ctx,
+		client:     apiClient,
+		apiVersion: opts.APIVersion,
+		auth:       auth,
 	}, nil
 }
 
 // Send these events to an external handler.
-func (s *servicesHandler) Send(events []openapi.Event) error {
-	l := log.With().Str("func", "services.servicesHandler.Send").Logger()
+func (s *servicesHandler) Send(ctx context.Context, events []openapi.Event) error {
+	batchID := BatchIDFromContext(ctx)
+	l := log.With().Str("func", "services.servicesHandler.Send").Str("batch-id", batchID).Logger()
 	timeOut := time.Duration(20 * time.Second)
-	ctx, canc := context.WithTimeout(s.mainCtx, timeOut)
+	ctx, canc := context.WithTimeout(ctx, timeOut)
 	defer canc()
 
+	ctx, err := s.auth.withContext(ctx)
+	if err != nil {
+		l.Err(err).Msg("error while getting credentials")
+		return err
+	}
+
 	l.Debug().Msg("sending events....")
-	resp, httpResp, err := s.client.EventsApi.SendEvents(ctx, events)
+	var (
+		resp     openapi.Response
+		httpResp *http.Response
+	)
+	if s.apiVersion == APIVersionV2 {
+		resp, httpResp, err = s.client.EventsApi.SendEventsV2(ctx, batchID, ToEventsV2(events))
+	} else {
+		resp, httpResp, err = s.client.EventsApi.SendEvents(ctx, batchID, events)
+	}
 	if ctx.Err() == context.DeadlineExceeded {
 		return fmt.Errorf("%v seconds timeout expired", timeOut.Seconds())
 	}
 
+	return s.handleResponse(ctx, resp, httpResp, err)
+}
+
+// Sync sends the full current state to the adaptor.
+func (s *servicesHandler) Sync(ctx context.Context, servs []openapi.Service) error {
+	batchID := BatchIDFromContext(ctx)
+	l := log.With().Str("func", "services.servicesHandler.Sync").Str("batch-id", batchID).Logger()
+	timeOut := time.Duration(20 * time.Second)
+	ctx, canc := context.WithTimeout(ctx, timeOut)
+	defer canc()
+
+	ctx, err := s.auth.withContext(ctx)
+	if err != nil {
+		l.Err(err).Msg("error while getting credentials")
+		return err
+	}
+
+	l.Debug().Int("length", len(servs)).Msg("sending current state....")
+	var (
+		resp     openapi.Response
+		httpResp *http.Response
+	)
+	if s.apiVersion == APIVersionV2 {
+		resp, httpResp, err = s.client.EventsApi.SyncServicesV2(ctx, batchID, toServicesV2(servs))
+	} else {
+		resp, httpResp, err = s.client.EventsApi.SyncServices(ctx, batchID, servs)
+	}
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("%v seconds timeout expired", timeOut.Seconds())
+	}
+
+	return s.handleResponse(ctx, resp, httpResp, err)
+}
+
+func (s *servicesHandler) handleResponse(ctx context.Context, resp openapi.Response, httpResp *http.Response, err error) error {
+	l := log.With().Str("func", "services.servicesHandler.handleResponse").Logger()
+
 	if httpResp == nil {
 		if err != nil {
 			l.Err(err).Msg("error while getting response")
@@ -101,12 +326,15 @@ func (s *servicesHandler) Send(events []openapi.Event) error {
 		}
 	}
 
-	s.logResponseError(resp, httpResp.StatusCode)
+	adaptor := AdaptorNameFromContext(ctx)
+	metrics.AdaptorResponses.WithLabelValues(adaptor, strconv.Itoa(httpResp.StatusCode)).Inc()
+	setResult(ctx, httpResp.StatusCode, resp.Errors)
+	s.logResponseError(adaptor, resp, httpResp.StatusCode)
 
 	return err
 }
 
-func (s *servicesHandler) logResponseError(resp openapi.Response, statusCode int) {
+func (s *servicesHandler) logResponseError(adaptor string, resp openapi.Response, statusCode int) {
 	l := log.With().Str("func", "services.servicesHandler.logResponseError").Logger()
 
 	responseMsg := "<>"
@@ -127,6 +355,7 @@ func (s *servicesHandler) logResponseError(resp openapi.Response, statusCode int
 
 		// Log the errors in the response
 		for _, evErr := range resp.Errors {
+			metrics.AdaptorResourceErrors.WithLabelValues(adaptor, strconv.Itoa(int(evErr.Status))).Inc()
 			e := fmt.Errorf("Resource '%s': %d %s  %s", evErr.Resource, evErr.Status, evErr.Title, evErr.Description)
 			l.Warn().AnErr("error", e).Msg("adaptor error occurred on resource")
 		}
@@ -143,3 +372,54 @@ func (s *servicesHandler) logResponseError(resp openapi.Response, statusCode int
 		l.Error().AnErr("error", fmt.Errorf(responseMsg)).Msg("received response from the adaptor")
 	}
 }
+
+// toServicesV2 converts services to the format defined by version 2 of the
+// API, where metadata is a map rather than a list.
+func toServicesV2(servs []openapi.Service) []openapi.ServiceV2 {
+	servsV2 := make([]openapi.ServiceV2, len(servs))
+	for i, serv := range servs {
+		servsV2[i] = ToServiceV2(serv)
+	}
+
+	return servsV2
+}
+
+// ToEventsV2 converts events to the format defined by version 2 of the API,
+// where metadata is a map rather than a list.
+func ToEventsV2(events []openapi.Event) []openapi.EventV2 {
+	eventsV2 := make([]openapi.EventV2, len(events))
+	for i, ev := range events {
+		eventsV2[i] = openapi.EventV2{
+			Id:        ev.Id,
+			Timestamp: ev.Timestamp,
+			Sequence:  ev.Sequence,
+			Event:     ev.Event,
+			Service:   ToServiceV2(ev.Service),
+		}
+	}
+
+	return eventsV2
+}
+
+// ToServiceV2 converts a service to the format defined by version 2 of the
+// API. In case the same key appears more than once, the last value wins.
+func ToServiceV2(serv openapi.Service) openapi.ServiceV2 {
+	var metadata map[string]string
+	if len(serv.Metadata) > 0 {
+		metadata = make(map[string]string, len(serv.Metadata))
+		for _, m := range serv.Metadata {
+			metadata[m.Key] = m.Value
+		}
+	}
+
+	return openapi.ServiceV2{
+		Id:        serv.Id,
+		Name:      serv.Name,
+		Address:   serv.Address,
+		Port:      serv.Port,
+		Namespace: serv.Namespace,
+		Service:   serv.Service,
+		Source:    serv.Source,
+		Metadata:  metadata,
+	}
+}
@@ -0,0 +1,287 @@
+// Copyright © 2021 Cisco
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// All rights reserved.
+
+package services
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/metrics"
+	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/openapi"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewHandler(t *testing.T) {
+	a := assert.New(t)
+
+	cases := []struct {
+		endpoint string
+		opts     *HandlerOptions
+		expVer   string
+		expErr   error
+	}{
+		{
+			expErr: fmt.Errorf("endpoint is empty"),
+		},
+		{
+			endpoint: "localhost/cnwan",
+			expVer:   APIVersionV1,
+		},
+		{
+			endpoint: "localhost/cnwan",
+			opts:     &HandlerOptions{APIVersion: APIVersionV2},
+			expVer:   APIVersionV2,
+		},
+		{
+			endpoint: "localhost/cnwan",
+			opts:     &HandlerOptions{APIVersion: "v3"},
+			expErr:   fmt.Errorf("unsupported api version: v3"),
+		},
+		{
+			endpoint: "localhost/cnwan",
+			opts:     &HandlerOptions{Format: "xml"},
+			expErr:   fmt.Errorf("unsupported event format: xml"),
+		},
+	}
+
+	failed := func(i int) {
+		a.FailNow("case failed", fmt.Sprintf("case %d", i))
+	}
+	for i, currCase := range cases {
+		res, err := NewHandler(currCase.endpoint, currCase.opts)
+		if !a.Equal(currCase.expErr, err) {
+			failed(i)
+		}
+
+		if currCase.expErr == nil && !a.Equal(currCase.expVer, res.(*servicesHandler).apiVersion) {
+			failed(i)
+		}
+	}
+}
+
+func TestSend(t *testing.T) {
+	a := assert.New(t)
+	events := []openapi.Event{
+		{
+			Id:        "event-id",
+			Timestamp: time.Date(2021, 6, 10, 9, 30, 15, 0, time.UTC),
+			Sequence:  3,
+			Event:     "create",
+			Service: openapi.Service{
+				Id:       "ns/serv/endp",
+				Name:     "endp",
+				Address:  "10.10.10.10",
+				Port:     80,
+				Metadata: []openapi.Metadata{{Key: "key", Value: "val"}},
+			},
+		},
+	}
+
+	cases := []struct {
+		apiVersion string
+		expPath    string
+		expBody    string
+	}{
+		{
+			apiVersion: APIVersionV1,
+			expPath:    "/cnwan/events",
+			expBody:    `[{"id":"event-id","timestamp":"2021-06-10T09:30:15Z","sequence":3,"event":"create","service":{"id":"ns/serv/endp","name":"endp","address":"10.10.10.10","port":80,"metadata":[{"key":"key","value":"val"}]}}]`,
+		},
+		{
+			apiVersion: APIVersionV2,
+			expPath:    "/cnwan/v2/events",
+			expBody:    `[{"id":"event-id","timestamp":"2021-06-10T09:30:15Z","sequence":3,"event":"create","service":{"id":"ns/serv/endp","name":"endp","address":"10.10.10.10","port":80,"metadata":{"key":"val"}}}]`,
+		},
+	}
+
+	failed := func(i int) {
+		a.FailNow("case failed", fmt.Sprintf("case %d", i))
+	}
+	for i, currCase := range cases {
+		var path, body, key string
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			b, _ := ioutil.ReadAll(r.Body)
+			path, body = r.URL.Path, strings.TrimSpace(string(b))
+			key = r.Header.Get("Idempotency-Key")
+			w.WriteHeader(http.StatusNoContent)
+		}))
+
+		h, err := NewHandler(strings.TrimPrefix(srv.URL, "http://")+"/cnwan", &HandlerOptions{APIVersion: currCase.apiVersion})
+		if !a.NoError(err) {
+			srv.Close()
+			failed(i)
+		}
+
+		err = h.Send(WithBatchID(context.Background(), "batch-id"), events)
+		srv.Close()
+		if !a.NoError(err) || !a.Equal(currCase.expPath, path) || !a.JSONEq(currCase.expBody, body) || !a.Equal("batch-id", key) {
+			failed(i)
+		}
+	}
+}
+
+func TestToEventsV2(t *testing.T) {
+	a := assert.New(t)
+
+	res := ToEventsV2([]openapi.Event{
+		{
+			Event: "update",
+			Service: openapi.Service{
+				Name: "endp",
+				Metadata: []openapi.Metadata{
+					{Key: "key", Value: "first"},
+					{Key: "other", Value: "val"},
+					{Key: "key", Value: "second"},
+				},
+			},
+		},
+		{
+			Event:   "delete",
+			Service: openapi.Service{Name: "no-metadata"},
+		},
+	})
+
+	a.Equal([]openapi.EventV2{
+		{
+			Event: "update",
+			Service: openapi.ServiceV2{
+				Name:     "endp",
+				Metadata: map[string]string{"key": "second", "other": "val"},
+			},
+		},
+		{
+			Event:   "delete",
+			Service: openapi.ServiceV2{Name: "no-metadata"},
+		},
+	}, res)
+}
+
+func TestHandlerSync(t *testing.T) {
+	a := assert.New(t)
+	servs := []openapi.Service{
+		{
+			Id:       "ns/serv/endp",
+			Name:     "endp",
+			Address:  "10.10.10.10",
+			Port:     80,
+			Metadata: []openapi.Metadata{{Key: "key", Value: "val"}},
+		},
+	}
+
+	cases := []struct {
+		apiVersion string
+		expPath    string
+		expBody    string
+	}{
+		{
+			apiVersion: APIVersionV1,
+			expPath:    "/cnwan/services",
+			expBody:    `[{"id":"ns/serv/endp","name":"endp","address":"10.10.10.10","port":80,"metadata":[{"key":"key","value":"val"}]}]`,
+		},
+		{
+			apiVersion: APIVersionV2,
+			expPath:    "/cnwan/v2/services",
+			expBody:    `[{"id":"ns/serv/endp","name":"endp","address":"10.10.10.10","port":80,"metadata":{"key":"val"}}]`,
+		},
+	}
+
+	failed := func(i int) {
+		a.FailNow("case failed", fmt.Sprintf("case %d", i))
+	}
+	for i, currCase := range cases {
+		var method, path, body, key string
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			b, _ := ioutil.ReadAll(r.Body)
+			method, path, body = r.Method, r.URL.Path, strings.TrimSpace(string(b))
+			key = r.Header.Get("Idempotency-Key")
+			w.WriteHeader(http.StatusNoContent)
+		}))
+
+		h, err := NewHandler(strings.TrimPrefix(srv.URL, "http://")+"/cnwan", &HandlerOptions{APIVersion: currCase.apiVersion})
+		if !a.NoError(err) {
+			srv.Close()
+			failed(i)
+		}
+
+		err = h.(Syncer).Sync(WithBatchID(context.Background(), "state-id"), servs)
+		srv.Close()
+		if !a.NoError(err) || !a.Equal(http.MethodPut, method) || !a.Equal(currCase.expPath, path) ||
+			!a.JSONEq(currCase.expBody, body) || !a.Equal("state-id", key) {
+			failed(i)
+		}
+	}
+}
+
+func TestSendMetrics(t *testing.T) {
+	a := assert.New(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusMultiStatus)
+		w.Write([]byte(`{"status":207,"title":"MULTI-STATUS","description":"Some events could not be processed.","errors":[{"resource":"ns/serv/endp","status":422,"title":"UNPROCESSABLE ENTITY","description":"Invalid address."}]}`))
+	}))
+	defer srv.Close()
+
+	responses := testutil.ToFloat64(metrics.AdaptorResponses.WithLabelValues("metrics-test", "207"))
+	resourceErrors := testutil.ToFloat64(metrics.AdaptorResourceErrors.WithLabelValues("metrics-test", "422"))
+
+	h, err := NewHandler(strings.TrimPrefix(srv.URL, "http://")+"/cnwan", nil)
+	if !a.NoError(err) {
+		return
+	}
+
+	err = h.Send(WithAdaptorName(context.Background(), "metrics-test"), []openapi.Event{{Event: "create"}})
+	a.NoError(err)
+	a.Equal(responses+1, testutil.ToFloat64(metrics.AdaptorResponses.WithLabelValues("metrics-test", "207")))
+	a.Equal(resourceErrors+1, testutil.ToFloat64(metrics.AdaptorResourceErrors.WithLabelValues("metrics-test", "422")))
+}
+
+func TestSendResult(t *testing.T) {
+	a := assert.New(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusMultiStatus)
+		w.Write([]byte(`{"status":207,"title":"MULTI-STATUS","description":"Some events could not be processed.","errors":[{"resource":"ns/serv/endp","status":422,"title":"UNPROCESSABLE ENTITY","description":"Invalid address."}]}`))
+	}))
+	defer srv.Close()
+
+	h, err := NewHandler(strings.TrimPrefix(srv.URL, "http://")+"/cnwan", nil)
+	if !a.NoError(err) {
+		return
+	}
+
+	result := &Result{}
+	err = h.Send(WithResult(context.Background(), result), []openapi.Event{{Event: "create"}})
+	a.NoError(err)
+	a.Equal(&Result{
+		StatusCode: http.StatusMultiStatus,
+		Errors: []openapi.ResourceResponse{
+			{Resource: "ns/serv/endp", Status: 422, Title: "UNPROCESSABLE ENTITY", Description: "Invalid address."},
+		},
+	}, result)
+
+	// Handlers don't need a result to be there
+	a.NoError(h.Send(context.Background(), []openapi.Event{{Event: "create"}}))
+}
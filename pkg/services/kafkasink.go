@@ -0,0 +1,125 @@
+// Copyright © 2021 Cisco
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// All rights reserved.
+
+package services
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/sasl/plain"
+)
+
+const (
+	defaultKafkaTopic string = "cnwan-events"
+)
+
+// kafkaPublisher publishes messages to Kafka.
+type kafkaPublisher struct {
+	writer *kafka.Writer
+}
+
+// newKafkaSink returns a handler that publishes events to Kafka, e.g.
+// kafka://broker-1:9092,broker-2:9092?topic=cnwan-{{.Namespace}}.
+//
+// The topic query parameter is the template of the topic, "cnwan-events"
+// by default. Messages are keyed by the ID of the endpoint, so that all
+// events about the same endpoint end up in the same partition, and they are
+// considered delivered only when acknowledged by all in-sync replicas.
+func newKafkaSink(endpoint string, opts *HandlerOptions) (Handler, error) {
+	u, err := parseBrokerURL(endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkBrokerOptions(opts); err != nil {
+		return nil, err
+	}
+
+	topic := defaultKafkaTopic
+	if u.query.Get("topic") != "" {
+		topic = u.query.Get("topic")
+	}
+
+	transport := &kafka.Transport{ClientID: "cnwan-reader"}
+	if opts.TLS != nil {
+		if transport.TLS, err = newTLSConfig(opts.TLS); err != nil {
+			return nil, err
+		}
+	}
+
+	if opts.Auth != nil {
+		if len(opts.Auth.BearerTokenFile) > 0 {
+			return nil, errors.New("bearer tokens are not supported with kafka")
+		}
+
+		if _, err := newAuthenticator(opts.Auth); err != nil {
+			return nil, err
+		}
+
+		if len(opts.Auth.Username) > 0 {
+			transport.SASL = plain.Mechanism{
+				Username: opts.Auth.Username,
+				Password: opts.Auth.Password,
+			}
+		}
+	}
+
+	pub := &kafkaPublisher{
+		writer: &kafka.Writer{
+			Addr:     kafka.TCP(u.hosts...),
+			Balancer: &kafka.Hash{},
+			// Events are already batched by the queue, so there is no
+			// need to wait for more messages.
+			BatchTimeout: 10 * time.Millisecond,
+			RequiredAcks: kafka.RequireAll,
+			Transport:    transport,
+		},
+	}
+
+	return newBrokerHandler(endpoint, topic, pub, opts)
+}
+
+func (k *kafkaPublisher) publish(ctx context.Context, msgs []*brokerMessage) error {
+	ctx, canc := context.WithTimeout(ctx, 20*time.Second)
+	defer canc()
+
+	// The writer is synchronous, so this returns only after the messages
+	// have been acknowledged, or when they could not be delivered.
+	return k.writer.WriteMessages(ctx, toKafkaMessages(msgs)...)
+}
+
+// toKafkaMessages returns the messages as they are written to Kafka.
+func toKafkaMessages(msgs []*brokerMessage) []kafka.Message {
+	kafkaMsgs := make([]kafka.Message, len(msgs))
+	for i, msg := range msgs {
+		kafkaMsgs[i] = kafka.Message{
+			Topic: msg.subject,
+			Key:   []byte(msg.key),
+			Value: msg.data,
+		}
+
+		for key, val := range msg.headers {
+			kafkaMsgs[i].Headers = append(kafkaMsgs[i].Headers, kafka.Header{Key: key, Value: []byte(val)})
+		}
+	}
+
+	return kafkaMsgs
+}
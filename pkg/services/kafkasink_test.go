@@ -0,0 +1,81 @@
+// Copyright © 2021 Cisco
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// All rights reserved.
+
+package services
+
+import (
+	"context"
+	"testing"
+
+	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/openapi"
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKafkaMessages(t *testing.T) {
+	a := assert.New(t)
+	events := []openapi.Event{
+		{
+			Id:      "first-id",
+			Event:   "create",
+			Service: openapi.Service{Id: "ns/serv/first", Name: "first", Namespace: "ns", Service: "serv"},
+		},
+		{
+			Id:      "second-id",
+			Event:   "delete",
+			Service: openapi.Service{Id: "other/serv/second", Name: "second", Namespace: "other", Service: "serv"},
+		},
+	}
+
+	h, err := newKafkaSink("kafka://localhost:9092,localhost:9093?topic=cnwan.{{.Namespace}}", &HandlerOptions{
+		APIVersion: APIVersionV1,
+		Headers:    map[string]string{"X-Tenant": "acme"},
+	})
+	if !a.NoError(err) {
+		return
+	}
+
+	// The writer spreads messages across partitions by their key, and
+	// waits for all in-sync replicas
+	handler := h.(*brokerHandler)
+	writer := handler.pub.(*kafkaPublisher).writer
+	a.Equal("localhost:9092,localhost:9093", writer.Addr.String())
+	a.IsType(&kafka.Hash{}, writer.Balancer)
+	a.Equal(kafka.RequireAll, writer.RequiredAcks)
+
+	pub := &fakePublisher{}
+	handler.pub = pub
+	if !a.NoError(handler.Send(context.Background(), events)) {
+		return
+	}
+
+	msgs := toKafkaMessages(pub.msgs)
+	if !a.Len(msgs, len(events)) {
+		return
+	}
+	for i, msg := range msgs {
+		a.Equal("cnwan."+events[i].Service.Namespace, msg.Topic)
+		a.Equal([]byte(events[i].Service.Id), msg.Key)
+		a.ElementsMatch([]kafka.Header{
+			{Key: EndpointIDHeader, Value: []byte(events[i].Service.Id)},
+			{Key: EventTypeHeader, Value: []byte(events[i].Event)},
+			{Key: "X-Tenant", Value: []byte("acme")},
+		}, msg.Headers)
+		a.Equal(pub.msgs[i].data, msg.Value)
+	}
+}
@@ -0,0 +1,185 @@
+// Copyright © 2021 Cisco
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// All rights reserved.
+
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	defaultNATSSubject string = "cnwan.events"
+)
+
+// natsPublisher publishes messages to NATS.
+type natsPublisher struct {
+	conn *nats.Conn
+	// js is used to publish messages if they must be acknowledged by
+	// JetStream.
+	js nats.JetStreamContext
+}
+
+// newNATSSink returns a handler that publishes events to NATS, e.g.
+// nats://host-1:4222,host-2:4222?subject=cnwan.{{.Namespace}}.
+//
+// These query parameters are supported:
+//   - subject: the template of the subject, "cnwan.events" by default.
+//   - jetstream: if true, each message must be acknowledged by JetStream,
+//     so the subject must be part of a stream. Otherwise, messages are
+//     considered delivered once the server receives them.
+func newNATSSink(endpoint string, opts *HandlerOptions) (Handler, error) {
+	u, err := parseBrokerURL(endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkBrokerOptions(opts); err != nil {
+		return nil, err
+	}
+
+	subject := defaultNATSSubject
+	if u.query.Get("subject") != "" {
+		subject = u.query.Get("subject")
+	}
+
+	useJetStream := false
+	if val := u.query.Get("jetstream"); len(val) > 0 {
+		useJetStream, err = strconv.ParseBool(val)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for jetstream: %w", err)
+		}
+	}
+
+	servers := make([]string, len(u.hosts))
+	for i, host := range u.hosts {
+		servers[i] = "nats://" + host
+	}
+
+	natsOpts, err := getNATSOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	// The connection is retried in background, so that events can be
+	// published again once the server is reachable.
+	conn, err := nats.Connect(strings.Join(servers, ","), natsOpts...)
+	if err != nil {
+		return nil, err
+	}
+
+	pub := &natsPublisher{conn: conn}
+	if useJetStream {
+		if pub.js, err = conn.JetStream(); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+
+	return newBrokerHandler(endpoint, subject, pub, opts)
+}
+
+func getNATSOptions(opts *HandlerOptions) ([]nats.Option, error) {
+	natsOpts := []nats.Option{
+		nats.Name("cnwan-reader"),
+		nats.RetryOnFailedConnect(true),
+		nats.MaxReconnects(-1),
+		nats.DisconnectErrHandler(func(_ *nats.Conn, err error) {
+			if err != nil {
+				log.Warn().Err(err).Msg("disconnected from nats")
+			}
+		}),
+	}
+
+	if opts.TLS != nil {
+		tlsConfig, err := newTLSConfig(opts.TLS)
+		if err != nil {
+			return nil, err
+		}
+		natsOpts = append(natsOpts, nats.Secure(tlsConfig))
+	}
+
+	auth, err := newAuthenticator(opts.Auth)
+	if err != nil {
+		return nil, err
+	}
+
+	if auth != nil && auth.token != nil {
+		// The token is read again on each connection, so that it can be
+		// rotated.
+		natsOpts = append(natsOpts, nats.TokenHandler(func() string {
+			token, err := auth.token.get()
+			if err != nil {
+				log.Err(err).Msg("could not get token for nats")
+			}
+			return token
+		}))
+	}
+
+	if auth != nil && len(auth.opts.Username) > 0 {
+		natsOpts = append(natsOpts, nats.UserInfo(auth.opts.Username, auth.opts.Password))
+	}
+
+	return natsOpts, nil
+}
+
+func (n *natsPublisher) publish(ctx context.Context, msgs []*brokerMessage) error {
+	ctx, canc := context.WithTimeout(ctx, 20*time.Second)
+	defer canc()
+
+	for _, msg := range msgs {
+		natsMsg := nats.NewMsg(msg.subject)
+		natsMsg.Data = msg.data
+		for key, val := range msg.headers {
+			natsMsg.Header.Set(key, val)
+		}
+
+		if n.js != nil {
+			if _, err := n.js.PublishMsg(natsMsg, nats.Context(ctx)); err != nil {
+				return fmt.Errorf("message on %s not acknowledged: %w", msg.subject, err)
+			}
+			continue
+		}
+
+		if err := n.conn.PublishMsg(natsMsg); err != nil {
+			return err
+		}
+	}
+
+	if n.js != nil {
+		return nil
+	}
+
+	// Core NATS doesn't acknowledge messages: a flush makes sure that the
+	// server received all of them.
+	if err := n.conn.FlushWithContext(ctx); err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			return errors.New("timeout expired while waiting for nats to receive messages")
+		}
+		return err
+	}
+
+	return nil
+}
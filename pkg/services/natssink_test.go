@@ -0,0 +1,148 @@
+// Copyright © 2021 Cisco
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// All rights reserved.
+
+package services
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/openapi"
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/assert"
+)
+
+func runNATSServer(t *testing.T) (*server.Server, func()) {
+	dir, err := ioutil.TempDir("", "cnwan-nats")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv, err := server.NewServer(&server.Options{
+		Host:      "127.0.0.1",
+		Port:      server.RANDOM_PORT,
+		JetStream: true,
+		StoreDir:  dir,
+	})
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+
+	go srv.Start()
+	if !srv.ReadyForConnections(5 * time.Second) {
+		srv.Shutdown()
+		os.RemoveAll(dir)
+		t.Fatal("nats server is not ready")
+	}
+
+	return srv, func() {
+		srv.Shutdown()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestNATSSink(t *testing.T) {
+	a := assert.New(t)
+	srv, stop := runNATSServer(t)
+	defer stop()
+	host := strings.TrimPrefix(srv.ClientURL(), "nats://")
+
+	conn, err := nats.Connect(srv.ClientURL())
+	if !a.NoError(err) {
+		return
+	}
+	defer conn.Close()
+
+	sub, err := conn.SubscribeSync("cnwan.>")
+	if !a.NoError(err) {
+		return
+	}
+
+	events := []openapi.Event{
+		{
+			Id:    "first-id",
+			Event: "create",
+			Service: openapi.Service{
+				Id:        "ns/serv/first",
+				Name:      "first",
+				Namespace: "ns",
+				Metadata:  []openapi.Metadata{{Key: "env", Value: "prod"}},
+			},
+		},
+		{
+			Id:    "second-id",
+			Event: "update",
+			Service: openapi.Service{
+				Id:        "ns/serv/second",
+				Name:      "second",
+				Namespace: "ns",
+				Metadata:  []openapi.Metadata{{Key: "env", Value: "dev"}},
+			},
+		},
+	}
+
+	h, err := NewHandler("nats://"+host+"?subject=cnwan.{{.Namespace}}.{{.Metadata.env}}", &HandlerOptions{})
+	if !a.NoError(err) {
+		return
+	}
+	a.NoError(h.Send(context.Background(), events))
+
+	for i, expSubject := range []string{"cnwan.ns.prod", "cnwan.ns.dev"} {
+		msg, err := sub.NextMsg(time.Second)
+		if !a.NoError(err) {
+			return
+		}
+		a.Equal(expSubject, msg.Subject)
+		a.Equal(events[i].Service.Id, msg.Header.Get(EndpointIDHeader))
+		a.Equal(events[i].Event, msg.Header.Get(EventTypeHeader))
+	}
+
+	sub.Unsubscribe()
+
+	// With JetStream, messages on subjects that are not part of a stream
+	// are not acknowledged
+	jsHandler, err := NewHandler("nats://"+host+"?jetstream=true", &HandlerOptions{})
+	if !a.NoError(err) {
+		return
+	}
+	a.Error(jsHandler.Send(context.Background(), events))
+
+	js, err := conn.JetStream()
+	if !a.NoError(err) {
+		return
+	}
+	_, err = js.AddStream(&nats.StreamConfig{Name: "CNWAN", Subjects: []string{"cnwan.events"}})
+	if !a.NoError(err) {
+		return
+	}
+	a.NoError(jsHandler.Send(context.Background(), events))
+
+	info, err := js.StreamInfo("CNWAN")
+	if a.NoError(err) {
+		a.Equal(uint64(len(events)), info.State.Msgs)
+	}
+
+	_, err = NewHandler("nats://"+host+"?jetstream=maybe", &HandlerOptions{})
+	a.Error(err)
+}
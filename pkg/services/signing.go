@@ -0,0 +1,159 @@
+// Copyright © 2021 Cisco
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// All rights reserved.
+
+package services
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// SignatureHeader is the header containing the signatures of the
+	// request, in the form v1=<signature>,v1=<signature>: one for each
+	// secret.
+	SignatureHeader string = "X-Cnwan-Signature"
+	// SignatureTimestampHeader is the header containing the time when the
+	// request was signed, as seconds since the Unix epoch.
+	SignatureTimestampHeader string = "X-Cnwan-Timestamp"
+
+	signatureVersion string = "v1"
+)
+
+// SigningOptions contains the secrets to sign requests with.
+type SigningOptions struct {
+	// SecretFiles are paths of files, each containing a secret shared with
+	// the adaptor. Requests are signed with all of them, so that a secret
+	// can be rotated by adding the new one, updating the adaptor and only
+	// then removing the old one. Files are read again when they change.
+	SecretFiles []string
+}
+
+// signingTransport signs the body of each request with HMAC-SHA256.
+type signingTransport struct {
+	base    http.RoundTripper
+	secrets []*secretFile
+}
+
+// newSigningClient returns a copy of client that signs each request with
+// the secrets in opts.
+func newSigningClient(client *http.Client, opts *SigningOptions) (*http.Client, error) {
+	if len(opts.SecretFiles) == 0 {
+		return nil, errors.New("no signing secrets provided")
+	}
+
+	transport := &signingTransport{base: client.Transport}
+	if transport.base == nil {
+		transport.base = http.DefaultTransport
+	}
+
+	for _, secretPath := range opts.SecretFiles {
+		secret, err := newSecretFile(secretPath, "signing secret")
+		if err != nil {
+			return nil, err
+		}
+		transport.secrets = append(transport.secrets, secret)
+	}
+
+	signingClient := *client
+	signingClient.Transport = transport
+	return &signingClient, nil
+}
+
+// RoundTrip signs the request and sends it.
+func (s *signingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	body := []byte{}
+	if req.Body != nil {
+		b, err := ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		body = b
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	signatures := make([]string, len(s.secrets))
+	for i, secret := range s.secrets {
+		val, err := secret.get()
+		if err != nil {
+			return nil, err
+		}
+		signatures[i] = signatureVersion + "=" + sign(val, timestamp, body)
+	}
+
+	// A RoundTripper must not modify the original request
+	signed := req.Clone(req.Context())
+	signed.Body = ioutil.NopCloser(bytes.NewReader(body))
+	signed.Header.Set(SignatureTimestampHeader, timestamp)
+	signed.Header.Set(SignatureHeader, strings.Join(signatures, ","))
+
+	return s.base.RoundTrip(signed)
+}
+
+// sign returns the HMAC-SHA256 of the timestamp and the body, separated by
+// a dot, in hex.
+func sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifySignature returns nil if the request with the provided headers and
+// body has been signed with any of the secrets no longer than tolerance ago.
+// It can be used by adaptors written in Go.
+func VerifySignature(secrets []string, header http.Header, body []byte, tolerance time.Duration) error {
+	timestamp := header.Get(SignatureTimestampHeader)
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid %s header: %s", SignatureTimestampHeader, timestamp)
+	}
+
+	if age := time.Since(time.Unix(unix, 0)); age > tolerance || age < -tolerance {
+		return errors.New("signature timestamp is outside the tolerance")
+	}
+
+	for _, signature := range strings.Split(header.Get(SignatureHeader), ",") {
+		version, value := "", ""
+		if i := strings.Index(signature, "="); i >= 0 {
+			version, value = strings.TrimSpace(signature[:i]), strings.TrimSpace(signature[i+1:])
+		}
+		if version != signatureVersion {
+			continue
+		}
+
+		for _, secret := range secrets {
+			if hmac.Equal([]byte(value), []byte(sign(secret, timestamp, body))) {
+				return nil
+			}
+		}
+	}
+
+	return errors.New("no valid signature found")
+}
@@ -0,0 +1,143 @@
+// Copyright © 2021 Cisco
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// All rights reserved.
+
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/openapi"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSignedRequests(t *testing.T) {
+	a := assert.New(t)
+	dir, err := ioutil.TempDir("", "cnwan-signing")
+	if !a.NoError(err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	oldSecret, newSecret := path.Join(dir, "old"), path.Join(dir, "new")
+	ioutil.WriteFile(oldSecret, []byte("old-secret\n"), 0600)
+	ioutil.WriteFile(newSecret, []byte("new-secret\n"), 0600)
+
+	var (
+		header http.Header
+		body   []byte
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header
+		body, _ = ioutil.ReadAll(r.Body)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	events := []openapi.Event{{Id: "id", Event: "create", Service: openapi.Service{Id: "ns/serv/endp"}}}
+	for _, format := range []string{FormatOpenAPI, FormatCloudEventsBatch} {
+		h, err := NewHandler(srv.URL, &HandlerOptions{
+			Format:  format,
+			Signing: &SigningOptions{SecretFiles: []string{oldSecret, newSecret}},
+		})
+		if !a.NoError(err) || !a.NoError(h.Send(context.Background(), events)) {
+			return
+		}
+
+		a.Contains(string(body), "ns/serv/endp")
+		a.Len(strings.Split(header.Get(SignatureHeader), ","), 2)
+		a.NoError(VerifySignature([]string{"old-secret"}, header, body, time.Minute))
+		a.NoError(VerifySignature([]string{"new-secret"}, header, body, time.Minute))
+		a.Error(VerifySignature([]string{"another-secret"}, header, body, time.Minute))
+	}
+
+	// Secrets are read again when they change
+	h, err := NewHandler(srv.URL, &HandlerOptions{Signing: &SigningOptions{SecretFiles: []string{newSecret}}})
+	if !a.NoError(err) {
+		return
+	}
+	ioutil.WriteFile(newSecret, []byte("rotated-secret"), 0600)
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(newSecret, later, later)
+
+	a.NoError(h.Send(context.Background(), events))
+	a.NoError(VerifySignature([]string{"rotated-secret"}, header, body, time.Minute))
+	a.Error(VerifySignature([]string{"new-secret"}, header, body, time.Minute))
+
+	_, err = NewHandler(srv.URL, &HandlerOptions{Signing: &SigningOptions{}})
+	a.Equal(errors.New("no signing secrets provided"), err)
+}
+
+func TestVerifySignature(t *testing.T) {
+	a := assert.New(t)
+	body := []byte(`[{"event":"create"}]`)
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	old := strconv.FormatInt(time.Now().Add(-time.Hour).Unix(), 10)
+
+	newHeader := func(timestamp, signature string) http.Header {
+		h := http.Header{}
+		h.Set(SignatureTimestampHeader, timestamp)
+		h.Set(SignatureHeader, signature)
+		return h
+	}
+
+	cases := []struct {
+		header http.Header
+		expErr error
+	}{
+		{
+			header: newHeader(now, "v1="+sign("secret", now, body)),
+		},
+		{
+			header: newHeader(now, "v1=abc, v1="+sign("secret", now, body)),
+		},
+		{
+			header: newHeader("yesterday", "v1="+sign("secret", now, body)),
+			expErr: fmt.Errorf("invalid %s header: %s", SignatureTimestampHeader, "yesterday"),
+		},
+		{
+			header: newHeader(old, "v1="+sign("secret", old, body)),
+			expErr: errors.New("signature timestamp is outside the tolerance"),
+		},
+		{
+			header: newHeader(now, "v0="+sign("secret", now, body)),
+			expErr: errors.New("no valid signature found"),
+		},
+		{
+			header: newHeader(now, "v1="+sign("secret", now, []byte("[]"))),
+			expErr: errors.New("no valid signature found"),
+		},
+	}
+
+	for i, currCase := range cases {
+		err := VerifySignature([]string{"another", "secret"}, currCase.header, body, 5*time.Minute)
+		if !a.Equal(currCase.expErr, err) {
+			a.FailNow("case failed", fmt.Sprintf("case %d", i))
+		}
+	}
+}
@@ -0,0 +1,155 @@
+// Copyright © 2021 Cisco
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// All rights reserved.
+
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/openapi"
+)
+
+// SinkFactory returns a Handler that sends events to the sink at endpoint,
+// which includes the scheme the factory has been registered with.
+// The API version in opts is always set.
+type SinkFactory func(endpoint string, opts *HandlerOptions) (Handler, error)
+
+var (
+	sinksLock sync.RWMutex
+	sinks     = map[string]SinkFactory{}
+)
+
+// RegisterSink makes NewHandler use factory for all endpoints with the
+// provided scheme, e.g. "stdout" for stdout://.
+// If a factory was already registered for the scheme, it is replaced.
+func RegisterSink(scheme string, factory SinkFactory) {
+	sinksLock.Lock()
+	defer sinksLock.Unlock()
+	sinks[scheme] = factory
+}
+
+func getSink(scheme string) (SinkFactory, bool) {
+	sinksLock.RLock()
+	defer sinksLock.RUnlock()
+	factory, exists := sinks[scheme]
+	return factory, exists
+}
+
+func init() {
+	httpSink := func(endpoint string, opts *HandlerOptions) (Handler, error) {
+		return newHTTPHandler(endpoint, opts, nil)
+	}
+
+	RegisterSink("http", httpSink)
+	RegisterSink("https", httpSink)
+	RegisterSink("stdout", newStdoutSink)
+	RegisterSink("file", newFileSink)
+	RegisterSink("unix", newUnixSink)
+	RegisterSink("grpc", newGRPCSink)
+	RegisterSink("nats", newNATSSink)
+	RegisterSink("kafka", newKafkaSink)
+}
+
+// newStdoutSink returns a handler that writes events on the standard output,
+// one JSON per line.
+func newStdoutSink(_ string, opts *HandlerOptions) (Handler, error) {
+	return newJSONLinesHandler(os.Stdout, opts)
+}
+
+// eventEncoder converts events in what is written or published by sinks
+// that don't use http, according to the API version and format.
+type eventEncoder struct {
+	apiVersion string
+	// ce is used to format events as CloudEvents, if requested
+	ce *cloudEventsHandler
+}
+
+func newEventEncoder(opts *HandlerOptions) (*eventEncoder, error) {
+	enc := &eventEncoder{apiVersion: opts.APIVersion}
+
+	switch opts.Format {
+	case "", FormatOpenAPI:
+	case FormatCloudEventsStructured, FormatCloudEventsBatch, FormatCloudEventsBinary:
+		enc.ce = &cloudEventsHandler{apiVersion: opts.APIVersion}
+	default:
+		return nil, fmt.Errorf("unsupported event format: %s", opts.Format)
+	}
+
+	return enc, nil
+}
+
+// encode returns the value to marshal for ev: the event itself, its v2
+// version or a CloudEvent in structured mode.
+func (e *eventEncoder) encode(ev openapi.Event, now time.Time) (interface{}, error) {
+	switch {
+	case e.ce != nil:
+		return e.ce.toCloudEvent(ev, now)
+	case e.apiVersion == APIVersionV2:
+		return ToEventsV2([]openapi.Event{ev})[0], nil
+	default:
+		return ev, nil
+	}
+}
+
+// jsonLinesHandler writes each event as a JSON in its own line.
+type jsonLinesHandler struct {
+	lock sync.Mutex
+	w    io.Writer
+	enc  *eventEncoder
+}
+
+func newJSONLinesHandler(w io.Writer, opts *HandlerOptions) (*jsonLinesHandler, error) {
+	enc, err := newEventEncoder(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &jsonLinesHandler{w: w, enc: enc}, nil
+}
+
+// Send writes the events, one per line.
+func (j *jsonLinesHandler) Send(ctx context.Context, events []openapi.Event) error {
+	now := time.Now().UTC()
+	buf := &bytes.Buffer{}
+	enc := json.NewEncoder(buf)
+
+	for _, ev := range events {
+		line, err := j.enc.encode(ev, now)
+		if err != nil {
+			return err
+		}
+
+		if err := enc.Encode(line); err != nil {
+			return err
+		}
+	}
+
+	// Events are written all at once, so that lines of different batches
+	// are never mixed.
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	_, err := j.w.Write(buf.Bytes())
+	return err
+}
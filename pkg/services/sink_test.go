@@ -0,0 +1,239 @@
+// Copyright © 2021 Cisco
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// All rights reserved.
+
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/openapi"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeSink struct {
+	endpoint string
+	opts     *HandlerOptions
+}
+
+func (f *fakeSink) Send(ctx context.Context, events []openapi.Event) error {
+	return nil
+}
+
+func TestRegisterSink(t *testing.T) {
+	a := assert.New(t)
+
+	_, err := NewHandler("fake://somewhere", nil)
+	a.Equal(errors.New("unsupported sink: fake"), err)
+
+	RegisterSink("fake", func(endpoint string, opts *HandlerOptions) (Handler, error) {
+		return &fakeSink{endpoint: endpoint, opts: opts}, nil
+	})
+	defer func() {
+		sinksLock.Lock()
+		delete(sinks, "fake")
+		sinksLock.Unlock()
+	}()
+
+	h, err := NewHandler("fake://somewhere", &HandlerOptions{Format: FormatOpenAPI})
+	a.NoError(err)
+	a.Equal(&fakeSink{
+		endpoint: "fake://somewhere",
+		opts:     &HandlerOptions{APIVersion: APIVersionV1, Format: FormatOpenAPI},
+	}, h)
+}
+
+func TestJSONLinesHandler(t *testing.T) {
+	a := assert.New(t)
+	events := []openapi.Event{
+		{
+			Id:       "first-id",
+			Event:    "create",
+			Sequence: 1,
+			Service: openapi.Service{
+				Id:       "ns/serv/first",
+				Name:     "first",
+				Metadata: []openapi.Metadata{{Key: "profile", Value: "video"}},
+			},
+		},
+		{
+			Id:       "second-id",
+			Event:    "delete",
+			Sequence: 4,
+			Service:  openapi.Service{Id: "ns/serv/second", Name: "second"},
+		},
+	}
+
+	cases := []struct {
+		opts   *HandlerOptions
+		expKey string
+		expErr error
+	}{
+		{
+			opts:   &HandlerOptions{APIVersion: APIVersionV1},
+			expKey: "event",
+		},
+		{
+			opts:   &HandlerOptions{APIVersion: APIVersionV2},
+			expKey: "event",
+		},
+		{
+			opts:   &HandlerOptions{APIVersion: APIVersionV1, Format: FormatCloudEventsBatch},
+			expKey: "specversion",
+		},
+		{
+			opts:   &HandlerOptions{Format: "xml"},
+			expErr: errors.New("unsupported event format: xml"),
+		},
+	}
+
+	failed := func(i int) {
+		a.FailNow("case failed", fmt.Sprintf("case %d", i))
+	}
+	for i, currCase := range cases {
+		buf := &bytes.Buffer{}
+		h, err := newJSONLinesHandler(buf, currCase.opts)
+		if !a.Equal(currCase.expErr, err) {
+			failed(i)
+		}
+		if err != nil {
+			continue
+		}
+
+		if !a.NoError(h.Send(context.Background(), events)) {
+			failed(i)
+		}
+
+		lines := []map[string]interface{}{}
+		scanner := bufio.NewScanner(buf)
+		for scanner.Scan() {
+			line := map[string]interface{}{}
+			if !a.NoError(json.Unmarshal(scanner.Bytes(), &line)) {
+				failed(i)
+			}
+			lines = append(lines, line)
+		}
+
+		if !a.Len(lines, len(events)) {
+			failed(i)
+		}
+		for _, line := range lines {
+			if !a.Contains(line, currCase.expKey) {
+				failed(i)
+			}
+		}
+	}
+}
+
+func TestFileSink(t *testing.T) {
+	a := assert.New(t)
+	dir, err := ioutil.TempDir("", "cnwan-sink")
+	if !a.NoError(err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	filePath := path.Join(dir, "events.jsonl")
+
+	for _, endpoint := range []string{
+		"file://",
+		"file://" + filePath + "?maxSize=-1",
+		"file://" + filePath + "?compress=maybe",
+	} {
+		_, err := NewHandler(endpoint, nil)
+		a.Error(err, endpoint)
+	}
+
+	h, err := NewHandler("file://"+filePath+"?maxSize=1&maxBackups=2&compress=true", nil)
+	if !a.NoError(err) {
+		return
+	}
+
+	ev := openapi.Event{Id: "id", Event: "create", Service: openapi.Service{Id: "ns/serv/endp"}}
+	a.NoError(h.Send(context.Background(), []openapi.Event{ev}))
+	a.NoError(h.Send(context.Background(), []openapi.Event{ev}))
+
+	content, err := ioutil.ReadFile(filePath)
+	if !a.NoError(err) {
+		return
+	}
+	a.Equal(2, bytes.Count(content, []byte("\n")))
+}
+
+func TestUnixSink(t *testing.T) {
+	a := assert.New(t)
+	dir, err := ioutil.TempDir("", "cnwan-sink")
+	if !a.NoError(err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+	socketPath := path.Join(dir, "adaptor.sock")
+
+	listener, err := net.Listen("unix", socketPath)
+	if !a.NoError(err) {
+		return
+	}
+
+	var reqPath string
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reqPath = r.URL.Path
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	srv.Listener = listener
+	srv.Start()
+	defer srv.Close()
+
+	cases := []struct {
+		endpoint string
+		expPath  string
+	}{
+		{
+			endpoint: "unix://" + socketPath,
+			expPath:  "/events",
+		},
+		{
+			endpoint: "unix://" + socketPath + "?path=/cnwan/",
+			expPath:  "/cnwan/events",
+		},
+	}
+
+	failed := func(i int) {
+		a.FailNow("case failed", fmt.Sprintf("case %d", i))
+	}
+	for i, currCase := range cases {
+		h, err := NewHandler(currCase.endpoint, nil)
+		if !a.NoError(err) {
+			failed(i)
+		}
+
+		err = h.Send(context.Background(), []openapi.Event{{Event: "create"}})
+		if !a.NoError(err) || !a.Equal(currCase.expPath, reqPath) {
+			failed(i)
+		}
+	}
+}
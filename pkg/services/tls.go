@@ -0,0 +1,103 @@
+// Copyright © 2021 Cisco
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// All rights reserved.
+
+package services
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// TLSOptions contains settings about how to establish a secure connection
+// with the adaptor. They are only used with https:// adaptor endpoints.
+type TLSOptions struct {
+	// CACert is the path to a bundle of certificates of the CAs that signed
+	// the adaptor's certificate. If empty, the system's ones are used.
+	CACert string
+	// ClientCert is the path to the certificate to present to the adaptor,
+	// in case it requires mutual TLS.
+	ClientCert string
+	// ClientKey is the path to the private key of ClientCert.
+	ClientKey string
+	// ServerName is the name to expect in the adaptor's certificate and to
+	// send via SNI, in case it is different from the host of the endpoint.
+	ServerName string
+}
+
+// adaptorURL returns the URL of the endpoint, using http:// in case it
+// doesn't have a scheme.
+func adaptorURL(endpoint string) string {
+	if strings.HasPrefix(endpoint, "https://") || strings.HasPrefix(endpoint, "http://") {
+		return endpoint
+	}
+
+	return fmt.Sprintf("http://%s", endpoint)
+}
+
+// newHTTPClient returns a client that uses opts for its TLS connections.
+func newHTTPClient(opts *TLSOptions) (*http.Client, error) {
+	if opts == nil {
+		return &http.Client{}, nil
+	}
+
+	tlsConfig, err := newTLSConfig(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+
+	return &http.Client{Transport: transport}, nil
+}
+
+// newTLSConfig returns the TLS configuration defined by opts.
+func newTLSConfig(opts *TLSOptions) (*tls.Config, error) {
+	tlsConfig := &tls.Config{ServerName: opts.ServerName}
+
+	if len(opts.CACert) > 0 {
+		caCert, err := ioutil.ReadFile(opts.CACert)
+		if err != nil {
+			return nil, fmt.Errorf("could not read CA certificate: %w", err)
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caCert) {
+			return nil, errors.New("no valid certificates found in CA certificate")
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	switch {
+	case len(opts.ClientCert) > 0 && len(opts.ClientKey) > 0:
+		cert, err := tls.LoadX509KeyPair(opts.ClientCert, opts.ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("could not load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	case len(opts.ClientCert) > 0 || len(opts.ClientKey) > 0:
+		return nil, errors.New("client certificate and key must be provided together")
+	}
+
+	return tlsConfig, nil
+}
@@ -0,0 +1,278 @@
+// Copyright © 2021 Cisco
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// All rights reserved.
+
+package services
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/openapi"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewHTTPClient(t *testing.T) {
+	a := assert.New(t)
+	dir, err := ioutil.TempDir("", "cnwan-tls")
+	if !a.NoError(err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	certs, err := generateTestCertificates(dir)
+	if !a.NoError(err) {
+		return
+	}
+	notPEM := path.Join(dir, "not-pem")
+	ioutil.WriteFile(notPEM, []byte("not a certificate"), 0600)
+
+	cases := []struct {
+		opts   *TLSOptions
+		expErr error
+	}{
+		{},
+		{
+			opts: &TLSOptions{CACert: certs.caCert, ClientCert: certs.clientCert, ClientKey: certs.clientKey},
+		},
+		{
+			opts:   &TLSOptions{ClientCert: certs.clientCert},
+			expErr: errors.New("client certificate and key must be provided together"),
+		},
+		{
+			opts:   &TLSOptions{CACert: notPEM},
+			expErr: errors.New("no valid certificates found in CA certificate"),
+		},
+	}
+
+	failed := func(i int) {
+		a.FailNow("case failed", fmt.Sprintf("case %d", i))
+	}
+	for i, currCase := range cases {
+		_, err := newHTTPClient(currCase.opts)
+		if !a.Equal(currCase.expErr, err) {
+			failed(i)
+		}
+	}
+}
+
+func TestSendTLS(t *testing.T) {
+	a := assert.New(t)
+	dir, err := ioutil.TempDir("", "cnwan-tls")
+	if !a.NoError(err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	certs, err := generateTestCertificates(dir)
+	if !a.NoError(err) {
+		return
+	}
+	caPool := x509.NewCertPool()
+	caPEM, _ := ioutil.ReadFile(certs.caCert)
+	caPool.AppendCertsFromPEM(caPEM)
+	serverCert, err := tls.LoadX509KeyPair(certs.serverCert, certs.serverKey)
+	if !a.NoError(err) {
+		return
+	}
+
+	// The server's certificate is only valid for adaptor.example, and it
+	// requires clients to present a certificate signed by the test CA.
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	srv.TLS = &tls.Config{
+		Certificates: []tls.Certificate{serverCert},
+		ClientCAs:    caPool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	}
+	srv.StartTLS()
+	defer srv.Close()
+
+	events := []openapi.Event{{Event: "create"}}
+	cases := []struct {
+		format  string
+		opts    *TLSOptions
+		expFail bool
+	}{
+		{
+			opts: &TLSOptions{
+				CACert:     certs.caCert,
+				ClientCert: certs.clientCert,
+				ClientKey:  certs.clientKey,
+				ServerName: "adaptor.example",
+			},
+		},
+		{
+			format: FormatCloudEventsBatch,
+			opts: &TLSOptions{
+				CACert:     certs.caCert,
+				ClientCert: certs.clientCert,
+				ClientKey:  certs.clientKey,
+				ServerName: "adaptor.example",
+			},
+		},
+		{
+			// No client certificate
+			opts:    &TLSOptions{CACert: certs.caCert, ServerName: "adaptor.example"},
+			expFail: true,
+		},
+		{
+			// The name doesn't match the server's certificate
+			opts: &TLSOptions{
+				CACert:     certs.caCert,
+				ClientCert: certs.clientCert,
+				ClientKey:  certs.clientKey,
+			},
+			expFail: true,
+		},
+		{
+			// Unknown CA
+			format: FormatCloudEventsStructured,
+			opts: &TLSOptions{
+				ClientCert: certs.clientCert,
+				ClientKey:  certs.clientKey,
+				ServerName: "adaptor.example",
+			},
+			expFail: true,
+		},
+	}
+
+	failed := func(i int) {
+		a.FailNow("case failed", fmt.Sprintf("case %d", i))
+	}
+	for i, currCase := range cases {
+		h, err := NewHandler(srv.URL, &HandlerOptions{Format: currCase.format, TLS: currCase.opts})
+		if !a.NoError(err) {
+			failed(i)
+		}
+
+		err = h.Send(context.Background(), events)
+		if currCase.expFail != (err != nil) {
+			failed(i)
+		}
+	}
+}
+
+type testCertificates struct {
+	caCert     string
+	serverCert string
+	serverKey  string
+	clientCert string
+	clientKey  string
+}
+
+// generateTestCertificates creates a CA and uses it to sign a server and a
+// client certificate, writing all of them in dir.
+func generateTestCertificates(dir string) (*testCertificates, error) {
+	writePEM := func(fileName, pemType string, data []byte) error {
+		pemData := pem.EncodeToMemory(&pem.Block{Type: pemType, Bytes: data})
+		return ioutil.WriteFile(path.Join(dir, fileName), pemData, 0600)
+	}
+
+	newCert := func(template, parent *x509.Certificate, parentKey *ecdsa.PrivateKey, name string) (*x509.Certificate, *ecdsa.PrivateKey, error) {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			return nil, nil, err
+		}
+		if parent == nil {
+			parent, parentKey = template, key
+		}
+
+		der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := writePEM(name+".crt", "CERTIFICATE", der); err != nil {
+			return nil, nil, err
+		}
+
+		keyDer, err := x509.MarshalECPrivateKey(key)
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := writePEM(name+".key", "EC PRIVATE KEY", keyDer); err != nil {
+			return nil, nil, err
+		}
+
+		cert, err := x509.ParseCertificate(der)
+		return cert, key, err
+	}
+
+	notBefore := time.Now().Add(-time.Hour)
+	notAfter := time.Now().Add(time.Hour)
+
+	ca, caKey, err := newCert(&x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "cnwan-reader-test-ca"},
+		NotBefore:             notBefore,
+		NotAfter:              notAfter,
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+	}, nil, nil, "ca")
+	if err != nil {
+		return nil, err
+	}
+
+	if _, _, err := newCert(&x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "adaptor.example"},
+		NotBefore:    notBefore,
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		DNSNames:     []string{"adaptor.example"},
+	}, ca, caKey, "server"); err != nil {
+		return nil, err
+	}
+
+	if _, _, err := newCert(&x509.Certificate{
+		SerialNumber: big.NewInt(3),
+		Subject:      pkix.Name{CommonName: "cnwan-reader"},
+		NotBefore:    notBefore,
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, ca, caKey, "client"); err != nil {
+		return nil, err
+	}
+
+	return &testCertificates{
+		caCert:     path.Join(dir, "ca.crt"),
+		serverCert: path.Join(dir, "server.crt"),
+		serverKey:  path.Join(dir, "server.key"),
+		clientCert: path.Join(dir, "client.crt"),
+		clientKey:  path.Join(dir, "client.key"),
+	}, nil
+}
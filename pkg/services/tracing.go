@@ -0,0 +1,107 @@
+// Copyright © 2021 Cisco
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// All rights reserved.
+
+package services
+
+import (
+	"net/http"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/semconv"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc/metadata"
+)
+
+// tracingTransport propagates the trace context of each request to the
+// adaptor, with W3C traceparent headers.
+type tracingTransport struct {
+	base http.RoundTripper
+}
+
+// newTracingClient returns a copy of client that propagates the trace
+// context of each request.
+func newTracingClient(client *http.Client) *http.Client {
+	transport := &tracingTransport{base: client.Transport}
+	if transport.base == nil {
+		transport.base = http.DefaultTransport
+	}
+
+	tracingClient := *client
+	tracingClient.Transport = transport
+	return &tracingClient
+}
+
+// RoundTrip adds the trace context to the request and sends it.
+func (t *tracingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// A RoundTripper must not modify the original request
+	traced := req.Clone(req.Context())
+	otel.GetTextMapPropagator().Inject(req.Context(), propagation.HeaderCarrier(traced.Header))
+
+	resp, err := t.base.RoundTrip(traced)
+	if err == nil {
+		trace.SpanFromContext(req.Context()).SetAttributes(semconv.HTTPStatusCodeKey.Int(resp.StatusCode))
+	}
+
+	return resp, err
+}
+
+// metadataCarrier adapts gRPC metadata to carry the trace context.
+type metadataCarrier metadata.MD
+
+func (m metadataCarrier) Get(key string) string {
+	if vals := metadata.MD(m).Get(key); len(vals) > 0 {
+		return vals[0]
+	}
+
+	return ""
+}
+
+func (m metadataCarrier) Set(key, value string) {
+	metadata.MD(m).Set(key, value)
+}
+
+func (m metadataCarrier) Keys() []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+
+	return keys
+}
+
+// mapCarrier adapts the headers of broker messages to carry the trace
+// context.
+type mapCarrier map[string]string
+
+func (m mapCarrier) Get(key string) string {
+	return m[key]
+}
+
+func (m mapCarrier) Set(key, value string) {
+	m[key] = value
+}
+
+func (m mapCarrier) Keys() []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+
+	return keys
+}
@@ -0,0 +1,85 @@
+// Copyright © 2021 Cisco
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// All rights reserved.
+
+package services
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/CloudNativeSDWAN/cnwan-reader/pkg/openapi"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/semconv"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestTracingTransport(t *testing.T) {
+	a := assert.New(t)
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	defer otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator())
+
+	var traceParent string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceParent = r.Header.Get("traceparent")
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	h, err := NewHandler(strings.TrimPrefix(srv.URL, "http://")+"/cnwan", nil)
+	if !a.NoError(err) {
+		return
+	}
+
+	ctx, span := provider.Tracer("test").Start(context.Background(), "SendEvents")
+	a.NoError(h.Send(ctx, []openapi.Event{{Event: "create"}}))
+	span.End()
+
+	sc := span.SpanContext()
+	a.Equal("00-"+sc.TraceID().String()+"-"+sc.SpanID().String()+"-01", traceParent)
+	if spans := exporter.GetSpans(); a.Len(spans, 1) {
+		a.Contains(spans[0].Attributes, semconv.HTTPStatusCodeKey.Int(http.StatusNoContent))
+	}
+}
+
+func TestCarriers(t *testing.T) {
+	a := assert.New(t)
+	provider := sdktrace.NewTracerProvider()
+	ctx, span := provider.Tracer("test").Start(context.Background(), "SendEvents")
+	defer span.End()
+	propagator := propagation.TraceContext{}
+
+	md := metadata.MD{}
+	propagator.Inject(ctx, metadataCarrier(md))
+	a.Len(md.Get("traceparent"), 1)
+	extracted := trace.SpanContextFromContext(propagator.Extract(context.Background(), metadataCarrier(md)))
+	a.Equal(span.SpanContext().TraceID(), extracted.TraceID())
+
+	headers := map[string]string{}
+	propagator.Inject(ctx, mapCarrier(headers))
+	a.Contains(headers, "traceparent")
+}
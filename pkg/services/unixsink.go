@@ -0,0 +1,59 @@
+// Copyright © 2021 Cisco
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// All rights reserved.
+
+package services
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// newUnixSink returns a handler that sends events via http over a Unix
+// domain socket, e.g. unix:///run/adaptor.sock.
+// Events are sent to /events, unless a prefix is set with the path query
+// parameter: e.g. with unix:///run/adaptor.sock?path=/cnwan they are sent
+// to /cnwan/events.
+func newUnixSink(endpoint string, opts *HandlerOptions) (Handler, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	socketPath := u.Host + u.Path
+	if len(socketPath) == 0 {
+		return nil, fmt.Errorf("no socket path provided")
+	}
+
+	dialer := &net.Dialer{}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+		return dialer.DialContext(ctx, "unix", socketPath)
+	}
+
+	// The host is not used to connect, but it is still sent in requests
+	httpEndpoint := "localhost"
+	if prefix := strings.Trim(u.Query().Get("path"), "/"); len(prefix) > 0 {
+		httpEndpoint += "/" + prefix
+	}
+
+	return newHTTPHandler(httpEndpoint, opts, &http.Client{Transport: transport})
+}
@@ -0,0 +1,112 @@
+// Copyright © 2021 Cisco
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// All rights reserved.
+
+package tracing
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpgrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlphttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/semconv"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// ProtocolGRPC exports spans with OTLP over gRPC.
+	ProtocolGRPC string = "grpc"
+	// ProtocolHTTP exports spans with OTLP over HTTP.
+	ProtocolHTTP string = "http"
+
+	instrumentationName string = "github.com/CloudNativeSDWAN/cnwan-reader"
+	serviceName         string = "cnwan-reader"
+)
+
+// Options contains settings about where to export spans.
+type Options struct {
+	// Endpoint of the OTLP collector, e.g. localhost:4317
+	Endpoint string
+	// Protocol to export spans with: ProtocolGRPC or ProtocolHTTP.
+	// If empty, ProtocolGRPC is used
+	Protocol string
+	// Insecure disables TLS when connecting to the collector
+	Insecure bool
+}
+
+// Start sets up tracing and exports spans as defined by opts, until the
+// returned function is called. In any case, the trace context is propagated
+// to adaptors with W3C traceparent headers.
+// If opts is nil, spans are not recorded.
+func Start(ctx context.Context, opts *Options) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	if opts == nil {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	var driver otlp.ProtocolDriver
+	switch opts.Protocol {
+	case "", ProtocolGRPC:
+		grpcOpts := []otlpgrpc.Option{otlpgrpc.WithEndpoint(opts.Endpoint)}
+		if opts.Insecure {
+			grpcOpts = append(grpcOpts, otlpgrpc.WithInsecure())
+		}
+		driver = otlpgrpc.NewDriver(grpcOpts...)
+	case ProtocolHTTP:
+		httpOpts := []otlphttp.Option{otlphttp.WithEndpoint(opts.Endpoint)}
+		if opts.Insecure {
+			httpOpts = append(httpOpts, otlphttp.WithInsecure())
+		}
+		driver = otlphttp.NewDriver(httpOpts...)
+	default:
+		return nil, fmt.Errorf("unsupported OTLP protocol: %s", opts.Protocol)
+	}
+
+	exporter, err := otlp.NewExporter(ctx, driver)
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.ServiceNameKey.String(serviceName))),
+	)
+	otel.SetTracerProvider(provider)
+
+	return provider.Shutdown, nil
+}
+
+// Tracer returns the tracer that creates the spans of the CN-WAN Reader.
+func Tracer() trace.Tracer {
+	return otel.Tracer(instrumentationName)
+}
+
+// End records err in span, if not nil, and ends it.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,90 @@
+// Copyright © 2021 Cisco
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// All rights reserved.
+
+package tracing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestStart(t *testing.T) {
+	a := assert.New(t)
+	defer otel.SetTracerProvider(trace.NewNoopTracerProvider())
+	defer otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator())
+
+	cases := []struct {
+		opts   *Options
+		expErr error
+	}{
+		{},
+		{
+			opts: &Options{Endpoint: "localhost:4318", Protocol: ProtocolHTTP, Insecure: true},
+		},
+		{
+			opts:   &Options{Endpoint: "localhost:4317", Protocol: "udp"},
+			expErr: fmt.Errorf("unsupported OTLP protocol: udp"),
+		},
+	}
+
+	failed := func(i int) {
+		a.FailNow("case failed", fmt.Sprintf("case %d", i))
+	}
+	for i, currCase := range cases {
+		stop, err := Start(context.Background(), currCase.opts)
+		if !a.Equal(currCase.expErr, err) {
+			failed(i)
+		}
+		if err != nil {
+			continue
+		}
+
+		a.Equal([]string{"traceparent", "tracestate"}, otel.GetTextMapPropagator().Fields())
+		if !a.NoError(stop(context.Background())) {
+			failed(i)
+		}
+	}
+}
+
+func TestEnd(t *testing.T) {
+	a := assert.New(t)
+	exporter := tracetest.NewInMemoryExporter()
+	tracer := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)).Tracer("test")
+
+	_, span := tracer.Start(context.Background(), "ok")
+	End(span, nil)
+	_, span = tracer.Start(context.Background(), "failed")
+	End(span, errors.New("adaptor unavailable"))
+
+	spans := exporter.GetSpans()
+	if a.Len(spans, 2) {
+		a.Equal(codes.Unset, spans[0].StatusCode)
+		a.Equal(codes.Error, spans[1].StatusCode)
+		a.Equal("adaptor unavailable", spans[1].StatusMessage)
+	}
+}